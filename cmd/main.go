@@ -2,18 +2,21 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
-	_ "workmate_test_project/docs"
+	"workmate_test_project/docs"
 	"workmate_test_project/internal/config"
 	"workmate_test_project/internal/handler"
 	"workmate_test_project/internal/service"
+	"workmate_test_project/internal/util"
 )
 
 // @title Junior Go-разработчик
@@ -32,26 +35,140 @@ func main() {
 	}
 
 	srv, router := config.SetupServer(cfg.Server.Port)
+	adminServer := config.SetupAdminServer(cfg.Server.AdminAddress)
+
+	taskStore, err := config.SetupTaskStore(cfg.TaskStore)
+	if err != nil {
+		log.Fatalf("ошибка создания хранилища задач: %v", err)
+	}
+	defer taskStore.Close()
+
+	archiveStorage, err := config.SetupArchiveStorage(cfg.ArchiveStorage)
+	if err != nil {
+		log.Fatalf("ошибка создания хранилища архивов: %v", err)
+	}
+	defer archiveStorage.Close()
+
+	compressionLevels := make(map[util.ArchiveFormat]int, len(cfg.Tasks.CompressionLevels))
+	for format, level := range cfg.Tasks.CompressionLevels {
+		compressionLevels[util.ArchiveFormat(format)] = level
+	}
+
+	credentialProfiles := make(map[string]util.Credentials, len(cfg.Download.CredentialProfiles))
+	for name, profile := range cfg.Download.CredentialProfiles {
+		credentialProfiles[name] = util.Credentials{
+			Headers:     profile.Headers,
+			BearerToken: profile.BearerToken,
+			Username:    profile.Username,
+			Password:    profile.Password,
+			Cookies:     profile.Cookies,
+		}
+	}
+
+	taskService, err := service.NewTaskServiceWithOptions(service.TaskServiceOptions{
+		Store: taskStore,
+		Limits: service.TaskLimits{
+			MaxActiveTasks:      cfg.Tasks.MaxActiveTasks,
+			MaxFilesPerTask:     cfg.Tasks.MaxFilesPerTask,
+			DownloadConcurrency: cfg.Tasks.DownloadConcurrency,
+			AllowedMIMETypes:    cfg.Tasks.AllowedMIMETypes,
+			DownloadWorkers:     cfg.Tasks.DownloadWorkers,
+			DownloadQueueSize:   cfg.Tasks.DownloadQueueSize,
+			MaxFileSize:         cfg.Tasks.MaxFileSize,
+			MaxTaskSize:         cfg.Tasks.MaxTaskSize,
+			DiskBudget:          cfg.Tasks.DiskBudget,
+		},
+		CompletedRetention: cfg.Tasks.CompletedRetention,
+		FailedRetention:    cfg.Tasks.FailedRetention,
+		CancelledRetention: cfg.Tasks.CancelledRetention,
+		JanitorInterval:    cfg.Tasks.JanitorInterval,
+		BusyPolicy:         service.BusyPolicy(cfg.Tasks.BusyPolicy),
+		QueueSize:          cfg.Tasks.QueueSize,
+		SpoolDir:           cfg.Tasks.SpoolDir,
+		ArchiveStorage:     archiveStorage,
+		CollisionPolicy:    service.CollisionPolicy(cfg.Tasks.CollisionPolicy),
+		CompressionLevels:  compressionLevels,
+		WriteChecksums:     cfg.Tasks.WriteChecksums,
+		Download: util.DownloaderOptions{
+			ConnectTimeout: cfg.Download.ConnectTimeout,
+			HeaderTimeout:  cfg.Download.HeaderTimeout,
+			IdleTimeout:    cfg.Download.IdleTimeout,
+			MaxAttempts:    cfg.Download.MaxAttempts,
+			RetryBaseDelay: cfg.Download.RetryBaseDelay,
+			RetryMaxDelay:  cfg.Download.RetryMaxDelay,
+			URLPolicy: util.URLPolicy{
+				AllowedSchemes:  cfg.Download.URLPolicy.AllowedSchemes,
+				AllowedHosts:    cfg.Download.URLPolicy.AllowedHosts,
+				DeniedHosts:     cfg.Download.URLPolicy.DeniedHosts,
+				AllowedNetworks: cfg.Download.URLPolicy.AllowedNetworks,
+				MaxRedirects:    cfg.Download.URLPolicy.MaxRedirects,
+			},
+			MaxConnsPerHost:     cfg.Download.MaxConnsPerHost,
+			MaxIdleConnsPerHost: cfg.Download.MaxIdleConnsPerHost,
+			IdleConnTimeout:     cfg.Download.IdleConnTimeout,
+			RateLimit: util.RateLimit{
+				HostRate:    cfg.Download.RateLimit.HostRate,
+				HostBurst:   cfg.Download.RateLimit.HostBurst,
+				GlobalRate:  cfg.Download.RateLimit.GlobalRate,
+				GlobalBurst: cfg.Download.RateLimit.GlobalBurst,
+			},
+		},
+		CredentialProfiles: credentialProfiles,
+	})
+	if err != nil {
+		log.Fatalf("ошибка создания сервиса задач: %v", err)
+	}
+
+	limits := taskService.Limits()
+	docs.SwaggerInfo.Description += fmt.Sprintf(
+		". Лимиты сервера: активных задач - %d, файлов в задаче - %d, допустимые типы файлов - %s",
+		limits.MaxActiveTasks, limits.MaxFilesPerTask, strings.Join(limits.AllowedMIMETypes, ", "),
+	)
 
 	router.Get("/swagger/*", httpSwagger.WrapHandler)
-	taskService := service.NewTaskService()
-	taskHandler := handler.NewTaskHandler(taskService)
+	archiveLinks := handler.NewArchiveLinks(cfg.Server.PublicURL, cfg.Server.TrustProxy, cfg.Server.BasePath,
+		cfg.Server.LinkSecret, cfg.Server.LinkTTL)
+	taskHandler := handler.NewTaskHandler(taskService, archiveLinks)
+	taskHandlerV2 := handler.NewTaskHandlerV2(taskService, archiveLinks)
 
 	router.Route(cfg.Server.BasePath, func(r chi.Router) {
 		r.Post("/create-task", taskHandler.CreateTask)
 		r.Get("/get", taskHandler.GetTaskStatusById)
 		r.Post("/add-file-to-task", taskHandler.AddFileToTask)
+		r.Post("/finalize-task", taskHandler.FinalizeTask)
+		r.Post("/cancel-task", taskHandler.CancelTask)
+		r.Delete("/delete-task", taskHandler.DeleteTask)
+
+		r.Route("/v2", func(r chi.Router) {
+			r.Post("/tasks", taskHandlerV2.CreateTask)
+			r.Get("/tasks", taskHandlerV2.ListTasks)
+			r.Get("/tasks/{id}", taskHandlerV2.GetTask)
+			r.Delete("/tasks/{id}", taskHandlerV2.DeleteTask)
+			r.Post("/tasks/{id}/files", taskHandlerV2.AddFile)
+			r.Post("/tasks/{id}/uploads", taskHandlerV2.UploadFiles)
+			r.Get("/tasks/{id}/files/{fileId}", taskHandlerV2.GetFile)
+			r.Get("/tasks/{id}/archive", taskHandlerV2.DownloadArchive)
+			r.Get("/tasks/{id}/manifest", taskHandlerV2.GetManifest)
+		})
 	})
 
-	runServer(ctx, srv)
+	runServer(ctx, srv, adminServer, taskService)
 }
 
-func runServer(ctx context.Context, server *http.Server) {
-	serverErrors := make(chan error, 1)
+// runServer запускает сервер API и служебный сервер с метриками (adminServer, может быть nil)
+// и останавливает их по сигналу или при ошибке одного из них.
+func runServer(ctx context.Context, server *http.Server, adminServer *http.Server, taskService *service.TaskService) {
+	serverErrors := make(chan error, 2)
 	go func() {
 		log.Println("сервер запущен на " + server.Addr)
 		serverErrors <- server.ListenAndServe()
 	}()
+	if adminServer != nil {
+		go func() {
+			log.Println("служебный сервер с метриками запущен на " + adminServer.Addr)
+			serverErrors <- adminServer.ListenAndServe()
+		}()
+	}
 
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM)
@@ -73,4 +190,12 @@ func runServer(ctx context.Context, server *http.Server) {
 	} else {
 		log.Println("Сервер успешно остановлен")
 	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutDownCtx); err != nil {
+			log.Printf("ошибка при остановке служебного сервера: %v", err)
+		}
+	}
+
+	taskService.Close()
+	log.Println("фоновые задачи сервиса остановлены")
 }
@@ -17,7 +17,7 @@ const docTemplate = `{
     "paths": {
         "/add-file-to-task": {
             "post": {
-                "description": "Добавляет файл в архив задачи, ограничение — максимум 3 файла на задачу.",
+                "description": "Ставит файл в очередь скачивания и сразу возвращает его ID. Файл скачивается и записывается в архив задачи в фоне, его состояние (pending, downloading, stored, failed) возвращается в /get. Тип файла определяется по его содержимому и заголовку Content-Type ответа, а не по расширению в URL, и должен входить в tasks.allowed_mime_types; от типа зависит расширение файла в архиве. Количество файлов в задаче задаётся параметром tasks.max_files_per_task конфигурации. Размер файла ограничен tasks.max_file_size, файлов задачи вместе - tasks.max_task_size, файлов всех задач - tasks.disk_budget; файл, превысивший лимит по Content-Length или при скачивании, получает статус failed и код ошибки errorCode. Адреса проверяются политикой исходящих запросов download.url_policy: внутренние адреса (loopback, частные сети, link-local, 169.254.169.254) запрещены, в том числе после разрешения имени хоста и при перенаправлениях. Для сервера с авторизацией можно передать заголовки, bearer-токен, логин и пароль Basic или cookie либо сослаться на профиль download.credential_profiles; учётные данные не сохраняются, не логируются и не попадают в статус и манифест, а на другой хост при перенаправлении не передаются.",
                 "consumes": [
                     "application/json"
                 ],
@@ -39,101 +39,855 @@ const docTemplate = `{
                         }
                     }
                 ],
+                "responses": {
+                    "202": {
+                        "description": "Файл поставлен в очередь скачивания",
+                        "schema": {
+                            "$ref": "#/definitions/handler.AddFileToTaskResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат JSON, превышен лимит файлов или размера задачи, некорректный URL файла, адрес, запрещённый политикой исходящих запросов, некорректные учётные данные или неизвестный профиль",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Задача ещё в очереди, уже завершена, отменена или завершилась с ошибкой",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Очередь скачивания файлов заполнена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "507": {
+                        "description": "Исчерпано место, отведённое сервису под файлы (tasks.disk_budget)",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/cancel-task": {
+            "post": {
+                "description": "Прерывает скачивания задачи, удаляет её архив (если не передан keepArchive) и освобождает слот задачи. Отменённая задача остаётся доступной через /get в течение времени, заданного в конфигурации (tasks.cancelled_retention).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks"
+                ],
+                "summary": "Отменить задачу",
+                "parameters": [
+                    {
+                        "description": "ID задачи и флаг сохранения архива",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CancelTaskRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Задача отменена",
+                        "schema": {
+                            "$ref": "#/definitions/handler.TaskStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат JSON или задача не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Задача уже в конечном статусе",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/create-task": {
+            "post": {
+                "description": "Создаёт задачу, для которой можно добавлять файлы в архив формата zip, tar, tar.gz или tar.zst (поле format, по умолчанию zip). Количество одновременно активных задач ограничено параметром tasks.max_active_tasks конфигурации. Если все слоты заняты и tasks.busy_policy = queue, задача ставится в очередь ожидания (не больше tasks.queue_size задач) и запускается автоматически, когда освободится слот.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks"
+                ],
+                "summary": "Создание новой задачи",
+                "parameters": [
+                    {
+                        "description": "Путь, имя и формат архива",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateTaskRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Успешный ответ с ID созданной задачи",
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateTaskResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Задача поставлена в очередь ожидания",
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateTaskResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат JSON, неподдерживаемый формат архива или путь архива вне корневого каталога архивов",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Архив с таким именем уже существует",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка создания задачи",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Достигнут лимит активных задач или очередь ожидания заполнена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/delete-task": {
+            "delete": {
+                "description": "Удаляет задачу и её архив. Незавершённая задача перед удалением отменяется.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks"
+                ],
+                "summary": "Удалить задачу",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID задачи",
+                        "name": "task-id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Не удалять архив с диска",
+                        "name": "keep-archive",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Задача удалена",
+                        "schema": {
+                            "$ref": "#/definitions/handler.DeleteTaskResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный ID задачи или задача не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/finalize-task": {
+            "post": {
+                "description": "Закрывает архив задачи с уже добавленными файлами (их может быть меньше tasks.max_files_per_task), переводит задачу в статус completed и освобождает слот задачи.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks"
+                ],
+                "summary": "Завершить задачу",
+                "parameters": [
+                    {
+                        "description": "ID задачи",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.FinalizeTaskRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Задача завершена, ссылка на архив доступна",
+                        "schema": {
+                            "$ref": "#/definitions/handler.TaskStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат JSON или задача не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Задача уже в конечном статусе, ещё в очереди или в неё ещё скачиваются файлы",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/get": {
+            "get": {
+                "description": "Возвращает статус задачи и ссылку на архив (если задача завершена).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks"
+                ],
+                "summary": "Получить статус задачи",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID задачи",
+                        "name": "task-id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handler.TaskStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "некорректный ID задачи или задача не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/tasks": {
+            "get": {
+                "description": "Возвращает все задачи, отсортированные по ID. Параметр status оставляет только задачи в указанном статусе.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks-v2"
+                ],
+                "summary": "Список задач",
+                "parameters": [
+                    {
+                        "enum": [
+                            "queued",
+                            "created",
+                            "running",
+                            "completed",
+                            "failed",
+                            "cancelled"
+                        ],
+                        "type": "string",
+                        "description": "Код статуса задачи",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Список задач",
+                        "schema": {
+                            "$ref": "#/definitions/handler.TaskListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Неизвестный статус",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка загрузки задач",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Создаёт задачу и возвращает её состояние, адрес задачи передаётся в заголовке Location. Если все слоты активных задач заняты и tasks.busy_policy = queue, задача ставится в очередь ожидания (ответ 202).",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks-v2"
+                ],
+                "summary": "Создать задачу",
+                "parameters": [
+                    {
+                        "description": "Путь, имя и формат архива",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateTaskRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Задача создана",
+                        "schema": {
+                            "$ref": "#/definitions/handler.TaskStatusResponse"
+                        }
+                    },
+                    "202": {
+                        "description": "Задача поставлена в очередь ожидания",
+                        "schema": {
+                            "$ref": "#/definitions/handler.TaskStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат JSON, неподдерживаемый формат архива или путь архива вне корневого каталога архивов",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Архив с таким именем уже существует",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Достигнут лимит активных задач или очередь ожидания заполнена",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Ошибка создания задачи",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/tasks/{id}": {
+            "get": {
+                "description": "Возвращает статус задачи, состояние её файлов и ссылку на архив (если задача завершена).",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks-v2"
+                ],
+                "summary": "Получить задачу",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Задача",
+                        "schema": {
+                            "$ref": "#/definitions/handler.TaskStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный ID задачи",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Задача не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Удаляет задачу и её архив. Незавершённая задача перед удалением отменяется.",
+                "tags": [
+                    "tasks-v2"
+                ],
+                "summary": "Удалить задачу",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Не удалять архив с диска",
+                        "name": "keep-archive",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Задача удалена"
+                    },
+                    "400": {
+                        "description": "Некорректный ID задачи",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Задача не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/tasks/{id}/archive": {
+            "get": {
+                "description": "Отдаёт архив завершённой задачи (zip, tar, tar.gz или tar.zst, Content-Type соответствует формату) по подписанной ссылке из archiveLink. Поддерживаются запросы части файла (заголовок Range) и условные запросы по ETag (If-None-Match, If-Range). Архив отдаётся как есть: если он зашифрован, в ответе есть заголовок X-Archive-Encryption, а файлы распаковываются паролем, заданным при создании задачи.",
+                "produces": [
+                    "application/zip",
+                    "application/x-tar",
+                    "application/gzip",
+                    "application/zstd"
+                ],
+                "tags": [
+                    "tasks-v2"
+                ],
+                "summary": "Скачать архив задачи",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Время истечения ссылки (Unix-время)",
+                        "name": "expires",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Подпись ссылки",
+                        "name": "signature",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Диапазон байт, например bytes=0-1023",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Архив задачи",
+                        "schema": {
+                            "type": "file"
+                        },
+                        "headers": {
+                            "X-Archive-Encryption": {
+                                "type": "string",
+                                "description": "Способ шифрования архива (winzip-aes-256), только для зашифрованных архивов"
+                            }
+                        }
+                    },
+                    "206": {
+                        "description": "Часть архива",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный ID задачи",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Неверная подпись, истёк срок действия ссылки или задача не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Архив задачи не найден",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Задача ещё не завершена",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/tasks/{id}/files": {
+            "post": {
+                "description": "Ставит файл в очередь скачивания и сразу возвращает его состояние, адрес файла передаётся в заголовке Location. Тип файла определяется по его содержимому и заголовку Content-Type ответа, а не по расширению в URL, и должен входить в tasks.allowed_mime_types; от типа зависит расширение файла в архиве. Количество файлов в задаче задаётся параметром tasks.max_files_per_task конфигурации. Размер файла ограничен tasks.max_file_size, файлов задачи вместе - tasks.max_task_size, файлов всех задач - tasks.disk_budget; файл, превысивший лимит по Content-Length или при скачивании, получает статус failed и код ошибки errorCode. Адреса проверяются политикой исходящих запросов download.url_policy: внутренние адреса (loopback, частные сети, link-local, 169.254.169.254) запрещены, в том числе после разрешения имени хоста и при перенаправлениях. Для сервера с авторизацией можно передать заголовки, bearer-токен, логин и пароль Basic или cookie либо сослаться на профиль download.credential_profiles; учётные данные не сохраняются, не логируются и не попадают в статус и манифест, а на другой хост при перенаправлении не передаются.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks-v2"
+                ],
+                "summary": "Добавить файл к задаче",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "URL, имя файла и авторизация на сервере с файлом",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.AddTaskFileRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Файл поставлен в очередь скачивания",
+                        "schema": {
+                            "$ref": "#/definitions/handler.TaskFileStatusItem"
+                        }
+                    },
+                    "400": {
+                        "description": "Неверный формат JSON, некорректный URL файла, адрес, запрещённый политикой исходящих запросов, некорректные учётные данные или неизвестный профиль",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Задача не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Задача в очереди, в конечном статусе, в ней уже максимальное количество файлов или файлы заняли tasks.max_task_size",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Очередь скачивания файлов заполнена",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "507": {
+                        "description": "Исчерпано место, отведённое сервису под файлы (tasks.disk_budget)",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/tasks/{id}/files/{fileId}": {
+            "get": {
+                "description": "Возвращает состояние файла задачи: pending, downloading, stored или failed.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "tasks-v2"
+                ],
+                "summary": "Получить файл задачи",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID файла",
+                        "name": "fileId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "Файл успешно добавлен к задаче",
+                        "description": "Файл задачи",
                         "schema": {
-                            "$ref": "#/definitions/handler.AddFileToTaskResponse"
+                            "$ref": "#/definitions/handler.TaskFileStatusItem"
                         }
                     },
                     "400": {
-                        "description": "Неверный формат JSON или превышен лимит файлов",
+                        "description": "Некорректный ID задачи или файла",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Задача или файл не найдены",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/create-task": {
-            "post": {
-                "description": "Создаёт задачу, для которой можно добавлять файлы в ZIP архив.",
-                "consumes": [
-                    "application/json"
-                ],
+        "/v2/tasks/{id}/manifest": {
+            "get": {
+                "description": "Возвращает манифест файлов, записанных в архив задачи: адрес и исходное имя файла, имя в архиве, размер, тип, SHA-256 и время скачивания. Тот же манифест записывается в архив (manifest.json) при завершении задачи, пока задача не завершена, в нём только уже записанные файлы.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "tasks"
+                    "tasks-v2"
                 ],
-                "summary": "Создание новой задачи",
+                "summary": "Получить манифест архива",
                 "parameters": [
                     {
-                        "description": "Путь и имя архива",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.CreateTaskRequest"
-                        }
+                        "type": "integer",
+                        "description": "ID задачи",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Успешный ответ с ID созданной задачи",
+                        "description": "Манифест архива",
                         "schema": {
-                            "$ref": "#/definitions/handler.CreateTaskResponse"
+                            "$ref": "#/definitions/model.Manifest"
                         }
                     },
                     "400": {
-                        "description": "Неверный формат JSON",
+                        "description": "Некорректный ID задачи",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.ErrorResponse"
                         }
                     },
-                    "503": {
-                        "description": "Ошибка создания задачи",
+                    "404": {
+                        "description": "Задача не найдена",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/get": {
-            "get": {
-                "description": "Возвращает статус задачи и ссылку на архив (если все файлы добавлены).",
+        "/v2/tasks/{id}/uploads": {
+            "post": {
+                "description": "Принимает файлы, которых нет по URL, прямо в теле запроса: multipart/form-data (каждая часть с именем файла - отдельный файл, имя в архиве - имя файла без расширения) или само содержимое файла с его Content-Type (имя в архиве передаётся в параметре fileName). Содержимое не держится в памяти, а сразу сохраняется во временный файл и записывается в архив. Файлы проходят те же проверки, что и скачиваемые по URL: тип определяется по содержимому и должен входить в tasks.allowed_mime_types, каждый файл учитывается в tasks.max_files_per_task, размер ограничен tasks.max_file_size, tasks.max_task_size и tasks.disk_budget. Ответ приходит, когда все файлы прочитаны; если какой-то файл отклонён, запрос завершается ошибкой, а уже загруженные до него файлы остаются в задаче.",
                 "consumes": [
-                    "application/json"
+                    "multipart/form-data",
+                    "application/octet-stream"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "tasks"
+                    "tasks-v2"
                 ],
-                "summary": "Получить статус задачи",
+                "summary": "Загрузить файлы в задачу",
                 "parameters": [
                     {
                         "type": "integer",
                         "description": "ID задачи",
-                        "name": "task-id",
-                        "in": "query",
+                        "name": "id",
+                        "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Имя файла в архиве без расширения (для запроса не multipart/form-data)",
+                        "name": "fileName",
+                        "in": "query"
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "201": {
+                        "description": "Файлы загружены",
                         "schema": {
-                            "$ref": "#/definitions/handler.TaskStatusResponse"
+                            "$ref": "#/definitions/handler.UploadFilesResponse"
                         }
                     },
                     "400": {
-                        "description": "некорректный ID задачи или задача не найдена",
+                        "description": "Нет файлов, не указано имя файла, некорректный multipart или обрыв загрузки",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Задача не найдена",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Задача в очереди, в конечном статусе, в ней уже максимальное количество файлов или файлы заняли tasks.max_task_size",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "413": {
+                        "description": "Файл больше tasks.max_file_size",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "415": {
+                        "description": "Тип файла не входит в tasks.allowed_mime_types",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
+                        }
+                    },
+                    "507": {
+                        "description": "Исчерпано место, отведённое сервису под файлы (tasks.disk_budget)",
+                        "schema": {
+                            "$ref": "#/definitions/handler.ErrorResponse"
                         }
                     }
                 }
@@ -144,6 +898,23 @@ const docTemplate = `{
         "handler.AddFileToTaskRequest": {
             "type": "object",
             "properties": {
+                "basicAuth": {
+                    "$ref": "#/definitions/handler.BasicAuthRequest"
+                },
+                "bearerToken": {
+                    "type": "string",
+                    "example": ""
+                },
+                "cookies": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "credentialProfile": {
+                    "type": "string",
+                    "example": ""
+                },
                 "fileName": {
                     "type": "string",
                     "example": "test3"
@@ -152,6 +923,12 @@ const docTemplate = `{
                     "type": "string",
                     "example": "https://example.com/file.pdf"
                 },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "taskID": {
                     "type": "integer",
                     "example": 1
@@ -161,9 +938,79 @@ const docTemplate = `{
         "handler.AddFileToTaskResponse": {
             "type": "object",
             "properties": {
+                "fileID": {
+                    "type": "integer",
+                    "example": 1
+                },
                 "message": {
                     "type": "string",
-                    "example": "файлы успешно добавлен к вашей задаче"
+                    "example": "файл поставлен в очередь на скачивание"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "pending"
+                },
+                "taskID": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "handler.AddTaskFileRequest": {
+            "type": "object",
+            "properties": {
+                "basicAuth": {
+                    "$ref": "#/definitions/handler.BasicAuthRequest"
+                },
+                "bearerToken": {
+                    "type": "string",
+                    "example": ""
+                },
+                "cookies": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "credentialProfile": {
+                    "type": "string",
+                    "example": ""
+                },
+                "fileName": {
+                    "type": "string",
+                    "example": "test3"
+                },
+                "fileURL": {
+                    "type": "string",
+                    "example": "https://example.com/file.pdf"
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "handler.BasicAuthRequest": {
+            "type": "object",
+            "properties": {
+                "password": {
+                    "type": "string",
+                    "example": ""
+                },
+                "username": {
+                    "type": "string",
+                    "example": "user"
+                }
+            }
+        },
+        "handler.CancelTaskRequest": {
+            "type": "object",
+            "properties": {
+                "keepArchive": {
+                    "type": "boolean",
+                    "example": false
                 },
                 "taskID": {
                     "type": "integer",
@@ -174,13 +1021,21 @@ const docTemplate = `{
         "handler.CreateTaskRequest": {
             "type": "object",
             "properties": {
+                "format": {
+                    "type": "string",
+                    "example": "zip"
+                },
+                "password": {
+                    "type": "string",
+                    "example": ""
+                },
                 "zipArchiveName": {
                     "type": "string",
                     "example": "test1"
                 },
                 "zipArchivePath": {
                     "type": "string",
-                    "example": "G:/GithubRepo/17.07.2025/internal/util"
+                    "example": "reports/2025"
                 }
             }
         },
@@ -191,28 +1046,222 @@ const docTemplate = `{
                     "type": "string",
                     "example": "id вашей задачи: "
                 },
+                "queuePosition": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "statusCode": {
+                    "type": "string",
+                    "example": "created"
+                },
+                "taskID": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "handler.DeleteTaskResponse": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "задача удалена"
+                },
+                "taskID": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "handler.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "задача не найдена"
+                }
+            }
+        },
+        "handler.FinalizeTaskRequest": {
+            "type": "object",
+            "properties": {
                 "taskID": {
                     "type": "integer",
                     "example": 1
                 }
             }
         },
+        "handler.TaskFileStatusItem": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer",
+                    "example": 2
+                },
+                "contentType": {
+                    "type": "string",
+                    "example": "application/pdf"
+                },
+                "credentialProfile": {
+                    "type": "string",
+                    "example": ""
+                },
+                "error": {
+                    "type": "string",
+                    "example": ""
+                },
+                "errorCode": {
+                    "type": "string",
+                    "example": ""
+                },
+                "fileID": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "lastError": {
+                    "type": "string",
+                    "example": ""
+                },
+                "name": {
+                    "type": "string",
+                    "example": "test3.pdf"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "stored"
+                },
+                "stored": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "uploaded": {
+                    "type": "boolean",
+                    "example": false
+                }
+            }
+        },
+        "handler.TaskListResponse": {
+            "type": "object",
+            "properties": {
+                "tasks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.TaskStatusResponse"
+                    }
+                }
+            }
+        },
         "handler.TaskStatusResponse": {
             "type": "object",
             "properties": {
                 "archiveLink": {
                     "type": "string",
-                    "example": "G:/GithubRepo/17.07.2025/internal/util/task_1.zip"
+                    "example": "http://localhost:8080/api-tasks/v2/tasks/1/archive?expires=1752768000\u0026signature=..."
+                },
+                "encrypted": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.TaskFileStatusItem"
+                    }
+                },
+                "format": {
+                    "type": "string",
+                    "example": "zip"
+                },
+                "lastError": {
+                    "type": "string",
+                    "example": ""
+                },
+                "queuePosition": {
+                    "type": "integer",
+                    "example": 0
                 },
                 "status": {
                     "type": "string",
                     "example": "завершена"
                 },
+                "statusCode": {
+                    "type": "string",
+                    "example": "completed"
+                },
+                "taskID": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "handler.UploadFilesResponse": {
+            "type": "object",
+            "properties": {
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.TaskFileStatusItem"
+                    }
+                }
+            }
+        },
+        "model.Manifest": {
+            "type": "object",
+            "properties": {
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.ManifestEntry"
+                    }
+                },
+                "finishedAt": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string",
+                    "example": "zip"
+                },
                 "taskID": {
                     "type": "integer",
                     "example": 1
                 }
             }
+        },
+        "model.ManifestEntry": {
+            "type": "object",
+            "properties": {
+                "archiveName": {
+                    "type": "string",
+                    "example": "file1.pdf"
+                },
+                "contentType": {
+                    "type": "string",
+                    "example": "application/pdf"
+                },
+                "downloadedAt": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "file1"
+                },
+                "originalName": {
+                    "type": "string",
+                    "example": "contract.pdf"
+                },
+                "sha256": {
+                    "type": "string",
+                    "example": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+                },
+                "size": {
+                    "type": "integer",
+                    "example": 102400
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/files/contract.pdf"
+                }
+            }
         }
     }
 }`
@@ -1,11 +1,187 @@
 package config
 
+import "time"
+
 type Config struct {
-	Server ServerConfig `yaml:"server"`
+	Server         ServerConfig         `yaml:"server"`
+	TaskStore      TaskStoreConfig      `yaml:"task_store"`
+	ArchiveStorage ArchiveStorageConfig `yaml:"archive_storage"`
+	Tasks          TasksConfig          `yaml:"tasks"`
+	Download       DownloadConfig       `yaml:"download"`
 }
 
+// ServerConfig - настройки HTTP-сервера.
+// PublicURL - внешний адрес сервера для ссылок на скачивание архивов (например, "https://files.example.com");
+// если не задан, адрес берётся из запроса клиента
+// TrustProxy - сервер работает за обратным прокси, и схеме из заголовка X-Forwarded-Proto можно доверять
+// при построении ссылок без PublicURL; без прокси заголовок может подставить любой клиент
+// LinkSecret - ключ HMAC-подписи ссылок на архивы; если не задан, при запуске генерируется случайный
+// LinkTTL - срок действия ссылки на архив (например, "15m")
+// AdminAddress - адрес отдельного служебного сервера с метриками /debug/vars (например, "127.0.0.1:8081");
+// если не задан, метрики не публикуются: в них есть командная строка процесса и внутренние счётчики
 type ServerConfig struct {
-	Host     string `yaml:"host"`
-	Port     string `yaml:"port"`
-	BasePath string `yaml:"base_path"`
+	Host         string        `yaml:"host"`
+	Port         string        `yaml:"port"`
+	BasePath     string        `yaml:"base_path"`
+	PublicURL    string        `yaml:"public_url"`
+	TrustProxy   bool          `yaml:"trust_proxy"`
+	LinkSecret   string        `yaml:"link_secret"`
+	LinkTTL      time.Duration `yaml:"link_ttl"`
+	AdminAddress string        `yaml:"admin_address"`
+}
+
+// TaskStoreConfig - настройки хранилища задач.
+// Type - "memory" (по умолчанию) или "journal"
+// JournalPath - путь до файла журнала, используется только при Type = "journal"
+type TaskStoreConfig struct {
+	Type        string `yaml:"type"`
+	JournalPath string `yaml:"journal_path"`
+}
+
+// ArchiveStorageConfig - настройки хранилища архивов.
+// Type - "local" (по умолчанию), "s3" или "memory"
+// Root - корневой каталог архивов, используется только при Type = "local";
+// пути архивов из запросов задаются относительно него
+// S3 - параметры S3-совместимого хранилища, используются только при Type = "s3"
+type ArchiveStorageConfig struct {
+	Type string   `yaml:"type"`
+	Root string   `yaml:"root"`
+	S3   S3Config `yaml:"s3"`
+}
+
+// S3Config - параметры S3-совместимого хранилища архивов (AWS S3, MinIO и т.п.).
+// Endpoint - адрес сервера, например "http://localhost:9000"
+// Region - регион для подписи запросов (по умолчанию "us-east-1")
+// Bucket - бакет, в котором хранятся архивы
+// AccessKey, SecretKey - ключи доступа
+// Prefix - префикс ключей архивов внутри бакета, например "archives/"
+// PartSize - размер части при multipart upload в байтах (по умолчанию 5 МиБ, меньше S3 не допускает)
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	Prefix    string `yaml:"prefix"`
+	PartSize  int    `yaml:"part_size"`
+}
+
+// TasksConfig - настройки жизненного цикла задач.
+// CompletedRetention, FailedRetention, CancelledRetention - сколько задача в статусе "завершена", "ошибка"
+// или "отменена" хранится вместе с архивом, прежде чем будет удалена (например, "24h"; 0 - не удалять)
+// JanitorInterval - как часто проверяются сроки хранения задач
+// MaxActiveTasks - максимальное количество одновременно активных задач
+// MaxFilesPerTask - максимальное количество файлов в одной задаче
+// DownloadConcurrency - сколько файлов одной задачи может скачиваться одновременно
+// AllowedMIMETypes - допустимые типы файлов, определяемые по содержимому (сигнатуре) и заголовку Content-Type
+// DownloadWorkers - сколько файлов (всех задач вместе) скачивается одновременно
+// DownloadQueueSize - сколько файлов может ожидать скачивания
+// MaxFileSize, MaxTaskSize - максимальный размер одного файла и всех файлов задачи в байтах
+// DiskBudget - сколько байт могут занимать файлы всех задач (во временных файлах и неудалённых архивах)
+// Для MaxFileSize, MaxTaskSize и DiskBudget отрицательное значение отключает лимит.
+// SpoolDir - каталог для временных файлов, в которые файлы скачиваются до записи в архив
+// CollisionPolicy - что делать, если архив с запрошенным именем уже существует: "reject" (по умолчанию),
+// "suffix" или "overwrite"
+// CompressionLevels - уровни сжатия по форматам архивов ("zip", "tar.gz", "tar.zst"),
+// для незаданных форматов используется уровень по умолчанию
+// WriteChecksums - записывать ли в архив, кроме манифеста manifest.json, файл контрольных сумм SHA256SUMS
+// BusyPolicy - что делать с новой задачей, когда заняты все слоты: "reject" (по умолчанию, ответ 503)
+// или "queue" (поставить в очередь ожидания)
+// QueueSize - максимальное количество задач в очереди ожидания
+//
+// Незаданные лимиты берутся из service.DefaultTaskLimits.
+type TasksConfig struct {
+	MaxActiveTasks      int            `yaml:"max_active_tasks"`
+	MaxFilesPerTask     int            `yaml:"max_files_per_task"`
+	DownloadConcurrency int            `yaml:"download_concurrency"`
+	AllowedMIMETypes    []string       `yaml:"allowed_mime_types"`
+	DownloadWorkers     int            `yaml:"download_workers"`
+	DownloadQueueSize   int            `yaml:"download_queue_size"`
+	MaxFileSize         int64          `yaml:"max_file_size"`
+	MaxTaskSize         int64          `yaml:"max_task_size"`
+	DiskBudget          int64          `yaml:"disk_budget"`
+	SpoolDir            string         `yaml:"spool_dir"`
+	CollisionPolicy     string         `yaml:"collision_policy"`
+	CompressionLevels   map[string]int `yaml:"compression_levels"`
+	WriteChecksums      bool           `yaml:"write_checksums"`
+	BusyPolicy          string         `yaml:"busy_policy"`
+	QueueSize           int            `yaml:"queue_size"`
+
+	CompletedRetention time.Duration `yaml:"completed_retention"`
+	FailedRetention    time.Duration `yaml:"failed_retention"`
+	CancelledRetention time.Duration `yaml:"cancelled_retention"`
+	JanitorInterval    time.Duration `yaml:"janitor_interval"`
+}
+
+// DownloadConfig - таймауты и повторы скачивания файлов по URL (0 - значение по умолчанию).
+// ConnectTimeout - таймаут установки соединения вместе с TLS-рукопожатием (по умолчанию 10s)
+// HeaderTimeout - сколько ждать заголовков ответа (по умолчанию 30s)
+// IdleTimeout - сколько ждать очередной порции данных, прежде чем считать соединение зависшим (по умолчанию 30s)
+// MaxAttempts - максимальное количество попыток скачать файл, 1 - без повторов (по умолчанию 3)
+// RetryBaseDelay, RetryMaxDelay - начальная и максимальная пауза между попытками (по умолчанию 500ms и 30s);
+// пауза удваивается с каждой попыткой, а если сервер просит в Retry-After ждать дольше RetryMaxDelay,
+// файл сразу завершается ошибкой
+// URLPolicy - какие адреса можно скачивать (защита от SSRF)
+// MaxConnsPerHost - сколько соединений можно одновременно держать с одним хостом
+// (по умолчанию 8, отрицательное значение снимает ограничение)
+// MaxIdleConnsPerHost - сколько свободных соединений с хостом держать для повторного использования
+// (по умолчанию max_conns_per_host)
+// IdleConnTimeout - через сколько закрывать неиспользуемое соединение (по умолчанию 90s)
+// RateLimit - ограничения частоты запросов (по умолчанию без ограничений)
+// CredentialProfiles - именованные учётные данные для серверов с авторизацией, на которые можно сослаться
+// при добавлении файла (credentialProfile), чтобы секреты не передавались в запросах
+type DownloadConfig struct {
+	ConnectTimeout time.Duration   `yaml:"connect_timeout"`
+	HeaderTimeout  time.Duration   `yaml:"header_timeout"`
+	IdleTimeout    time.Duration   `yaml:"idle_timeout"`
+	MaxAttempts    int             `yaml:"max_attempts"`
+	RetryBaseDelay time.Duration   `yaml:"retry_base_delay"`
+	RetryMaxDelay  time.Duration   `yaml:"retry_max_delay"`
+	URLPolicy      URLPolicyConfig `yaml:"url_policy"`
+
+	MaxConnsPerHost     int             `yaml:"max_conns_per_host"`
+	MaxIdleConnsPerHost int             `yaml:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration   `yaml:"idle_conn_timeout"`
+	RateLimit           RateLimitConfig `yaml:"rate_limit"`
+
+	CredentialProfiles map[string]CredentialProfileConfig `yaml:"credential_profiles"`
+}
+
+// CredentialProfileConfig - учётные данные для скачивания файлов с сервера, требующего авторизации.
+// Headers - дополнительные заголовки запроса, например X-Api-Key
+// BearerToken - токен для заголовка "Authorization: Bearer ..."
+// Username, Password - логин и пароль для Basic-авторизации
+// Cookies - cookie запроса (имя - значение)
+type CredentialProfileConfig struct {
+	Headers     map[string]string `yaml:"headers"`
+	BearerToken string            `yaml:"bearer_token"`
+	Username    string            `yaml:"username"`
+	Password    string            `yaml:"password"`
+	Cookies     map[string]string `yaml:"cookies"`
+}
+
+// RateLimitConfig - ограничения частоты исходящих запросов за файлами (token bucket).
+// HostRate, HostBurst - запросов в секунду к одному хосту и сколько запросов можно отправить ему разом
+// GlobalRate, GlobalBurst - то же для всех хостов вместе
+// Нулевая частота - без ограничения, незаданный запас - частота, округлённая вверх.
+type RateLimitConfig struct {
+	HostRate    float64 `yaml:"host_rate"`
+	HostBurst   int     `yaml:"host_burst"`
+	GlobalRate  float64 `yaml:"global_rate"`
+	GlobalBurst int     `yaml:"global_burst"`
+}
+
+// URLPolicyConfig - политика исходящих запросов за файлами.
+// AllowedSchemes - допустимые схемы адресов (по умолчанию http и https)
+// AllowedHosts - если не пуст, файлы скачиваются только с этих хостов ("files.example.com" или "*.example.com")
+// DeniedHosts - хосты, с которых файлы не скачиваются
+// AllowedNetworks - диапазоны CIDR, доступные несмотря на запрет внутренних адресов (loopback, частные сети,
+// link-local и т.д.), например "10.1.2.0/24"
+// MaxRedirects - максимальное количество перенаправлений (по умолчанию 5, отрицательное значение запрещает их)
+type URLPolicyConfig struct {
+	AllowedSchemes  []string `yaml:"allowed_schemes"`
+	AllowedHosts    []string `yaml:"allowed_hosts"`
+	DeniedHosts     []string `yaml:"denied_hosts"`
+	AllowedNetworks []string `yaml:"allowed_networks"`
+	MaxRedirects    int      `yaml:"max_redirects"`
 }
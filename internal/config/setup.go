@@ -1,10 +1,17 @@
 package config
 
 import (
+	"expvar"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"net/http"
+	"workmate_test_project/internal/storage"
+	"workmate_test_project/internal/store"
 )
 
+// defaultArchiveRoot - корневой каталог локального хранилища архивов по умолчанию.
+const defaultArchiveRoot = "./data/archives"
+
 func SetupServer(serverAddress string) (*http.Server, *chi.Mux) {
 	router := chi.NewRouter()
 	server := &http.Server{
@@ -14,3 +21,60 @@ func SetupServer(serverAddress string) (*http.Server, *chi.Mux) {
 
 	return server, router
 }
+
+// SetupAdminServer создаёт служебный сервер с метриками expvar (/debug/vars) на адресе adminAddress,
+// отдельном от API. Если адрес не задан, возвращается nil: метрики не публикуются.
+func SetupAdminServer(adminAddress string) *http.Server {
+	if adminAddress == "" {
+		return nil
+	}
+
+	router := chi.NewRouter()
+	router.Handle("/debug/vars", expvar.Handler())
+
+	return &http.Server{
+		Addr:    adminAddress,
+		Handler: router,
+	}
+}
+
+// SetupTaskStore создаёт хранилище задач в соответствии с конфигурацией.
+func SetupTaskStore(cfg TaskStoreConfig) (store.TaskStore, error) {
+	switch cfg.Type {
+	case "", "memory":
+		return store.NewMemoryStore(), nil
+	case "journal":
+		if cfg.JournalPath == "" {
+			return nil, fmt.Errorf("не указан journal_path для хранилища задач")
+		}
+		return store.OpenJournalStore(cfg.JournalPath)
+	default:
+		return nil, fmt.Errorf("неизвестный тип хранилища задач: %s", cfg.Type)
+	}
+}
+
+// SetupArchiveStorage создаёт хранилище архивов в соответствии с конфигурацией.
+func SetupArchiveStorage(cfg ArchiveStorageConfig) (storage.ArchiveStorage, error) {
+	switch cfg.Type {
+	case "", "local":
+		root := cfg.Root
+		if root == "" {
+			root = defaultArchiveRoot
+		}
+		return storage.NewLocalStorage(root)
+	case "s3":
+		return storage.NewS3Storage(storage.S3Options{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			Prefix:    cfg.S3.Prefix,
+			PartSize:  cfg.S3.PartSize,
+		})
+	case "memory":
+		return storage.NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("неизвестный тип хранилища архивов: %s", cfg.Type)
+	}
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/service"
+	"workmate_test_project/internal/store"
+)
+
+// archiveEncryption - значение заголовка X-Archive-Encryption для зашифрованных архивов.
+const archiveEncryption = "winzip-aes-256"
+
+// defaultArchiveLinkTTL - срок действия ссылки на архив, если он не задан в конфигурации.
+const defaultArchiveLinkTTL = 15 * time.Minute
+
+var (
+	errArchiveLinkInvalid = errors.New("ссылка на архив недействительна: неверная подпись")
+	errArchiveLinkExpired = errors.New("срок действия ссылки на архив истёк")
+)
+
+// ArchiveLinks формирует подписанные ссылки на скачивание архивов задач
+// (GET {basePath}/v2/tasks/{id}/archive?expires=...&signature=...) и проверяет их.
+// Подпись - HMAC-SHA256 от ID задачи, времени её создания и времени истечения ссылки, поэтому ссылку нельзя
+// ни переадресовать на другую задачу, ни продлить. Время создания нужно, потому что ID удалённой задачи
+// может после перезапуска достаться новой: ссылка на архив удалённой задачи к ней не подходит.
+type ArchiveLinks struct {
+	publicURL  string
+	trustProxy bool
+	basePath   string
+	secret     []byte
+	ttl        time.Duration
+}
+
+// NewArchiveLinks создаёт генератор ссылок на архивы.
+// publicURL - внешний адрес сервера (например, "https://files.example.com"); если он не задан,
+// адрес берётся из запроса (заголовок Host и схема соединения).
+// trustProxy - схема берётся из заголовка X-Forwarded-Proto, который выставляет обратный прокси;
+// без прокси заголовок игнорируется, так как его может подставить любой клиент.
+// basePath - базовый путь API из конфигурации.
+// secret - ключ подписи; если он пуст, генерируется случайный ключ, и выданные ссылки перестают
+// действовать после перезапуска сервера.
+// ttl - срок действия ссылки (по умолчанию defaultArchiveLinkTTL).
+func NewArchiveLinks(publicURL string, trustProxy bool, basePath string, secret string, ttl time.Duration) ArchiveLinks {
+	links := ArchiveLinks{
+		publicURL:  strings.TrimSuffix(publicURL, "/"),
+		trustProxy: trustProxy,
+		basePath:   strings.TrimSuffix(basePath, "/"),
+		secret:     []byte(secret),
+		ttl:        ttl,
+	}
+
+	if len(links.secret) == 0 {
+		links.secret = make([]byte, 32)
+		rand.Read(links.secret)
+		log.Println("ключ подписи ссылок на архивы не задан, сгенерирован случайный: ссылки не переживут перезапуск")
+	}
+	if links.ttl <= 0 {
+		links.ttl = defaultArchiveLinkTTL
+	}
+
+	return links
+}
+
+// archiveURL возвращает новую подписанную ссылку на скачивание архива задачи task,
+// действующую links.ttl с текущего момента.
+func (links ArchiveLinks) archiveURL(request *http.Request, task *model.Task) string {
+	baseURL := links.publicURL
+	if baseURL == "" {
+		scheme := "http"
+		if request.TLS != nil {
+			scheme = "https"
+		}
+		forwardedProto := request.Header.Get("X-Forwarded-Proto")
+		if links.trustProxy && (forwardedProto == "http" || forwardedProto == "https") {
+			scheme = forwardedProto
+		}
+		baseURL = scheme + "://" + request.Host
+	}
+
+	expires := time.Now().Add(links.ttl).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", links.sign(task, expires))
+
+	return fmt.Sprintf("%s%s/v2/tasks/%d/archive?%s", baseURL, links.basePath, task.ID, query.Encode())
+}
+
+// sign возвращает подпись ссылки на архив задачи task, действующей до момента expires (Unix-время).
+func (links ArchiveLinks) sign(task *model.Task, expires int64) string {
+	mac := hmac.New(sha256.New, links.secret)
+	fmt.Fprintf(mac, "%d:%d:%d", task.ID, task.CreatedAt.UnixNano(), expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify проверяет подпись и срок действия ссылки на архив задачи task по параметрам запроса.
+// Подпись проверяется до срока действия, чтобы подделанная ссылка не выдавалась за просроченную.
+func (links ArchiveLinks) verify(task *model.Task, query url.Values, now time.Time) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return errArchiveLinkInvalid
+	}
+
+	signature := query.Get("signature")
+	if hmac.Equal([]byte(signature), []byte(links.sign(task, expires))) == false {
+		return errArchiveLinkInvalid
+	}
+
+	if now.Unix() > expires {
+		return errArchiveLinkExpired
+	}
+
+	return nil
+}
+
+// DownloadArchive отдаёт архив завершённой задачи.
+//
+// @Summary      Скачать архив задачи
+// @Description  Отдаёт архив завершённой задачи (zip, tar, tar.gz или tar.zst, Content-Type соответствует формату) по подписанной ссылке из archiveLink. Поддерживаются запросы части файла (заголовок Range) и условные запросы по ETag (If-None-Match, If-Range). Архив отдаётся как есть: если он зашифрован, в ответе есть заголовок X-Archive-Encryption, а файлы распаковываются паролем, заданным при создании задачи.
+// @Tags         tasks-v2
+// @Produce      application/zip
+// @Produce      application/x-tar
+// @Produce      application/gzip
+// @Produce      application/zstd
+// @Param        id path int true "ID задачи"
+// @Param        expires query int true "Время истечения ссылки (Unix-время)"
+// @Param        signature query string true "Подпись ссылки"
+// @Param        Range header string false "Диапазон байт, например bytes=0-1023"
+// @Success      200 {file} file "Архив задачи"
+// @Header       200,206 {string} X-Archive-Encryption "Способ шифрования архива (winzip-aes-256), только для зашифрованных архивов"
+// @Success      206 {file} file "Часть архива"
+// @Failure      400 {object} ErrorResponse "Некорректный ID задачи"
+// @Failure      403 {object} ErrorResponse "Неверная подпись, истёк срок действия ссылки или задача не найдена"
+// @Failure      404 {object} ErrorResponse "Архив задачи не найден"
+// @Failure      409 {object} ErrorResponse "Задача ещё не завершена"
+// @Failure      500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router       /v2/tasks/{id}/archive [get]
+func (handler *TaskHandlerV2) DownloadArchive(writer http.ResponseWriter, request *http.Request) {
+	taskId, ok := pathID(writer, request, "id")
+	if ok == false {
+		return
+	}
+
+	// подпись проверяется по задаче, поэтому задача ищется до проверки; чтобы по ответу нельзя было
+	// узнать, есть ли задача, на ссылку на несуществующую задачу отвечаем так же, как на неверную подпись
+	task, err := handler.TaskService.GetTaskSnapshot(request.Context(), taskId)
+	if err == nil {
+		err = handler.links.verify(&task, request.URL.Query(), time.Now())
+	} else if errors.Is(err, store.ErrTaskNotFound) {
+		err = errArchiveLinkInvalid
+	}
+	if errors.Is(err, errArchiveLinkInvalid) || errors.Is(err, errArchiveLinkExpired) {
+		writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		writeServiceError(writer, err)
+		return
+	}
+
+	// тайм-аута нет: контекст действует и на чтение архива из хранилища, а скачивание большого архива может идти долго
+	archive, task, err := handler.TaskService.OpenArchive(request.Context(), taskId)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrArchiveNotReady):
+			writeError(writer, http.StatusConflict, "задача ещё не завершена, архив не готов")
+		case errors.Is(err, service.ErrArchiveNotFound):
+			log.Printf("ошибка скачивания архива: %v", err)
+			writeError(writer, http.StatusNotFound, "архив задачи не найден")
+		default:
+			writeServiceError(writer, err)
+		}
+		return
+	}
+	defer archive.Close()
+
+	info := archive.Info()
+	name := path.Base(task.ArchiveLink)
+	writer.Header().Set("Content-Type", task.Format.ContentType())
+	writer.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if task.Encrypted {
+		writer.Header().Set("X-Archive-Encryption", archiveEncryption)
+	}
+	// архив завершённой задачи больше не меняется, поэтому размера и времени изменения достаточно для ETag
+	writer.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size, info.ModTime.UnixNano()))
+
+	// ServeContent выставляет Content-Length, обрабатывает Range, If-Range и If-None-Match
+	http.ServeContent(writer, request, name, info.ModTime, archive)
+}
@@ -0,0 +1,535 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/service"
+	"workmate_test_project/internal/store"
+	"workmate_test_project/internal/util"
+)
+
+// TaskHandlerV2 - обработчики ресурсного API v2 (/v2/tasks, /v2/tasks/{id}, /v2/tasks/{id}/files,
+// /v2/tasks/{id}/uploads, /v2/tasks/{id}/archive).
+// Использует тот же TaskService, что и TaskHandler (v1), поэтому задачи, созданные через одну версию API,
+// доступны и через другую.
+type TaskHandlerV2 struct {
+	*service.TaskService
+	links ArchiveLinks
+}
+
+// ErrorResponse - тело ответа с ошибкой в API v2.
+type ErrorResponse struct {
+	Error string `json:"error" example:"задача не найдена"`
+}
+
+// TaskListResponse - список задач.
+type TaskListResponse struct {
+	Tasks []TaskStatusResponse `json:"tasks"`
+}
+
+// UploadFilesResponse - файлы, загруженные в задачу одним запросом, в порядке их следования в запросе.
+type UploadFilesResponse struct {
+	Files []TaskFileStatusItem `json:"files"`
+}
+
+// AddTaskFileRequest содержит параметры файла, добавляемого к задаче через API v2.
+// Авторизация на сервере с файлом задаётся так же, как в API v1 (см. FileAuthRequest).
+type AddTaskFileRequest struct {
+	FileURL  string `json:"fileURL" example:"https://example.com/file.pdf"`
+	FileName string `json:"fileName" example:"test3"`
+	FileAuthRequest
+}
+
+func NewTaskHandlerV2(taskService *service.TaskService, links ArchiveLinks) *TaskHandlerV2 {
+	return &TaskHandlerV2{TaskService: taskService, links: links}
+}
+
+// CreateTask создаёт новую задачу.
+//
+// @Summary      Создать задачу
+// @Description  Создаёт задачу и возвращает её состояние, адрес задачи передаётся в заголовке Location. Если все слоты активных задач заняты и tasks.busy_policy = queue, задача ставится в очередь ожидания (ответ 202).
+// @Tags         tasks-v2
+// @Accept       json
+// @Produce      json
+// @Param        request body CreateTaskRequest true "Путь, имя и формат архива"
+// @Success      201 {object} TaskStatusResponse "Задача создана"
+// @Success      202 {object} TaskStatusResponse "Задача поставлена в очередь ожидания"
+// @Failure      400 {object} ErrorResponse "Неверный формат JSON, неподдерживаемый формат архива или путь архива вне корневого каталога архивов"
+// @Failure      409 {object} ErrorResponse "Архив с таким именем уже существует"
+// @Failure      429 {object} ErrorResponse "Достигнут лимит активных задач или очередь ожидания заполнена"
+// @Failure      500 {object} ErrorResponse "Ошибка создания задачи"
+// @Router       /v2/tasks [post]
+func (handler *TaskHandlerV2) CreateTask(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
+	defer cancel()
+
+	var createTaskRequest CreateTaskRequest
+	if err := json.NewDecoder(request.Body).Decode(&createTaskRequest); err != nil {
+		writeError(writer, http.StatusBadRequest, "неверный формат json")
+		return
+	}
+
+	task, err := handler.TaskService.CreateTask(ctx, createTaskRequest.ZipArchivePath, createTaskRequest.ZipArchiveName,
+		util.ArchiveFormat(createTaskRequest.Format), createTaskRequest.Password)
+	if errors.Is(err, service.ErrServerBusy) {
+		log.Printf("ошибка создания задачи: %v", err)
+		writeError(writer, http.StatusTooManyRequests, fmt.Sprintf(
+			"сервер в данный момент занят, максимальное количество активных задач: %d",
+			handler.TaskService.Limits().MaxActiveTasks))
+		return
+	}
+	if errors.Is(err, service.ErrQueueFull) {
+		log.Printf("ошибка создания задачи: %v", err)
+		writeError(writer, http.StatusTooManyRequests, fmt.Sprintf(
+			"сервер в данный момент занят, очередь задач заполнена (%d)", handler.TaskService.QueueSize()))
+		return
+	}
+	if errors.Is(err, service.ErrInvalidArchivePath) || errors.Is(err, service.ErrArchiveExists) ||
+		errors.Is(err, util.ErrUnsupportedArchiveFormat) {
+		writeServiceError(writer, err)
+		return
+	}
+	if err != nil {
+		log.Printf("ошибка создания задачи: %v", err)
+		writeError(writer, http.StatusInternalServerError, "ошибка создания задачи")
+		return
+	}
+
+	response, err := handler.taskResponse(ctx, request, task.ID)
+	if err != nil {
+		log.Printf("ошибка получения задачи: %v", err)
+		writeError(writer, http.StatusInternalServerError, "ошибка создания задачи")
+		return
+	}
+
+	statusCode := http.StatusCreated
+	if response.QueuePosition > 0 {
+		statusCode = http.StatusAccepted
+	}
+	writer.Header().Set("Location", strings.TrimSuffix(request.URL.Path, "/")+"/"+strconv.Itoa(task.ID))
+	writeJSON(writer, statusCode, response)
+}
+
+// ListTasks возвращает список задач.
+//
+// @Summary      Список задач
+// @Description  Возвращает все задачи, отсортированные по ID. Параметр status оставляет только задачи в указанном статусе.
+// @Tags         tasks-v2
+// @Produce      json
+// @Param        status query string false "Код статуса задачи" Enums(queued, created, running, completed, failed, cancelled)
+// @Success      200 {object} TaskListResponse "Список задач"
+// @Failure      400 {object} ErrorResponse "Неизвестный статус"
+// @Failure      500 {object} ErrorResponse "Ошибка загрузки задач"
+// @Router       /v2/tasks [get]
+func (handler *TaskHandlerV2) ListTasks(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
+	defer cancel()
+
+	var status model.TaskStatus
+	if statusParam := request.URL.Query().Get("status"); statusParam != "" {
+		if err := status.UnmarshalText([]byte(statusParam)); err != nil {
+			writeError(writer, http.StatusBadRequest, fmt.Sprintf("неизвестный статус задачи: %s", statusParam))
+			return
+		}
+	}
+
+	tasks, err := handler.TaskService.ListTasks(ctx, status)
+	if err != nil {
+		log.Printf("ошибка загрузки задач: %v", err)
+		writeError(writer, http.StatusInternalServerError, "ошибка загрузки задач")
+		return
+	}
+
+	response := TaskListResponse{Tasks: make([]TaskStatusResponse, 0, len(tasks))}
+	for i := range tasks {
+		item := newTaskStatusResponse(&tasks[i], handler.links.archiveURL(request, &tasks[i]))
+		item.QueuePosition = handler.TaskService.QueuePosition(tasks[i].ID)
+		response.Tasks = append(response.Tasks, *item)
+	}
+
+	writeJSON(writer, http.StatusOK, response)
+}
+
+// GetTask возвращает задачу по её ID.
+//
+// @Summary      Получить задачу
+// @Description  Возвращает статус задачи, состояние её файлов и ссылку на архив (если задача завершена).
+// @Tags         tasks-v2
+// @Produce      json
+// @Param        id path int true "ID задачи"
+// @Success      200 {object} TaskStatusResponse "Задача"
+// @Failure      400 {object} ErrorResponse "Некорректный ID задачи"
+// @Failure      404 {object} ErrorResponse "Задача не найдена"
+// @Failure      500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router       /v2/tasks/{id} [get]
+func (handler *TaskHandlerV2) GetTask(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
+	defer cancel()
+
+	taskId, ok := pathID(writer, request, "id")
+	if ok == false {
+		return
+	}
+
+	response, err := handler.taskResponse(ctx, request, taskId)
+	if err != nil {
+		writeServiceError(writer, err)
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, response)
+}
+
+// DeleteTask удаляет задачу по её ID.
+//
+// @Summary      Удалить задачу
+// @Description  Удаляет задачу и её архив. Незавершённая задача перед удалением отменяется.
+// @Tags         tasks-v2
+// @Param        id path int true "ID задачи"
+// @Param        keep-archive query bool false "Не удалять архив с диска"
+// @Success      204 "Задача удалена"
+// @Failure      400 {object} ErrorResponse "Некорректный ID задачи"
+// @Failure      404 {object} ErrorResponse "Задача не найдена"
+// @Failure      500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router       /v2/tasks/{id} [delete]
+func (handler *TaskHandlerV2) DeleteTask(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
+	defer cancel()
+
+	taskId, ok := pathID(writer, request, "id")
+	if ok == false {
+		return
+	}
+	keepArchive := request.URL.Query().Get("keep-archive") == "true"
+
+	if err := handler.TaskService.DeleteTask(ctx, taskId, keepArchive); err != nil {
+		log.Printf("ошибка удаления задачи: %v", err)
+		writeServiceError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// AddFile ставит файл в очередь скачивания в архив задачи.
+//
+// @Summary      Добавить файл к задаче
+// @Description  Ставит файл в очередь скачивания и сразу возвращает его состояние, адрес файла передаётся в заголовке Location. Тип файла определяется по его содержимому и заголовку Content-Type ответа, а не по расширению в URL, и должен входить в tasks.allowed_mime_types; от типа зависит расширение файла в архиве. Количество файлов в задаче задаётся параметром tasks.max_files_per_task конфигурации. Размер файла ограничен tasks.max_file_size, файлов задачи вместе - tasks.max_task_size, файлов всех задач - tasks.disk_budget; файл, превысивший лимит по Content-Length или при скачивании, получает статус failed и код ошибки errorCode. Адреса проверяются политикой исходящих запросов download.url_policy: внутренние адреса (loopback, частные сети, link-local, 169.254.169.254) запрещены, в том числе после разрешения имени хоста и при перенаправлениях. Для сервера с авторизацией можно передать заголовки, bearer-токен, логин и пароль Basic или cookie либо сослаться на профиль download.credential_profiles; учётные данные не сохраняются, не логируются и не попадают в статус и манифест, а на другой хост при перенаправлении не передаются.
+// @Tags         tasks-v2
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "ID задачи"
+// @Param        request body AddTaskFileRequest true "URL, имя файла и авторизация на сервере с файлом"
+// @Success      202 {object} TaskFileStatusItem "Файл поставлен в очередь скачивания"
+// @Failure      400 {object} ErrorResponse "Неверный формат JSON, некорректный URL файла, адрес, запрещённый политикой исходящих запросов, некорректные учётные данные или неизвестный профиль"
+// @Failure      404 {object} ErrorResponse "Задача не найдена"
+// @Failure      409 {object} ErrorResponse "Задача в очереди, в конечном статусе, в ней уже максимальное количество файлов или файлы заняли tasks.max_task_size"
+// @Failure      429 {object} ErrorResponse "Очередь скачивания файлов заполнена"
+// @Failure      500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Failure      507 {object} ErrorResponse "Исчерпано место, отведённое сервису под файлы (tasks.disk_budget)"
+// @Router       /v2/tasks/{id}/files [post]
+func (handler *TaskHandlerV2) AddFile(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
+	defer cancel()
+
+	taskId, ok := pathID(writer, request, "id")
+	if ok == false {
+		return
+	}
+
+	var addFileRequest AddTaskFileRequest
+	if err := json.NewDecoder(request.Body).Decode(&addFileRequest); err != nil {
+		writeError(writer, http.StatusBadRequest, "неверный формат json")
+		return
+	}
+
+	fileId, err := handler.TaskService.AddFileToTaskWithAuth(ctx, taskId, addFileRequest.FileURL, addFileRequest.FileName,
+		addFileRequest.fileAuth())
+	if err != nil {
+		log.Printf("ошибка добавления файла к задаче: %v", err)
+		writeServiceError(writer, err)
+		return
+	}
+
+	file, err := handler.TaskService.GetTaskFile(ctx, taskId, fileId)
+	if err != nil {
+		writeServiceError(writer, err)
+		return
+	}
+
+	writer.Header().Set("Location", strings.TrimSuffix(request.URL.Path, "/")+"/"+strconv.Itoa(fileId))
+	writeJSON(writer, http.StatusAccepted, newTaskFileStatusItem(file))
+}
+
+// UploadFiles загружает в архив задачи файлы из тела запроса.
+//
+// @Summary      Загрузить файлы в задачу
+// @Description  Принимает файлы, которых нет по URL, прямо в теле запроса: multipart/form-data (каждая часть с именем файла - отдельный файл, имя в архиве - имя файла без расширения) или само содержимое файла с его Content-Type (имя в архиве передаётся в параметре fileName). Содержимое не держится в памяти, а сразу сохраняется во временный файл и записывается в архив. Файлы проходят те же проверки, что и скачиваемые по URL: тип определяется по содержимому и должен входить в tasks.allowed_mime_types, каждый файл учитывается в tasks.max_files_per_task, размер ограничен tasks.max_file_size, tasks.max_task_size и tasks.disk_budget. Ответ приходит, когда все файлы прочитаны; если какой-то файл отклонён, запрос завершается ошибкой, а уже загруженные до него файлы остаются в задаче.
+// @Tags         tasks-v2
+// @Accept       multipart/form-data
+// @Accept       application/octet-stream
+// @Produce      json
+// @Param        id path int true "ID задачи"
+// @Param        fileName query string false "Имя файла в архиве без расширения (для запроса не multipart/form-data)"
+// @Success      201 {object} UploadFilesResponse "Файлы загружены"
+// @Failure      400 {object} ErrorResponse "Нет файлов, не указано имя файла, некорректный multipart или обрыв загрузки"
+// @Failure      404 {object} ErrorResponse "Задача не найдена"
+// @Failure      409 {object} ErrorResponse "Задача в очереди, в конечном статусе, в ней уже максимальное количество файлов или файлы заняли tasks.max_task_size"
+// @Failure      413 {object} ErrorResponse "Файл больше tasks.max_file_size"
+// @Failure      415 {object} ErrorResponse "Тип файла не входит в tasks.allowed_mime_types"
+// @Failure      500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Failure      507 {object} ErrorResponse "Исчерпано место, отведённое сервису под файлы (tasks.disk_budget)"
+// @Router       /v2/tasks/{id}/uploads [post]
+func (handler *TaskHandlerV2) UploadFiles(writer http.ResponseWriter, request *http.Request) {
+	// загрузка большого файла может идти дольше тайм-аута остальных запросов, поэтому он не задаётся
+	ctx := request.Context()
+
+	taskId, ok := pathID(writer, request, "id")
+	if ok == false {
+		return
+	}
+
+	// заблокированное чтение тела прерывается дедлайном, если задачу отменили во время загрузки
+	controller := http.NewResponseController(writer)
+	interrupt := func() {
+		controller.SetReadDeadline(time.Now())
+	}
+
+	response := UploadFilesResponse{Files: []TaskFileStatusItem{}}
+	upload := func(fileUpload service.FileUpload) bool {
+		fileUpload.Interrupt = interrupt
+		fileId, err := handler.TaskService.UploadFileToTask(ctx, taskId, fileUpload)
+		if err != nil {
+			log.Printf("ошибка загрузки файла в задачу %d: %v", taskId, err)
+			writeServiceError(writer, err)
+			return false
+		}
+		file, err := handler.TaskService.GetTaskFile(ctx, taskId, fileId)
+		if err != nil {
+			writeServiceError(writer, err)
+			return false
+		}
+		response.Files = append(response.Files, newTaskFileStatusItem(file))
+		return true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		fileName := request.URL.Query().Get("fileName")
+		if fileName == "" {
+			writeError(writer, http.StatusBadRequest, "не указано имя файла (параметр fileName)")
+			return
+		}
+		fileUpload := service.FileUpload{
+			Name:        fileName,
+			ContentType: request.Header.Get("Content-Type"),
+			Size:        request.ContentLength,
+			Body:        request.Body,
+		}
+		if upload(fileUpload) == false {
+			return
+		}
+		writer.Header().Set("Location", strings.TrimSuffix(request.URL.Path, "/uploads")+
+			"/files/"+strconv.Itoa(response.Files[0].FileID))
+		writeJSON(writer, http.StatusCreated, response)
+		return
+	}
+
+	reader, err := request.MultipartReader()
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("некорректный multipart/form-data: %v", err))
+		return
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, fmt.Sprintf("некорректный multipart/form-data: %v", err))
+			return
+		}
+
+		// части без имени файла - обычные поля формы, они пропускаются
+		originalName := part.FileName()
+		if originalName == "" {
+			part.Close()
+			continue
+		}
+		fileUpload := service.FileUpload{
+			Name:         strings.TrimSuffix(originalName, path.Ext(originalName)),
+			OriginalName: originalName,
+			ContentType:  part.Header.Get("Content-Type"),
+			Size:         -1,
+			Body:         part,
+		}
+		ok := upload(fileUpload)
+		part.Close()
+		if ok == false {
+			return
+		}
+	}
+
+	if len(response.Files) == 0 {
+		writeError(writer, http.StatusBadRequest, "в запросе нет файлов")
+		return
+	}
+	writeJSON(writer, http.StatusCreated, response)
+}
+
+// GetFile возвращает состояние файла задачи.
+//
+// @Summary      Получить файл задачи
+// @Description  Возвращает состояние файла задачи: pending, downloading, stored или failed.
+// @Tags         tasks-v2
+// @Produce      json
+// @Param        id path int true "ID задачи"
+// @Param        fileId path int true "ID файла"
+// @Success      200 {object} TaskFileStatusItem "Файл задачи"
+// @Failure      400 {object} ErrorResponse "Некорректный ID задачи или файла"
+// @Failure      404 {object} ErrorResponse "Задача или файл не найдены"
+// @Failure      500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router       /v2/tasks/{id}/files/{fileId} [get]
+func (handler *TaskHandlerV2) GetFile(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
+	defer cancel()
+
+	taskId, ok := pathID(writer, request, "id")
+	if ok == false {
+		return
+	}
+	fileId, ok := pathID(writer, request, "fileId")
+	if ok == false {
+		return
+	}
+
+	file, err := handler.TaskService.GetTaskFile(ctx, taskId, fileId)
+	if err != nil {
+		writeServiceError(writer, err)
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, newTaskFileStatusItem(file))
+}
+
+// GetManifest возвращает манифест архива задачи.
+//
+// @Summary      Получить манифест архива
+// @Description  Возвращает манифест файлов, записанных в архив задачи: адрес и исходное имя файла, имя в архиве, размер, тип, SHA-256 и время скачивания. Тот же манифест записывается в архив (manifest.json) при завершении задачи, пока задача не завершена, в нём только уже записанные файлы.
+// @Tags         tasks-v2
+// @Produce      json
+// @Param        id path int true "ID задачи"
+// @Success      200 {object} model.Manifest "Манифест архива"
+// @Failure      400 {object} ErrorResponse "Некорректный ID задачи"
+// @Failure      404 {object} ErrorResponse "Задача не найдена"
+// @Failure      500 {object} ErrorResponse "Внутренняя ошибка сервера"
+// @Router       /v2/tasks/{id}/manifest [get]
+func (handler *TaskHandlerV2) GetManifest(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
+	defer cancel()
+
+	taskId, ok := pathID(writer, request, "id")
+	if ok == false {
+		return
+	}
+
+	manifest, err := handler.TaskService.GetManifest(ctx, taskId)
+	if err != nil {
+		writeServiceError(writer, err)
+		return
+	}
+
+	writeJSON(writer, http.StatusOK, manifest)
+}
+
+// taskResponse формирует ответ со статусом задачи и её позицией в очереди ожидания.
+func (handler *TaskHandlerV2) taskResponse(ctx context.Context, request *http.Request, taskId int) (*TaskStatusResponse, error) {
+	task, err := handler.TaskService.GetTaskSnapshot(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+
+	response := newTaskStatusResponse(&task, handler.links.archiveURL(request, &task))
+	response.QueuePosition = handler.TaskService.QueuePosition(taskId)
+
+	return response, nil
+}
+
+// pathID читает целочисленный параметр пути. Если параметр некорректный, отвечает 400 и возвращает false.
+func pathID(writer http.ResponseWriter, request *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(request, name))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, fmt.Sprintf("некорректный параметр %s", name))
+		return 0, false
+	}
+
+	return id, true
+}
+
+// writeServiceError переводит ошибку TaskService в код ответа API v2.
+func writeServiceError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrTaskNotFound):
+		writeError(writer, http.StatusNotFound, "задача не найдена")
+	case errors.Is(err, service.ErrFileNotFound):
+		writeError(writer, http.StatusNotFound, "файл не найден")
+	case errors.Is(err, service.ErrTaskQueued):
+		writeError(writer, http.StatusConflict, "задача ещё ожидает в очереди")
+	case errors.Is(err, model.ErrInvalidTransition):
+		writeError(writer, http.StatusConflict, "задача уже находится в конечном статусе")
+	case errors.Is(err, service.ErrTooManyFiles):
+		writeError(writer, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrTaskTooLarge):
+		writeError(writer, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrDiskBudgetExceeded):
+		writeError(writer, http.StatusInsufficientStorage, err.Error())
+	case errors.Is(err, service.ErrInvalidFileURL):
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case errors.Is(err, util.ErrInvalidCredentials), errors.Is(err, service.ErrUnknownCredentialProfile):
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrInvalidArchivePath):
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrArchiveExists):
+		writeError(writer, http.StatusConflict, err.Error())
+	case errors.Is(err, util.ErrUnsupportedArchiveFormat):
+		writeError(writer, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrDownloadQueueFull):
+		writeError(writer, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, service.ErrFileTooLarge):
+		writeError(writer, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, util.ErrUnsupportedMIMEType):
+		writeError(writer, http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, service.ErrUploadFailed):
+		writeError(writer, http.StatusBadRequest, err.Error())
+	default:
+		// подробности внутренней ошибки клиенту не нужны, они остаются в логе
+		log.Printf("ошибка обработки запроса: %v", err)
+		writeError(writer, http.StatusInternalServerError, "внутренняя ошибка сервера")
+	}
+}
+
+// writeError отвечает ошибкой в формате ErrorResponse.
+func writeError(writer http.ResponseWriter, statusCode int, message string) {
+	writeJSON(writer, statusCode, ErrorResponse{Error: message})
+}
+
+// writeJSON отвечает телом body в формате JSON с кодом statusCode.
+func writeJSON(writer http.ResponseWriter, statusCode int, body any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+	if err := json.NewEncoder(writer).Encode(body); err != nil {
+		log.Printf("ошибка записи ответа: %v", err)
+	}
+}
@@ -0,0 +1,377 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/service"
+	"workmate_test_project/internal/store"
+	"workmate_test_project/internal/util"
+)
+
+func newV2TestRouter(t *testing.T) (http.Handler, *service.TaskService) {
+	taskService, err := service.NewTaskServiceWithOptions(service.TaskServiceOptions{
+		Download: util.DownloaderOptions{
+			URLPolicy: util.URLPolicy{AllowedNetworks: []string{"127.0.0.0/8"}},
+		},
+		StorageRoot: t.TempDir(),
+		Limits:      service.TaskLimits{MaxActiveTasks: 1},
+	})
+	assert.NoError(t, err)
+	t.Cleanup(taskService.Close)
+
+	taskHandlerV2 := NewTaskHandlerV2(taskService, NewArchiveLinks("", false, "/api-tasks", "secret", time.Minute))
+	router := chi.NewRouter()
+	router.Route("/api-tasks/v2", func(r chi.Router) {
+		r.Post("/tasks", taskHandlerV2.CreateTask)
+		r.Get("/tasks", taskHandlerV2.ListTasks)
+		r.Get("/tasks/{id}", taskHandlerV2.GetTask)
+		r.Delete("/tasks/{id}", taskHandlerV2.DeleteTask)
+		r.Post("/tasks/{id}/files", taskHandlerV2.AddFile)
+		r.Post("/tasks/{id}/uploads", taskHandlerV2.UploadFiles)
+		r.Get("/tasks/{id}/files/{fileId}", taskHandlerV2.GetFile)
+		r.Get("/tasks/{id}/archive", taskHandlerV2.DownloadArchive)
+		r.Get("/tasks/{id}/manifest", taskHandlerV2.GetManifest)
+	})
+
+	return router, taskService
+}
+
+func serveV2(router http.Handler, method string, target string, body string, headers ...string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestTaskHandlerV2_Lifecycle(t *testing.T) {
+	router, _ := newV2TestRouter(t)
+	createBody := `{"zipArchiveName": "test1"}`
+
+	response := serveV2(router, http.MethodPost, "/api-tasks/v2/tasks", `{"zipArchivePath": "../outside"}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code, "архив нельзя создать вне корневого каталога архивов")
+
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks", createBody)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.Equal(t, "/api-tasks/v2/tasks/1", response.Header().Get("Location"))
+
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks", createBody)
+	assert.Equal(t, http.StatusTooManyRequests, response.Code, "при занятых слотах задача отклоняется с 429")
+
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks/1/files",
+		`{"fileURL": "http://127.0.0.1:1/file1.pdf", "fileName": "file1"}`)
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	assert.Equal(t, "/api-tasks/v2/tasks/1/files/1", response.Header().Get("Location"))
+
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks/1/files",
+		`{"fileURL": "ftp://127.0.0.1:1/file1.pdf", "fileName": "file2"}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code, "URL не http и не https - ошибка запроса")
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks/1/files",
+		`{"fileURL": "http://169.254.169.254/latest/meta-data/", "fileName": "file2"}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code, "внутренний адрес запрещён политикой исходящих запросов")
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks/1/files",
+		`{"fileURL": "http://127.0.0.1:1/file1.pdf", "fileName": "file2", "credentialProfile": "unknown"}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code, "неизвестный профиль учётных данных - ошибка запроса")
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks/1/files",
+		`{"fileURL": "http://127.0.0.1:1/file1.pdf", "fileName": "file2", "bearerToken": "a", "basicAuth": {"username": "b"}}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code, "Authorization задан двумя способами - ошибка запроса")
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1/files/1", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	var file TaskFileStatusItem
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&file))
+	assert.Equal(t, "file1", file.Name, "до скачивания тип файла неизвестен, поэтому имя без расширения")
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1/files/2", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks?status=created", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	var list TaskListResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&list))
+	assert.Len(t, list.Tasks, 0, "задача с добавленным файлом уже не в статусе created")
+
+	response = serveV2(router, http.MethodDelete, "/api-tasks/v2/tasks/1", "")
+	assert.Equal(t, http.StatusNoContent, response.Code)
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	var errorResponse ErrorResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&errorResponse))
+	assert.NotEmpty(t, errorResponse.Error)
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/abc", "")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestTaskHandlerV2_GetManifest(t *testing.T) {
+	router, _ := newV2TestRouter(t)
+
+	response := serveV2(router, http.MethodPost, "/api-tasks/v2/tasks", `{"zipArchiveName": "test1"}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1/manifest", "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	var manifest model.Manifest
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&manifest))
+	assert.Equal(t, 1, manifest.TaskID)
+	assert.NotNil(t, manifest.Files, "список файлов должен быть пустым массивом, а не null")
+	assert.Empty(t, manifest.Files)
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/2/manifest", "")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestTaskHandlerV2_UploadFiles(t *testing.T) {
+	router, _ := newV2TestRouter(t)
+
+	response := serveV2(router, http.MethodPost, "/api-tasks/v2/tasks", `{"zipArchiveName": "test1"}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("comment", "обычное поле формы пропускается")
+	part, _ := form.CreateFormFile("file", "report.pdf")
+	io.WriteString(part, "%PDF-1.7 отчёт")
+	part, _ = form.CreateFormFile("file", "scan.png")
+	part.Write([]byte("\x89PNG\r\n\x1a\nсодержимое"))
+	form.Close()
+
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks/1/uploads", body.String(),
+		"Content-Type", form.FormDataContentType())
+	assert.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	var uploaded UploadFilesResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&uploaded))
+	if assert.Len(t, uploaded.Files, 2) {
+		assert.Equal(t, "report.pdf", uploaded.Files[0].Name)
+		assert.Equal(t, "scan.png", uploaded.Files[1].Name)
+		assert.True(t, uploaded.Files[1].Uploaded)
+	}
+
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks/1/uploads?fileName=note", "просто текст",
+		"Content-Type", "text/plain")
+	assert.Equal(t, http.StatusUnsupportedMediaType, response.Code, "тип проверяется так же, как у скачанных файлов")
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks/1/uploads", "%PDF-1.7 без имени")
+	assert.Equal(t, http.StatusBadRequest, response.Code, "без multipart имя файла обязательно")
+
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks/1/uploads?fileName=raw", "%PDF-1.7 тело запроса",
+		"Content-Type", "application/pdf")
+	assert.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	assert.Equal(t, "/api-tasks/v2/tasks/1/files/4", response.Header().Get("Location"))
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1", "")
+	var task TaskStatusResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&task))
+	assert.Equal(t, string(model.StatusCompleted), task.StatusCode, "загруженные файлы учитываются в лимите файлов задачи")
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1/manifest", "")
+	var manifest model.Manifest
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&manifest))
+	if assert.Len(t, manifest.Files, 3) {
+		assert.Equal(t, "report.pdf", manifest.Files[0].OriginalName)
+		assert.Empty(t, manifest.Files[0].URL)
+		assert.Equal(t, "raw.pdf", manifest.Files[2].ArchiveName)
+	}
+}
+
+func TestTaskHandlerV2_DownloadArchive(t *testing.T) {
+	router, taskService := newV2TestRouter(t)
+	links := NewArchiveLinks("", false, "/api-tasks", "secret", time.Minute)
+
+	response := serveV2(router, http.MethodPost, "/api-tasks/v2/tasks",
+		`{"zipArchiveName": "архив"}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	task, err := taskService.GetTaskSnapshot(context.Background(), 1)
+	assert.NoError(t, err)
+	expires := time.Now().Add(time.Minute).Unix()
+	response = serveV2(router, http.MethodGet,
+		fmt.Sprintf("/api-tasks/v2/tasks/1/archive?expires=%d&signature=%s", expires, links.sign(&task, expires)), "")
+	assert.Equal(t, http.StatusConflict, response.Code, "архив незавершённой задачи недоступен")
+
+	_, err = taskService.FinalizeTask(context.Background(), 1)
+	assert.NoError(t, err)
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1", "", "X-Forwarded-Proto", "https")
+	var status TaskStatusResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	assert.True(t, strings.HasPrefix(status.ArchiveLink, "http://example.com/api-tasks/v2/tasks/1/archive?"),
+		"вместо пути на сервере должна отдаваться ссылка на скачивание; X-Forwarded-Proto без прокси не учитывается")
+	archiveLink, err := url.Parse(status.ArchiveLink)
+	assert.NoError(t, err)
+	target := archiveLink.RequestURI()
+
+	response = serveV2(router, http.MethodGet, target, "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/zip", response.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename*=utf-8''%D0%B0%D1%80%D1%85%D0%B8%D0%B2.zip",
+		response.Header().Get("Content-Disposition"))
+	assert.Equal(t, strconv.Itoa(response.Body.Len()), response.Header().Get("Content-Length"))
+	etag := response.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	response = serveV2(router, http.MethodGet, target, "", "Range", "bytes=0-3")
+	assert.Equal(t, http.StatusPartialContent, response.Code)
+	assert.Equal(t, "PK\x03\x04", response.Body.String(), "даже в архиве без файлов есть манифест")
+
+	response = serveV2(router, http.MethodGet, target, "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, response.Code)
+}
+
+func TestTaskHandlerV2_DownloadArchive_TarZst(t *testing.T) {
+	router, taskService := newV2TestRouter(t)
+
+	response := serveV2(router, http.MethodPost, "/api-tasks/v2/tasks", `{"zipArchiveName": "test1", "format": "7z"}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code, "неподдерживаемый формат архива - ошибка запроса")
+
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks", `{"zipArchiveName": "test1", "format": "tar.zst"}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	var status TaskStatusResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	assert.Equal(t, "tar.zst", status.Format)
+
+	_, err := taskService.FinalizeTask(context.Background(), 1)
+	assert.NoError(t, err)
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1", "")
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	archiveLink, err := url.Parse(status.ArchiveLink)
+	assert.NoError(t, err)
+
+	response = serveV2(router, http.MethodGet, archiveLink.RequestURI(), "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/zstd", response.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment; filename=test1.tar.zst", response.Header().Get("Content-Disposition"))
+	assert.Equal(t, "\x28\xb5\x2f\xfd", response.Body.String()[:4], "архив должен начинаться с сигнатуры zstd")
+}
+
+func TestTaskHandlerV2_DownloadArchive_Encrypted(t *testing.T) {
+	router, taskService := newV2TestRouter(t)
+
+	response := serveV2(router, http.MethodPost, "/api-tasks/v2/tasks",
+		`{"zipArchiveName": "contracts", "format": "tar", "password": "секрет"}`)
+	assert.Equal(t, http.StatusBadRequest, response.Code, "шифрование поддерживается только для zip")
+	assert.NotContains(t, response.Body.String(), "секрет", "пароль не должен возвращаться в ответе")
+
+	response = serveV2(router, http.MethodPost, "/api-tasks/v2/tasks", `{"zipArchiveName": "contracts", "password": "секрет"}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	assert.NotContains(t, response.Body.String(), "секрет", "пароль не должен возвращаться в ответе")
+	var status TaskStatusResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	assert.True(t, status.Encrypted)
+
+	_, err := taskService.FinalizeTask(context.Background(), 1)
+	assert.NoError(t, err)
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1", "")
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&status))
+	archiveLink, err := url.Parse(status.ArchiveLink)
+	assert.NoError(t, err)
+
+	response = serveV2(router, http.MethodGet, archiveLink.RequestURI(), "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "winzip-aes-256", response.Header().Get("X-Archive-Encryption"))
+}
+
+func TestTaskHandlerV2_DownloadArchive_SignedLinks(t *testing.T) {
+	router, taskService := newV2TestRouter(t)
+	links := NewArchiveLinks("", false, "/api-tasks", "secret", time.Minute)
+
+	response := serveV2(router, http.MethodPost, "/api-tasks/v2/tasks", `{}`)
+	assert.Equal(t, http.StatusCreated, response.Code)
+	_, err := taskService.FinalizeTask(context.Background(), 1)
+	assert.NoError(t, err)
+	task, err := taskService.GetTaskSnapshot(context.Background(), 1)
+	assert.NoError(t, err)
+	otherTask := &model.Task{ID: 2, CreatedAt: task.CreatedAt}
+	// задача, которая раньше была под тем же ID и удалена до перезапуска сервера
+	deletedTask := &model.Task{ID: 1, CreatedAt: task.CreatedAt.Add(-time.Hour)}
+
+	expires := time.Now().Add(time.Minute).Unix()
+	expired := time.Now().Add(-time.Minute).Unix()
+	tests := []struct {
+		name    string
+		query   string
+		message string
+	}{
+		{"без подписи", "", errArchiveLinkInvalid.Error()},
+		{"подпись другой задачи", fmt.Sprintf("expires=%d&signature=%s", expires, links.sign(otherTask, expires)), errArchiveLinkInvalid.Error()},
+		{"подпись удалённой задачи с тем же ID", fmt.Sprintf("expires=%d&signature=%s", expires, links.sign(deletedTask, expires)),
+			errArchiveLinkInvalid.Error()},
+		{"продлённая ссылка", fmt.Sprintf("expires=%d&signature=%s", expires+3600, links.sign(&task, expires)), errArchiveLinkInvalid.Error()},
+		{"чужой ключ", fmt.Sprintf("expires=%d&signature=%s", expires,
+			NewArchiveLinks("", false, "/api-tasks", "other", time.Minute).sign(&task, expires)), errArchiveLinkInvalid.Error()},
+		{"истёкшая ссылка", fmt.Sprintf("expires=%d&signature=%s", expired, links.sign(&task, expired)), errArchiveLinkExpired.Error()},
+	}
+
+	response = serveV2(router, http.MethodGet,
+		fmt.Sprintf("/api-tasks/v2/tasks/2/archive?expires=%d&signature=%s", expires, links.sign(otherTask, expires)), "")
+	assert.Equal(t, http.StatusForbidden, response.Code, "по ссылке на несуществующую задачу нельзя узнать, есть ли задача")
+
+	for _, test := range tests {
+		response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1/archive?"+test.query, "")
+		assert.Equal(t, http.StatusForbidden, response.Code, test.name)
+		var errorResponse ErrorResponse
+		assert.NoError(t, json.NewDecoder(response.Body).Decode(&errorResponse), test.name)
+		assert.Equal(t, test.message, errorResponse.Error, test.name)
+	}
+
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1", "")
+	var first TaskStatusResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&first))
+	time.Sleep(1100 * time.Millisecond)
+	response = serveV2(router, http.MethodGet, "/api-tasks/v2/tasks/1", "")
+	var second TaskStatusResponse
+	assert.NoError(t, json.NewDecoder(response.Body).Decode(&second))
+	assert.NotEqual(t, first.ArchiveLink, second.ArchiveLink, "при каждом запросе статуса выдаётся новая ссылка")
+
+	request := httptest.NewRequest(http.MethodGet, "/api-tasks/v2/tasks/1", nil)
+	request.Header.Set("X-Forwarded-Proto", "https")
+	proxied := NewArchiveLinks("", true, "/api-tasks", "secret", time.Minute)
+	assert.True(t, strings.HasPrefix(proxied.archiveURL(request, &task), "https://example.com/"),
+		"за прокси схема берётся из X-Forwarded-Proto")
+}
+
+func TestWriteServiceError_UnexpectedError(t *testing.T) {
+	internalErr := fmt.Errorf("ошибка записи манифеста: %w", errors.New("/var/lib/archives/1.zip: нет места"))
+
+	recorder := httptest.NewRecorder()
+	writeServiceError(recorder, internalErr)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code, "неизвестная ошибка - ошибка сервера, а не запроса")
+	assert.NotContains(t, recorder.Body.String(), "/var/lib/archives", "подробности ошибки не должны попадать в ответ")
+
+	recorder = httptest.NewRecorder()
+	writeServiceError(recorder, fmt.Errorf("%w: id = 7", store.ErrTaskNotFound))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	writeServiceError(recorder, fmt.Errorf("%w: обрыв соединения", service.ErrUploadFailed))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, "обрыв загрузки - ошибка запроса")
+
+	recorder = httptest.NewRecorder()
+	writeTaskError(recorder, "ошибка отмены задачи", internalErr)
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code, "API v1 не выдаёт внутреннюю ошибку за ненайденную задачу")
+	assert.NotContains(t, recorder.Body.String(), "/var/lib/archives")
+
+	recorder = httptest.NewRecorder()
+	writeTaskError(recorder, "ошибка отмены задачи", fmt.Errorf("%w: id = 7", store.ErrTaskNotFound))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "задача не была найдена")
+}
@@ -3,37 +3,94 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
+	"workmate_test_project/internal/model"
 	"workmate_test_project/internal/service"
+	"workmate_test_project/internal/store"
+	"workmate_test_project/internal/util"
 )
 
 type TaskHandler struct {
 	*service.TaskService
+	links ArchiveLinks
 }
 
 // TaskStatusResponse представляет собой ответ сервера со статусом задачи.
 //
 // Используется в ответе на GET-запрос получения статуса задачи.
-// ArchiveLink будет непустым, только если задача завершена.
+// Status - локализованное название статуса, StatusCode - стабильный машиночитаемый код
+// (queued, created, running, completed, failed, cancelled).
+// QueuePosition - позиция задачи в очереди ожидания (начиная с 1), только для статуса queued.
+// ArchiveLink - подписанная ссылка на скачивание архива (см. TaskHandlerV2.DownloadArchive), будет непустой, только если задача завершена.
+// При каждом запросе статуса выдаётся новая ссылка с ограниченным сроком действия.
+// Format - формат архива задачи (zip, tar, tar.gz или tar.zst).
+// Encrypted - файлы архива зашифрованы WinZip AES-256 паролем, заданным при создании задачи.
+// LastError содержит последнюю ошибку задачи, для статуса failed - причину ошибки.
 type TaskStatusResponse struct {
-	TaskID      int    `json:"taskID" example:"1"`
-	Status      string `json:"status" example:"завершена"`
-	ArchiveLink string `json:"archiveLink" example:"G:/GithubRepo/17.07.2025/internal/util/task_1.zip"`
+	TaskID        int                  `json:"taskID" example:"1"`
+	Status        string               `json:"status" example:"завершена"`
+	StatusCode    string               `json:"statusCode" example:"completed"`
+	QueuePosition int                  `json:"queuePosition,omitempty" example:"0"`
+	ArchiveLink   string               `json:"archiveLink" example:"http://localhost:8080/api-tasks/v2/tasks/1/archive?expires=1752768000&signature=..."`
+	Format        string               `json:"format" example:"zip"`
+	Encrypted     bool                 `json:"encrypted" example:"false"`
+	LastError     string               `json:"lastError,omitempty" example:""`
+	Files         []TaskFileStatusItem `json:"files"`
+}
+
+// TaskFileStatusItem - состояние одного файла задачи.
+// Status - pending (ожидает скачивания), downloading (скачивается), stored (записан в архив) или failed.
+// Name - имя файла в архиве; пока файл не скачан и его тип не определён - имя без расширения.
+// ContentType - тип файла, определённый по содержимому при скачивании.
+// Error заполняется, если файл не удалось скачать или записать в архив, ErrorCode - для известных причин:
+// file_too_large, task_too_large, disk_budget_exceeded (превышены лимиты размера), unsupported_type
+// forbidden_url (сервер перенаправил на адрес, запрещённый политикой исходящих запросов)
+// credentials_lost (учётные данные из запроса утеряны при перезапуске сервера) и upload_interrupted
+// (загруженный файл не успел записаться в архив до перезапуска сервера).
+// Attempts - сколько попыток скачивания сделано, LastError - ошибка последней неудачной попытки
+// (заполняется и для файла, который скачался после повтора).
+// CredentialProfile - профиль учётных данных, с которыми скачивается файл; сами учётные данные не возвращаются.
+// Uploaded - файл загружен клиентом в теле запроса (POST /v2/tasks/{id}/uploads), а не скачан по URL.
+type TaskFileStatusItem struct {
+	FileID      int    `json:"fileID" example:"1"`
+	Name        string `json:"name" example:"test3.pdf"`
+	ContentType string `json:"contentType,omitempty" example:"application/pdf"`
+	Status      string `json:"status" example:"stored"`
+	Stored      bool   `json:"stored" example:"true"`
+	Error       string `json:"error,omitempty" example:""`
+	ErrorCode   string `json:"errorCode,omitempty" example:""`
+	Attempts    int    `json:"attempts,omitempty" example:"2"`
+	LastError   string `json:"lastError,omitempty" example:""`
+
+	CredentialProfile string `json:"credentialProfile,omitempty" example:""`
+	Uploaded          bool   `json:"uploaded,omitempty" example:"false"`
 }
 
 // CreateTaskRequest содержит путь и имя архива, который будет создан для задачи.
+// ZipArchivePath - каталог относительно корня хранилища архивов (archive_storage), пустой - сам корень.
+// ZipArchiveName - имя архива без каталогов, если не задано, генерируется сервером.
+// Format - формат архива: zip (по умолчанию), tar, tar.gz или tar.zst, расширение добавляется к имени автоматически.
+// Password - пароль для шифрования файлов архива WinZip AES-256 (только для zip), пустой - без шифрования.
+// Пароль не сохраняется и не логируется, поэтому незавершённая задача с шифрованием не переживает перезапуск сервера.
 type CreateTaskRequest struct {
-	ZipArchivePath string `json:"zipArchivePath" example:"G:/GithubRepo/17.07.2025/internal/util"`
+	ZipArchivePath string `json:"zipArchivePath" example:"reports/2025"`
 	ZipArchiveName string `json:"zipArchiveName" example:"test1"`
+	Format         string `json:"format" example:"zip"`
+	Password       string `json:"password" example:""`
 }
 
 // CreateTaskResponse возвращает ID созданной задачи.
+// Если задача поставлена в очередь ожидания, StatusCode = queued, а QueuePosition - её позиция в очереди.
 type CreateTaskResponse struct {
-	Message string `json:"message" example:"id вашей задачи: "`
-	TaskID  int    `json:"taskID" example:"1"`
+	Message       string `json:"message" example:"id вашей задачи: "`
+	TaskID        int    `json:"taskID" example:"1"`
+	StatusCode    string `json:"statusCode" example:"created"`
+	QueuePosition int    `json:"queuePosition,omitempty" example:"0"`
 }
 
 // AddFileToTaskRequest содержит параметры запроса для добавления файла к задаче.
@@ -41,28 +98,91 @@ type AddFileToTaskRequest struct {
 	TaskID   int    `json:"taskID" example:"1"`
 	FileURL  string `json:"fileURL" example:"https://example.com/file.pdf"`
 	FileName string `json:"fileName" example:"test3"`
+	FileAuthRequest
+}
+
+// FileAuthRequest - авторизация на сервере, с которого скачивается файл (все поля необязательные).
+// Headers - дополнительные заголовки запроса, например {"X-Api-Key": "..."}
+// BearerToken - токен для заголовка "Authorization: Bearer ..."
+// BasicAuth - логин и пароль для Basic-авторизации
+// Cookies - cookie запроса (имя - значение)
+// CredentialProfile - имя профиля учётных данных из конфигурации сервера (download.credential_profiles),
+// нельзя сочетать с остальными полями; секреты профиля не передаются в запросах и переживают перезапуск сервера.
+// Учётные данные не сохраняются, не логируются и не возвращаются в статусе и манифесте.
+type FileAuthRequest struct {
+	Headers           map[string]string `json:"headers,omitempty"`
+	BearerToken       string            `json:"bearerToken,omitempty" example:""`
+	BasicAuth         *BasicAuthRequest `json:"basicAuth,omitempty"`
+	Cookies           map[string]string `json:"cookies,omitempty"`
+	CredentialProfile string            `json:"credentialProfile,omitempty" example:""`
+}
+
+// BasicAuthRequest - логин и пароль для Basic-авторизации.
+type BasicAuthRequest struct {
+	Username string `json:"username" example:"user"`
+	Password string `json:"password" example:""`
+}
+
+// fileAuth преобразует авторизацию из запроса в service.FileAuth.
+func (request FileAuthRequest) fileAuth() service.FileAuth {
+	auth := service.FileAuth{
+		Profile: request.CredentialProfile,
+		Credentials: util.Credentials{
+			Headers:     request.Headers,
+			BearerToken: request.BearerToken,
+			Cookies:     request.Cookies,
+		},
+	}
+	if request.BasicAuth != nil {
+		auth.Credentials.Username = request.BasicAuth.Username
+		auth.Credentials.Password = request.BasicAuth.Password
+	}
+
+	return auth
+}
+
+// FinalizeTaskRequest содержит ID задачи, которую нужно завершить.
+type FinalizeTaskRequest struct {
+	TaskID int `json:"taskID" example:"1"`
+}
+
+// CancelTaskRequest содержит ID задачи, которую нужно отменить.
+// KeepArchive - не удалять архив с уже записанными файлами.
+type CancelTaskRequest struct {
+	TaskID      int  `json:"taskID" example:"1"`
+	KeepArchive bool `json:"keepArchive" example:"false"`
+}
+
+// DeleteTaskResponse содержит ответ после удаления задачи.
+type DeleteTaskResponse struct {
+	Message string `json:"message" example:"задача удалена"`
+	TaskID  int    `json:"taskID" example:"1"`
 }
 
-// AddFileToTaskResponse содержит ответ после успешного добавления файла.
+// AddFileToTaskResponse содержит ответ после постановки файла в очередь скачивания.
+// FileID - ID файла внутри задачи, по нему можно найти состояние файла в ответе /get.
 type AddFileToTaskResponse struct {
-	Message string `json:"message" example:"файлы успешно добавлен к вашей задаче"`
+	Message string `json:"message" example:"файл поставлен в очередь на скачивание"`
 	TaskID  int    `json:"taskID" example:"1"`
+	FileID  int    `json:"fileID" example:"1"`
+	Status  string `json:"status" example:"pending"`
 }
 
-func NewTaskHandler(taskService *service.TaskService) *TaskHandler {
-	return &TaskHandler{taskService}
+func NewTaskHandler(taskService *service.TaskService, links ArchiveLinks) *TaskHandler {
+	return &TaskHandler{TaskService: taskService, links: links}
 }
 
 // GetTaskStatusById возвращает статус задачи по её ID.
 //
 // @Summary Получить статус задачи
-// @Description Возвращает статус задачи и ссылку на архив (если все файлы добавлены).
+// @Description Возвращает статус задачи и ссылку на архив (если задача завершена).
 // @Tags tasks
 // @Accept json
 // @Produce json
 // @Param task-id query int true "ID задачи"
 // @Success 200 {object} TaskStatusResponse
 // @Failure 400 {string} string "некорректный ID задачи или задача не найдена"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
 // @Router /get [get]
 func (handler *TaskHandler) GetTaskStatusById(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
@@ -76,25 +196,14 @@ func (handler *TaskHandler) GetTaskStatusById(writer http.ResponseWriter, reques
 		return
 	}
 
-	task, err := handler.TaskService.GetTaskStatusById(ctx, taskId)
+	task, err := handler.TaskService.GetTaskSnapshot(ctx, taskId)
 	if err != nil {
-		log.Printf("задача не найден: %v", err)
-		http.Error(writer, "задача не была найдена", http.StatusBadRequest)
+		writeTaskError(writer, "ошибка получения задачи", err)
 		return
 	}
 
-	response := &TaskStatusResponse{
-		TaskID: task.ID,
-		Status: task.Status,
-	}
-
-	if task.FilesAdded == 3 {
-		response = &TaskStatusResponse{
-			TaskID:      task.ID,
-			Status:      task.Status,
-			ArchiveLink: task.ArchiveLink,
-		}
-	}
+	response := newTaskStatusResponse(&task, handler.links.archiveURL(request, &task))
+	response.QueuePosition = handler.TaskService.QueuePosition(task.ID)
 
 	writer.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(writer).Encode(&response)
@@ -103,14 +212,17 @@ func (handler *TaskHandler) GetTaskStatusById(writer http.ResponseWriter, reques
 // CreateTask создаёт новую задачу с указанным путем и именем архива.
 //
 // @Summary      Создание новой задачи
-// @Description  Создаёт задачу, для которой можно добавлять файлы в ZIP архив.
+// @Description  Создаёт задачу, для которой можно добавлять файлы в архив формата zip, tar, tar.gz или tar.zst (поле format, по умолчанию zip). Количество одновременно активных задач ограничено параметром tasks.max_active_tasks конфигурации. Если все слоты заняты и tasks.busy_policy = queue, задача ставится в очередь ожидания (не больше tasks.queue_size задач) и запускается автоматически, когда освободится слот.
 // @Tags         tasks
 // @Accept       json
 // @Produce      json
-// @Param        request body CreateTaskRequest true "Путь и имя архива"
+// @Param        request body CreateTaskRequest true "Путь, имя и формат архива"
 // @Success      200 {object} CreateTaskResponse "Успешный ответ с ID созданной задачи"
-// @Failure      400 {string} string "Неверный формат JSON"
-// @Failure      503 {string} string "Ошибка создания задачи"
+// @Success      202 {object} CreateTaskResponse "Задача поставлена в очередь ожидания"
+// @Failure      400 {string} string "Неверный формат JSON, неподдерживаемый формат архива или путь архива вне корневого каталога архивов"
+// @Failure      409 {string} string "Архив с таким именем уже существует"
+// @Failure      500 {string} string "Ошибка создания задачи"
+// @Failure      503 {string} string "Достигнут лимит активных задач или очередь ожидания заполнена"
 // @Router       /create-task [post]
 func (handler *TaskHandler) CreateTask(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
@@ -122,31 +234,66 @@ func (handler *TaskHandler) CreateTask(writer http.ResponseWriter, request *http
 		return
 	}
 
-	task, err := handler.TaskService.CreateTask(ctx, createTaskRequest.ZipArchivePath, createTaskRequest.ZipArchiveName)
+	task, err := handler.TaskService.CreateTask(ctx, createTaskRequest.ZipArchivePath, createTaskRequest.ZipArchiveName,
+		util.ArchiveFormat(createTaskRequest.Format), createTaskRequest.Password)
+	if errors.Is(err, service.ErrServerBusy) {
+		log.Printf("ошибка создания задачи: %v", err)
+		http.Error(writer, fmt.Sprintf("сервер в данный момент занят, максимальное количество активных задач: %d",
+			handler.TaskService.Limits().MaxActiveTasks), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, service.ErrQueueFull) {
+		log.Printf("ошибка создания задачи: %v", err)
+		http.Error(writer, fmt.Sprintf("сервер в данный момент занят, очередь задач заполнена (%d)",
+			handler.TaskService.QueueSize()), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidArchivePath) || errors.Is(err, util.ErrUnsupportedArchiveFormat) {
+		log.Printf("ошибка создания задачи: %v", err)
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrArchiveExists) {
+		log.Printf("ошибка создания задачи: %v", err)
+		http.Error(writer, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Printf("ошибка создания задачи: %v", err)
-		http.Error(writer, "сервер в данный момент занят", http.StatusServiceUnavailable)
+		http.Error(writer, "ошибка создания задачи", http.StatusInternalServerError)
 		return
 	}
 
 	response := &CreateTaskResponse{
-		Message: "id вашей задачи: ",
-		TaskID:  task.ID,
+		Message:    "id вашей задачи: ",
+		TaskID:     task.ID,
+		StatusCode: string(model.StatusCreated),
 	}
 	writer.Header().Set("Content-Type", "application/json")
+	// задача могла запуститься сразу после постановки в очередь, поэтому смотрим на её позицию, а не на статус
+	if position := handler.TaskService.QueuePosition(task.ID); position > 0 {
+		response.Message = "задача поставлена в очередь, id вашей задачи: "
+		response.StatusCode = string(model.StatusQueued)
+		response.QueuePosition = position
+		writer.WriteHeader(http.StatusAccepted)
+	}
 	json.NewEncoder(writer).Encode(&response)
 }
 
 // AddFileToTask добавляет файл к задаче по её ID.
 //
 // @Summary      Добавить файл к задаче
-// @Description  Добавляет файл в архив задачи, ограничение — максимум 3 файла на задачу.
+// @Description  Ставит файл в очередь скачивания и сразу возвращает его ID. Файл скачивается и записывается в архив задачи в фоне, его состояние (pending, downloading, stored, failed) возвращается в /get. Тип файла определяется по его содержимому и заголовку Content-Type ответа, а не по расширению в URL, и должен входить в tasks.allowed_mime_types; от типа зависит расширение файла в архиве. Количество файлов в задаче задаётся параметром tasks.max_files_per_task конфигурации. Размер файла ограничен tasks.max_file_size, файлов задачи вместе - tasks.max_task_size, файлов всех задач - tasks.disk_budget; файл, превысивший лимит по Content-Length или при скачивании, получает статус failed и код ошибки errorCode. Адреса проверяются политикой исходящих запросов download.url_policy: внутренние адреса (loopback, частные сети, link-local, 169.254.169.254) запрещены, в том числе после разрешения имени хоста и при перенаправлениях. Для сервера с авторизацией можно передать заголовки, bearer-токен, логин и пароль Basic или cookie либо сослаться на профиль download.credential_profiles; учётные данные не сохраняются, не логируются и не попадают в статус и манифест, а на другой хост при перенаправлении не передаются.
 // @Tags         tasks
 // @Accept       json
 // @Produce      json
 // @Param        request body AddFileToTaskRequest true "Данные для добавления файла"
-// @Success      200 {object} AddFileToTaskResponse "Файл успешно добавлен к задаче"
-// @Failure      400 {string} string "Неверный формат JSON или превышен лимит файлов"
+// @Success      202 {object} AddFileToTaskResponse "Файл поставлен в очередь скачивания"
+// @Failure      400 {string} string "Неверный формат JSON, превышен лимит файлов или размера задачи, некорректный URL файла, адрес, запрещённый политикой исходящих запросов, некорректные учётные данные или неизвестный профиль"
+// @Failure      409 {string} string "Задача ещё в очереди, уже завершена, отменена или завершилась с ошибкой"
+// @Failure      500 {string} string "Внутренняя ошибка сервера"
+// @Failure      503 {string} string "Очередь скачивания файлов заполнена"
+// @Failure      507 {string} string "Исчерпано место, отведённое сервису под файлы (tasks.disk_budget)"
 // @Router       /add-file-to-task [post]
 func (handler *TaskHandler) AddFileToTask(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
@@ -158,20 +305,236 @@ func (handler *TaskHandler) AddFileToTask(writer http.ResponseWriter, request *h
 		return
 	}
 
-	err := handler.TaskService.AddFileToTask(
+	fileId, err := handler.TaskService.AddFileToTaskWithAuth(
 		ctx, addFileToTaskRequest.TaskID, addFileToTaskRequest.FileURL, addFileToTaskRequest.FileName,
+		addFileToTaskRequest.fileAuth(),
 	)
 	if err != nil {
 		log.Printf("ошибка добавления файла к задаче: %v", err)
-		http.Error(writer, "в задаче может быть максимум 3 файла", http.StatusBadRequest)
+		limits := handler.TaskService.Limits()
+
+		switch {
+		case errors.Is(err, service.ErrTaskQueued):
+			http.Error(writer, "задача ещё ожидает в очереди, добавьте файл после её запуска", http.StatusConflict)
+		case errors.Is(err, model.ErrInvalidTransition):
+			http.Error(writer, "задача больше не принимает файлы", http.StatusConflict)
+		case errors.Is(err, service.ErrTooManyFiles):
+			http.Error(writer, fmt.Sprintf("максимальное количество файлов в задаче: %d",
+				limits.MaxFilesPerTask), http.StatusBadRequest)
+		case errors.Is(err, service.ErrTaskTooLarge):
+			http.Error(writer, fmt.Sprintf("файлы задачи уже занимают максимальный размер задачи: %d байт",
+				limits.MaxTaskSize), http.StatusBadRequest)
+		case errors.Is(err, service.ErrDiskBudgetExceeded):
+			http.Error(writer, "место, отведённое сервису под файлы, исчерпано", http.StatusInsufficientStorage)
+		case errors.Is(err, util.ErrURLForbidden):
+			http.Error(writer, "адрес файла запрещён политикой исходящих запросов", http.StatusBadRequest)
+		case errors.Is(err, service.ErrInvalidFileURL):
+			http.Error(writer, "некорректный URL файла, нужен адрес http или https", http.StatusBadRequest)
+		case errors.Is(err, util.ErrInvalidCredentials), errors.Is(err, service.ErrUnknownCredentialProfile):
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, service.ErrDownloadQueueFull):
+			http.Error(writer, fmt.Sprintf("сервер в данный момент занят, в очереди скачивания уже %d файл(а/ов)",
+				limits.DownloadQueueSize), http.StatusServiceUnavailable)
+		case errors.Is(err, store.ErrTaskNotFound):
+			http.Error(writer, "задача не была найдена", http.StatusBadRequest)
+		default:
+			http.Error(writer, "не удалось добавить файл к задаче", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	response := AddFileToTaskResponse{
-		Message: "файлы успешно добавлен к вашей задаче",
+		Message: "файл поставлен в очередь на скачивание",
 		TaskID:  addFileToTaskRequest.TaskID,
+		FileID:  fileId,
+		Status:  string(model.FilePending),
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(writer).Encode(&response)
+}
+
+// FinalizeTask завершает задачу, не дожидаясь добавления всех файлов.
+//
+// @Summary      Завершить задачу
+// @Description  Закрывает архив задачи с уже добавленными файлами (их может быть меньше tasks.max_files_per_task), переводит задачу в статус completed и освобождает слот задачи.
+// @Tags         tasks
+// @Accept       json
+// @Produce      json
+// @Param        request body FinalizeTaskRequest true "ID задачи"
+// @Success      200 {object} TaskStatusResponse "Задача завершена, ссылка на архив доступна"
+// @Failure      400 {string} string "Неверный формат JSON или задача не найдена"
+// @Failure      409 {string} string "Задача уже в конечном статусе, ещё в очереди или в неё ещё скачиваются файлы"
+// @Failure      500 {string} string "Внутренняя ошибка сервера"
+// @Router       /finalize-task [post]
+func (handler *TaskHandler) FinalizeTask(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
+	defer cancel()
+
+	var finalizeTaskRequest FinalizeTaskRequest
+	if err := json.NewDecoder(request.Body).Decode(&finalizeTaskRequest); err != nil {
+		http.Error(writer, "неверный формат json", http.StatusBadRequest)
+		return
+	}
+
+	task, err := handler.TaskService.FinalizeTask(ctx, finalizeTaskRequest.TaskID)
+	if errors.Is(err, model.ErrInvalidTransition) {
+		log.Printf("ошибка завершения задачи: %v", err)
+		http.Error(writer, "задача уже находится в конечном статусе", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, service.ErrTaskQueued) {
+		log.Printf("ошибка завершения задачи: %v", err)
+		http.Error(writer, "задача ещё ожидает в очереди", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, service.ErrFilesInProgress) {
+		log.Printf("ошибка завершения задачи: %v", err)
+		http.Error(writer, "в задачу ещё скачиваются файлы, повторите запрос позже", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeTaskError(writer, "ошибка завершения задачи", err)
+		return
+	}
+
+	response := newTaskStatusResponse(task, handler.links.archiveURL(request, task))
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(&response)
+}
+
+// CancelTask отменяет задачу по её ID.
+//
+// @Summary      Отменить задачу
+// @Description  Прерывает скачивания задачи, удаляет её архив (если не передан keepArchive) и освобождает слот задачи. Отменённая задача остаётся доступной через /get в течение времени, заданного в конфигурации (tasks.cancelled_retention).
+// @Tags         tasks
+// @Accept       json
+// @Produce      json
+// @Param        request body CancelTaskRequest true "ID задачи и флаг сохранения архива"
+// @Success      200 {object} TaskStatusResponse "Задача отменена"
+// @Failure      400 {string} string "Неверный формат JSON или задача не найдена"
+// @Failure      409 {string} string "Задача уже в конечном статусе"
+// @Failure      500 {string} string "Внутренняя ошибка сервера"
+// @Router       /cancel-task [post]
+func (handler *TaskHandler) CancelTask(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
+	defer cancel()
+
+	var cancelTaskRequest CancelTaskRequest
+	if err := json.NewDecoder(request.Body).Decode(&cancelTaskRequest); err != nil {
+		http.Error(writer, "неверный формат json", http.StatusBadRequest)
+		return
+	}
+
+	task, err := handler.TaskService.CancelTask(ctx, cancelTaskRequest.TaskID, cancelTaskRequest.KeepArchive)
+	if errors.Is(err, model.ErrInvalidTransition) {
+		log.Printf("ошибка отмены задачи: %v", err)
+		http.Error(writer, "задача уже находится в конечном статусе", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeTaskError(writer, "ошибка отмены задачи", err)
+		return
+	}
+
+	response := newTaskStatusResponse(task, handler.links.archiveURL(request, task))
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(&response)
+}
+
+// DeleteTask удаляет задачу по её ID.
+//
+// @Summary      Удалить задачу
+// @Description  Удаляет задачу и её архив. Незавершённая задача перед удалением отменяется.
+// @Tags         tasks
+// @Produce      json
+// @Param        task-id query int true "ID задачи"
+// @Param        keep-archive query bool false "Не удалять архив с диска"
+// @Success      200 {object} DeleteTaskResponse "Задача удалена"
+// @Failure      400 {string} string "Некорректный ID задачи или задача не найдена"
+// @Failure      500 {string} string "Внутренняя ошибка сервера"
+// @Router       /delete-task [delete]
+func (handler *TaskHandler) DeleteTask(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), 4*time.Second)
+	defer cancel()
+
+	taskId, err := strconv.Atoi(request.URL.Query().Get("task-id"))
+	if err != nil {
+		http.Error(writer, "некорректный ID задачи", http.StatusBadRequest)
+		return
+	}
+	keepArchive := request.URL.Query().Get("keep-archive") == "true"
+
+	if err := handler.TaskService.DeleteTask(ctx, taskId, keepArchive); err != nil {
+		writeTaskError(writer, "ошибка удаления задачи", err)
+		return
+	}
+
+	response := DeleteTaskResponse{
+		Message: "задача удалена",
+		TaskID:  taskId,
 	}
 
 	writer.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(writer).Encode(&response)
 }
+
+// newTaskStatusResponse формирует ответ со статусом задачи.
+// Ссылка на архив archiveURL отдаётся только для завершённой задачи.
+func newTaskStatusResponse(task *model.Task, archiveURL string) *TaskStatusResponse {
+	response := &TaskStatusResponse{
+		TaskID:     task.ID,
+		Status:     task.Status.Label(),
+		StatusCode: string(task.Status),
+		Format:     string(task.Format),
+		Encrypted:  task.Encrypted,
+		LastError:  task.LastError,
+		Files:      make([]TaskFileStatusItem, 0, len(task.Files)),
+	}
+	for _, file := range task.Files {
+		response.Files = append(response.Files, newTaskFileStatusItem(file))
+	}
+
+	if task.Status == model.StatusCompleted {
+		response.ArchiveLink = archiveURL
+	}
+
+	return response
+}
+
+// newTaskFileStatusItem формирует состояние одного файла задачи.
+func newTaskFileStatusItem(file model.TaskFile) TaskFileStatusItem {
+	name := file.ArchiveName
+	if name == "" {
+		name = file.Name
+	}
+
+	return TaskFileStatusItem{
+		FileID:      file.ID,
+		Name:        name,
+		ContentType: file.ContentType,
+		Status:      string(file.Status),
+		Stored:      file.Stored,
+		Error:       file.Error,
+		ErrorCode:   file.ErrorCode,
+		Attempts:    file.Attempts,
+		LastError:   file.LastError,
+
+		CredentialProfile: file.CredentialProfile,
+		Uploaded:          file.Uploaded,
+	}
+}
+
+// writeTaskError отвечает на ошибку TaskService, для которой у обработчика API v1 нет отдельного ответа:
+// ненайденная задача - 400, остальное - 500 без подробностей (они пишутся в лог с префиксом action).
+func writeTaskError(writer http.ResponseWriter, action string, err error) {
+	log.Printf("%s: %v", action, err)
+	if errors.Is(err, store.ErrTaskNotFound) {
+		http.Error(writer, "задача не была найдена", http.StatusBadRequest)
+		return
+	}
+	http.Error(writer, "внутренняя ошибка сервера", http.StatusInternalServerError)
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TaskStatus - машиночитаемый код статуса задачи.
+// Коды стабильны и отдаются клиентам как есть, для отображения используется Label.
+type TaskStatus string
+
+const (
+	StatusQueued    TaskStatus = "queued"
+	StatusCreated   TaskStatus = "created"
+	StatusRunning   TaskStatus = "running"
+	StatusCompleted TaskStatus = "completed"
+	StatusFailed    TaskStatus = "failed"
+	StatusCancelled TaskStatus = "cancelled"
+)
+
+// ErrInvalidTransition возвращается при попытке перевести задачу в статус,
+// недостижимый из текущего.
+var ErrInvalidTransition = errors.New("недопустимый переход статуса задачи")
+
+var statusLabels = map[TaskStatus]string{
+	StatusQueued:    "в очереди",
+	StatusCreated:   "создана",
+	StatusRunning:   "выполняется",
+	StatusCompleted: "завершена",
+	StatusFailed:    "ошибка",
+	StatusCancelled: "отменена",
+}
+
+// statusTransitions - разрешённые переходы: создана → выполняется → завершена, ошибка или отменена.
+// Задача, ожидающая свободного слота, начинает со статуса "в очереди" и переходит из него в "создана".
+// Из конечных статусов (завершена, ошибка, отменена) перейти никуда нельзя.
+var statusTransitions = map[TaskStatus][]TaskStatus{
+	StatusQueued:  {StatusCreated, StatusFailed, StatusCancelled},
+	StatusCreated: {StatusRunning, StatusFailed, StatusCancelled},
+	StatusRunning: {StatusCompleted, StatusFailed, StatusCancelled},
+}
+
+// Label возвращает локализованное название статуса.
+func (status TaskStatus) Label() string {
+	if label, exist := statusLabels[status]; exist {
+		return label
+	}
+
+	return string(status)
+}
+
+// IsFinal сообщает, является ли статус конечным.
+func (status TaskStatus) IsFinal() bool {
+	return len(statusTransitions[status]) == 0
+}
+
+// CanTransitionTo сообщает, можно ли перейти из текущего статуса в next.
+// Переход в тот же самый статус всегда разрешён.
+func (status TaskStatus) CanTransitionTo(next TaskStatus) bool {
+	if status == next {
+		return true
+	}
+	for _, allowed := range statusTransitions[status] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UnmarshalText разбирает статус из кода или из локализованного названия,
+// чтобы журналы задач, записанные до появления кодов, продолжали читаться.
+func (status *TaskStatus) UnmarshalText(text []byte) error {
+	value := TaskStatus(text)
+	if _, exist := statusLabels[value]; exist {
+		*status = value
+		return nil
+	}
+	for code, label := range statusLabels {
+		if label == string(text) {
+			*status = code
+			return nil
+		}
+	}
+
+	return fmt.Errorf("неизвестный статус задачи: %s", text)
+}
+
+// RequeueForRecovery возвращает незавершённую задачу в статус "в очереди", если после перезапуска сервера
+// для неё не нашлось свободного слота. Архив задачи восстанавливается, когда она снова получит слот.
+// Это единственный переход назад, поэтому его нет в statusTransitions.
+func (task *Task) RequeueForRecovery() error {
+	if task.Status != StatusCreated && task.Status != StatusRunning {
+		return fmt.Errorf("%w: %s → %s", ErrInvalidTransition, task.Status.Label(), StatusQueued.Label())
+	}
+	task.Status = StatusQueued
+	task.PendingRecovery = true
+
+	return nil
+}
+
+// FailCompletion переводит завершённую задачу в статус "ошибка", если её архив не удалось сохранить
+// в хранилище архивов: архив сохраняется уже после перехода в статус "завершена", чтобы задача
+// не принимала файлы и не отменялась, пока он сохраняется. Как и RequeueForRecovery, это
+// исключение из statusTransitions: из конечного статуса больше никуда перейти нельзя.
+func (task *Task) FailCompletion(reason string) error {
+	if task.Status != StatusCompleted {
+		return fmt.Errorf("%w: %s → %s", ErrInvalidTransition, task.Status.Label(), StatusFailed.Label())
+	}
+	task.Status = StatusFailed
+	task.LastError = reason
+
+	return nil
+}
+
+// SetStatus переводит задачу в новый статус, проверяя, что переход допустим.
+// При переходе в конечный статус запоминается время завершения задачи.
+func (task *Task) SetStatus(next TaskStatus) error {
+	if task.Status.CanTransitionTo(next) == false {
+		return fmt.Errorf("%w: %s → %s", ErrInvalidTransition, task.Status.Label(), next.Label())
+	}
+	if next != task.Status && next.IsFinal() {
+		task.FinishedAt = time.Now()
+	}
+	task.Status = next
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTaskSetStatus_Transitions(t *testing.T) {
+	task := &Task{Status: StatusCreated}
+
+	assert.NoError(t, task.SetStatus(StatusRunning))
+	assert.NoError(t, task.SetStatus(StatusRunning), "повторный переход в тот же статус допустим")
+	assert.NoError(t, task.SetStatus(StatusCompleted))
+
+	err := task.SetStatus(StatusRunning)
+	assert.ErrorIs(t, err, ErrInvalidTransition, "из завершённой задачи вернуться в работу нельзя")
+	assert.Equal(t, StatusCompleted, task.Status, "при недопустимом переходе статус не меняется")
+
+	task = &Task{Status: StatusCreated}
+	assert.ErrorIs(t, task.SetStatus(StatusCompleted), ErrInvalidTransition, "созданная задача не может сразу завершиться")
+	assert.NoError(t, task.SetStatus(StatusCancelled))
+	assert.True(t, task.Status.IsFinal())
+}
+
+func TestTaskStatus_UnmarshalLegacyLabel(t *testing.T) {
+	var task Task
+	assert.NoError(t, json.Unmarshal([]byte(`{"status":"выполняется"}`), &task))
+	assert.Equal(t, StatusRunning, task.Status)
+	assert.Equal(t, "выполняется", task.Status.Label())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"status":"неизвестно"}`), &task))
+}
@@ -1,26 +1,112 @@
 package model
 
 import (
-	"archive/zip"
-	"os"
+	"context"
+	"time"
+	"workmate_test_project/internal/storage"
+	"workmate_test_project/internal/util"
 )
 
 // Task - структура задачи
 // ID - идентификатор задачи
 // Files - массив файлов
 // FileCountChannel - буферизированный канал, ограничивающий максимальное количество файлов в одной задаче
-// DoneChannel - канал-сигнал завершения (используется для сигнала о том, что архив с файлами готов)
-// ArchiveWriter - для записи файлов в архив
-// ArchiveFile - для закрытия
-// ArchiveLink - ссылка на созданный архив с файлами
+// DoneChannel - канал-сигнал завершения: закрывается, когда задача в конечном статусе и работа с её архивом
+// закончена (у завершённой задачи - архив с файлами сохранён в хранилище архивов)
+// CommitChannel - канал на один элемент, гарантирующий, что в ArchiveWriter пишет только одна горутина
+// ArchiveWriter - для записи файлов в архив (в формате Format)
+// ArchiveOutput - архив в хранилище архивов, в который пишет ArchiveWriter (для завершения или отмены записи)
+// Context - контекст задачи, отменяется через Cancel при отмене или удалении задачи и прерывает скачивания
+// ArchiveLink - имя созданного архива с файлами в хранилище архивов
+// Format - формат архива (zip, tar, tar.gz или tar.zst); у задач, сохранённых до появления форматов, пустой и означает zip
+// Encrypted - файлы архива шифруются WinZip AES-256 паролем Password
+// Password - пароль шифрования архива; хранится только в памяти до закрытия архива и никогда не сохраняется и не логируется
+// Status - статус задачи, меняется только через SetStatus
+// FilesAdded - количество файлов, полностью записанных в архив
+// LastError - последняя ошибка задачи (для статуса StatusFailed - причина ошибки)
+// CreatedAt - время создания задачи; пустое у задач, сохранённых до появления этого поля
+// FinishedAt - время перехода задачи в конечный статус
+// PendingRecovery - после перезапуска для незавершённой задачи не нашлось свободного слота, и она вернулась
+// в очередь ожидания; её архив восстанавливается, когда задача снова получит слот (см. RequeueForRecovery)
+// UsedBytes - сколько байт занимают файлы задачи: записанные в архив, скачанные во временные файлы
+// и зарезервированные под скачивающиеся (см. TaskLimits.MaxTaskSize в service)
+//
+// Поля с тегом json:"-" существуют только в памяти процесса и не сохраняются в хранилище задач.
 type Task struct {
-	ID               int
-	Files            []string
-	FileCountChannel chan struct{}
-	DoneChannel      chan struct{}
-	ArchiveWriter    *zip.Writer
-	ArchiveFile      *os.File
-	ArchiveLink      string
-	Status           string
-	FilesAdded       int
+	ID               int                   `json:"id"`
+	Files            []TaskFile            `json:"files"`
+	FileCountChannel chan struct{}         `json:"-"`
+	DoneChannel      chan struct{}         `json:"-"`
+	CommitChannel    chan struct{}         `json:"-"`
+	ArchiveWriter    util.ArchiveWriter    `json:"-"`
+	ArchiveOutput    storage.ArchiveWriter `json:"-"`
+	Context          context.Context       `json:"-"`
+	Cancel           context.CancelFunc    `json:"-"`
+	ArchiveLink      string                `json:"archiveLink"`
+	Format           util.ArchiveFormat    `json:"format,omitempty"`
+	Encrypted        bool                  `json:"encrypted,omitempty"`
+	Password         string                `json:"-"`
+	Status           TaskStatus            `json:"status"`
+	FilesAdded       int                   `json:"filesAdded"`
+	LastError        string                `json:"lastError,omitempty"`
+	CreatedAt        time.Time             `json:"createdAt,omitzero"`
+	FinishedAt       time.Time             `json:"finishedAt,omitzero"`
+	PendingRecovery  bool                  `json:"pendingRecovery,omitempty"`
+	UsedBytes        int64                 `json:"-"`
 }
+
+// TaskFile - файл, добавленный в задачу
+// ID - идентификатор файла внутри задачи (начиная с 1)
+// Name - имя файла без расширения, переданное клиентом
+// URL - адрес, по которому файл скачивается; пустой у файла, загруженного клиентом (Uploaded)
+// ArchiveName - имя записи внутри архива (Name + расширение по типу содержимого), заполняется после скачивания
+// Status - состояние обработки файла
+// Stored - true, если файл полностью записан в архив
+// Error - ошибка скачивания или записи файла; файл с ошибкой не занимает место в задаче
+// ErrorCode - код ошибки для известных причин (например, превышение лимитов размера), коды FileError* в service
+// Attempts - сколько попыток скачивания сделано (вместе с попытками до перезапуска сервера)
+// LastError - ошибка последней неудачной попытки; после неё скачивание могло быть повторено успешно
+// Size, ContentType, SHA256, DownloadedAt - размер, тип, определённый по содержимому, контрольная сумма и время
+// скачивания файла, заполняются после скачивания (см. Manifest)
+// SpoolPath - временный файл со скачанным содержимым, ожидающим записи в архив
+// CredentialProfile - имя профиля учётных данных из конфигурации сервера, с которыми скачивается файл
+// InlineCredentials - файл скачивается с учётными данными, переданными в запросе
+// Credentials - сами переданные в запросе учётные данные; хранятся только в памяти до окончания скачивания
+// и никогда не сохраняются и не логируются
+// Uploaded - файл загружен клиентом в теле запроса, а не скачан по URL
+// OriginalName - исходное имя загруженного файла у клиента (для манифеста)
+type TaskFile struct {
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	URL          string     `json:"url"`
+	ArchiveName  string     `json:"archiveName"`
+	Status       FileStatus `json:"status,omitempty"`
+	Stored       bool       `json:"stored"`
+	Error        string     `json:"error,omitempty"`
+	ErrorCode    string     `json:"errorCode,omitempty"`
+	Attempts     int        `json:"attempts,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	Size         int64      `json:"size,omitempty"`
+	ContentType  string     `json:"contentType,omitempty"`
+	SHA256       string     `json:"sha256,omitempty"`
+	DownloadedAt time.Time  `json:"downloadedAt,omitzero"`
+	SpoolPath    string     `json:"-"`
+
+	CredentialProfile string            `json:"credentialProfile,omitempty"`
+	InlineCredentials bool              `json:"inlineCredentials,omitempty"`
+	Credentials       *util.Credentials `json:"-"`
+
+	Uploaded     bool   `json:"uploaded,omitempty"`
+	OriginalName string `json:"originalName,omitempty"`
+}
+
+// FileStatus - состояние обработки файла задачи: ожидает в очереди скачивания,
+// скачивается (или загружается клиентом), записан в архив или завершился ошибкой.
+type FileStatus string
+
+const (
+	FilePending     FileStatus = "pending"
+	FileDownloading FileStatus = "downloading"
+	FileStored      FileStatus = "stored"
+	FileFailed      FileStatus = "failed"
+)
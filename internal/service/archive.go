@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+)
+
+var (
+	// ErrArchiveNotReady возвращается, если архив запрошен у задачи, которая ещё не завершена.
+	ErrArchiveNotReady = errors.New("архив задачи ещё не готов")
+	// ErrArchiveNotFound возвращается, если архив завершённой задачи удалён из хранилища архивов.
+	ErrArchiveNotFound = errors.New("архив задачи не найден")
+)
+
+// OpenArchive открывает архив завершённой задачи в хранилище архивов для чтения и возвращает его вместе с копией задачи.
+// Контекст действует и на чтение из архива (см. storage.ArchiveStorage.Open). Закрыть архив должен вызывающий код.
+// Архив доступен только в статусе model.StatusCompleted: до этого он ещё дописывается и не содержит
+// центрального каталога (ErrArchiveNotReady). Если архив завершённой задачи ещё сохраняется, метод дожидается этого.
+func (service *TaskService) OpenArchive(ctx context.Context, taskId int) (storage.ArchiveReader, model.Task, error) {
+	task, err := service.GetTaskSnapshot(ctx, taskId)
+	if err != nil {
+		return nil, model.Task{}, err
+	}
+	if task.Status == model.StatusCompleted {
+		// архив только что завершённой задачи может ещё сохраняться в хранилище архивов (см. finishCompletion)
+		select {
+		case <-task.DoneChannel:
+		case <-ctx.Done():
+			return nil, task, fmt.Errorf("%w: архив ещё сохраняется", ErrArchiveNotReady)
+		}
+		// если архив сохранить не удалось, задача уже в статусе model.StatusFailed
+		if task, err = service.GetTaskSnapshot(ctx, taskId); err != nil {
+			return nil, model.Task{}, err
+		}
+	}
+
+	if task.Status != model.StatusCompleted {
+		return nil, task, fmt.Errorf("%w: задача в статусе %q", ErrArchiveNotReady, task.Status.Label())
+	}
+	if task.ArchiveLink == "" {
+		return nil, task, ErrArchiveNotFound
+	}
+
+	archive, err := service.archives.Open(ctx, task.ArchiveLink)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, task, fmt.Errorf("%w: %s", ErrArchiveNotFound, task.ArchiveLink)
+	}
+	if err != nil {
+		return nil, task, fmt.Errorf("ошибка открытия архива: %w", err)
+	}
+
+	return archive, task, nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"workmate_test_project/internal/model"
+)
+
+// CancelTask отменяет незавершённую задачу.
+//
+// Шаги метода:
+// 1. Задача переводится в статус model.StatusCancelled, её контекст отменяется, что прерывает скачивания.
+// 2. Метод дожидается, пока все скачивания задачи освободят FileCountChannel.
+// 3. Файлы, которые ещё не записаны в архив, помечаются ошибкой.
+// 4. Архив закрывается и удаляется из хранилища архивов (если keepArchive = false, иначе в нём остаются уже записанные файлы).
+// 5. Освобождается слот задачи. Задача из очереди ожидания просто убирается из очереди.
+//
+// Возвращает копию отменённой задачи (см. GetTaskSnapshot): её состояние уже не изменится.
+// Отменённая задача остаётся доступной для запроса статуса, пока её не удалит janitor (см. TaskServiceOptions.CancelledRetention).
+func (service *TaskService) CancelTask(ctx context.Context, taskId int, keepArchive bool) (*model.Task, error) {
+	service.mutex.Lock()
+	task, err := service.GetTaskStatusById(ctx, taskId)
+	if err != nil {
+		service.mutex.Unlock()
+		return nil, fmt.Errorf("не удалось найти задачу: %w", err)
+	}
+
+	if task.Status.IsFinal() {
+		service.mutex.Unlock()
+		return nil, fmt.Errorf("%w: задача уже в статусе %q", model.ErrInvalidTransition, task.Status.Label())
+	}
+	if err := task.SetStatus(model.StatusCancelled); err != nil {
+		service.mutex.Unlock()
+		return nil, err
+	}
+	service.removeFromQueue(task.ID)
+	if err := service.store.Update(task); err != nil {
+		service.mutex.Unlock()
+		return nil, fmt.Errorf("ошибка сохранения задачи: %w", err)
+	}
+	service.mutex.Unlock()
+
+	if err := service.abortTask(task, keepArchive); err != nil {
+		return nil, err
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	snapshot := snapshotTask(task)
+
+	return &snapshot, nil
+}
+
+// DeleteTask удаляет задачу из хранилища.
+// Незавершённая задача перед удалением отменяется так же, как в CancelTask.
+// Архив завершённой задачи удаляется из хранилища архивов, если keepArchive = false. Если архив
+// только что завершённой задачи ещё сохраняется (см. finishCompletion), метод дожидается этого или отмены ctx.
+func (service *TaskService) DeleteTask(ctx context.Context, taskId int, keepArchive bool) error {
+	_, cancelErr := service.CancelTask(ctx, taskId, keepArchive)
+	if errors.Is(cancelErr, model.ErrInvalidTransition) == false && cancelErr != nil {
+		return cancelErr
+	}
+
+	service.mutex.Lock()
+	task, err := service.GetTaskStatusById(ctx, taskId)
+	service.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("не удалось найти задачу: %w", err)
+	}
+
+	select {
+	case <-task.DoneChannel:
+	case <-ctx.Done():
+		return fmt.Errorf("архив задачи ещё сохраняется: %w", ctx.Err())
+	}
+
+	service.mutex.Lock()
+	archiveLink := task.ArchiveLink
+	service.mutex.Unlock()
+	if cancelErr != nil && keepArchive == false && archiveLink != "" {
+		// задача уже была в конечном статусе, её архив закрыт; удаляется он без service.mutex,
+		// так как в S3 это сетевые запросы
+		if _, err := service.removeArchive(archiveLink); err != nil {
+			return fmt.Errorf("ошибка удаления архива: %w", err)
+		}
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if err := service.store.Delete(taskId); err != nil {
+		return fmt.Errorf("ошибка удаления задачи: %w", err)
+	}
+	// сохранённый архив больше не принадлежит сервису и не учитывается в limits.DiskBudget
+	service.releaseTaskBytes(task)
+
+	return nil
+}
+
+// abortTask прерывает скачивания отменённой задачи и освобождает её ресурсы:
+// разрешения FileCountChannel, скачанные, но не записанные в архив временные файлы, архив и слот задачи.
+// Под service.mutex меняется только состояние задачи, архив закрывается и удаляется уже без мьютекса.
+// Когда с архивом покончено, закрывается DoneChannel.
+func (service *TaskService) abortTask(task *model.Task, keepArchive bool) error {
+	defer close(task.DoneChannel)
+	task.Cancel()
+
+	// занимаем все разрешения FileCountChannel: это гарантирует, что ни одно скачивание
+	// больше не пишет в архив, и новые скачивания не начнутся
+	for i := 0; i < cap(task.FileCountChannel); i++ {
+		task.FileCountChannel <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < cap(task.FileCountChannel); i++ {
+			<-task.FileCountChannel
+		}
+	}()
+
+	service.mutex.Lock()
+	service.discardSpooledFiles(task, "задача отменена")
+	// скачивания, которые ещё не завершились, файлы не изменят (см. failFile), поэтому состояние файлов окончательное
+	for i := range task.Files {
+		file := &task.Files[i]
+		if file.Stored == false && file.Error == "" {
+			file.Error = "задача отменена"
+			file.Status = model.FileFailed
+			file.Credentials = nil
+		}
+	}
+
+	archive := detachArchive(task)
+	if archive != nil {
+		service.releaseSlot()
+	}
+	archiveLink := task.ArchiveLink
+	updateErr := service.store.Update(task)
+	service.mutex.Unlock()
+
+	if err := archive.close(keepArchive); err != nil {
+		log.Printf("задача %d: %v", task.ID, err)
+	}
+	if updateErr != nil {
+		return fmt.Errorf("ошибка сохранения задачи: %w", updateErr)
+	}
+	if keepArchive || archiveLink == "" {
+		return nil
+	}
+	if _, err := service.removeArchive(archiveLink); err != nil {
+		return fmt.Errorf("ошибка удаления архива: %w", err)
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	task.ArchiveLink = ""
+	service.releaseTaskBytes(task)
+	if err := service.store.Update(task); err != nil {
+		return fmt.Errorf("ошибка сохранения задачи: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+	"workmate_test_project/internal/store"
+)
+
+func TestCancelTask_AbortsInFlightDownload(t *testing.T) {
+	requestStarted := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		close(requestStarted)
+		<-request.Context().Done()
+	}))
+	defer server.Close()
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:           testDownloadOptions,
+		StorageRoot:        t.TempDir(),
+		CancelledRetention: 300 * time.Millisecond,
+		JanitorInterval:    20 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/file1.pdf", "file1")
+	assert.NoError(t, err)
+	<-requestStarted
+
+	task, err = taskService.CancelTask(context.Background(), task.ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusCancelled, task.Status)
+	assert.Equal(t, model.FileFailed, task.Files[0].Status, "скачивание должно прерваться при отмене задачи")
+	assert.NotEmpty(t, task.Files[0].Error, "у прерванного файла должна быть записана ошибка")
+	assert.Len(t, taskService.tasksSlot, 0, "слот отменённой задачи должен быть освобождён")
+	assert.Len(t, task.FileCountChannel, 0, "разрешения FileCountChannel должны быть освобождены")
+	assert.Empty(t, task.ArchiveLink)
+
+	_, err = taskService.CancelTask(context.Background(), task.ID, false)
+	assert.ErrorIs(t, err, model.ErrInvalidTransition, "повторно отменить задачу нельзя")
+
+	assert.Eventually(t, func() bool {
+		_, err := taskService.store.Get(task.ID)
+		return err != nil
+	}, 3*time.Second, 10*time.Millisecond, "отменённая задача должна быть удалена по истечении срока хранения")
+}
+
+func TestCancelTask_KeepArchive(t *testing.T) {
+	taskService := newTestTaskService(t)
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	archiveLink := task.ArchiveLink
+
+	_, err = taskService.CancelTask(context.Background(), task.ID, true)
+	assert.NoError(t, err)
+	assert.True(t, archiveExists(t, taskService, archiveLink), "архив должен остаться при keepArchive = true")
+
+	task, err = taskService.GetTaskStatusById(context.Background(), task.ID)
+	assert.NoError(t, err, "без срока хранения отменённая задача не удаляется")
+	assert.Equal(t, model.StatusCancelled, task.Status)
+}
+
+func TestDeleteTask_RemovesTaskAndArchive(t *testing.T) {
+	taskService := newTestTaskService(t)
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	archiveLink := task.ArchiveLink
+
+	assert.NoError(t, taskService.DeleteTask(context.Background(), task.ID, false))
+	assert.False(t, archiveExists(t, taskService, archiveLink))
+	assert.Len(t, taskService.tasksSlot, 0)
+
+	_, err = taskService.store.Get(task.ID)
+	assert.ErrorIs(t, err, store.ErrTaskNotFound)
+
+	completed, err := taskService.CreateTask(context.Background(), "", "test2", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.FinalizeTask(context.Background(), completed.ID)
+	assert.NoError(t, err)
+
+	assert.NoError(t, taskService.DeleteTask(context.Background(), completed.ID, false), "завершённую задачу тоже можно удалить")
+	assert.False(t, archiveExists(t, taskService, completed.ArchiveLink))
+}
+
+func TestCancelTask_FailsPendingFiles(t *testing.T) {
+	requestStarted := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requestStarted <- struct{}{}
+		<-request.Context().Done()
+	}))
+	defer server.Close()
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		ArchiveStorage: storage.NewMemoryStorage(),
+		Download:       testDownloadOptions,
+		Limits:         TaskLimits{DownloadWorkers: 1},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	// единственный воркер занят файлом другой задачи, файл отменяемой задачи ждёт в очереди
+	busy, err := taskService.CreateTask(context.Background(), "", "busy", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.AddFileToTask(context.Background(), busy.ID, server.URL+"/busy.pdf", "busy")
+	assert.NoError(t, err)
+	<-requestStarted
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/file1.pdf", "file1")
+	assert.NoError(t, err)
+
+	cancelled, err := taskService.CancelTask(context.Background(), task.ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.FileFailed, cancelled.Files[0].Status, "файл, который ждал в очереди, тоже завершается ошибкой")
+	assert.NotEmpty(t, cancelled.Files[0].Error)
+
+	// задание из очереди после отмены задачи её состояние не меняет
+	_, err = taskService.CancelTask(context.Background(), busy.ID, false)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return len(taskService.jobs) == 0
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	snapshot, err := taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, cancelled.Files, snapshot.Files)
+	assert.Equal(t, cancelled.LastError, snapshot.LastError)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/util"
+)
+
+// commitFiles записывает в архив задачи уже скачанные файлы.
+//
+// util.ArchiveWriter не безопасен для конкурентного использования, поэтому:
+// 1. В архив пишет только горутина, занявшая task.CommitChannel, остальные ждут своей очереди.
+// 2. Файлы записываются в порядке их добавления в задачу: если следующий по порядку файл ещё
+// скачивается, запись останавливается, и её продолжит горутина, которая этот файл скачает
+// (или пометит ошибкой).
+//
+// Каждый записанный временный файл удаляется. После записи последнего файла задача завершается.
+func (service *TaskService) commitFiles(task *model.Task) error {
+	task.CommitChannel <- struct{}{}
+	defer func() {
+		<-task.CommitChannel
+	}()
+
+	for {
+		service.mutex.Lock()
+		file := nextFileToCommit(task)
+		if file == nil || file.SpoolPath == "" || task.ArchiveWriter == nil || task.Context.Err() != nil {
+			service.mutex.Unlock()
+			return nil
+		}
+		fileId, archiveName, spoolPath, archiveWriter := file.ID, file.ArchiveName, file.SpoolPath, task.ArchiveWriter
+		service.mutex.Unlock()
+
+		commitErr := util.AddSpoolToArchive(archiveWriter, archiveName, spoolPath)
+		if err := os.Remove(spoolPath); err != nil && errors.Is(err, os.ErrNotExist) == false {
+			log.Printf("ошибка удаления временного файла %s: %v", spoolPath, err)
+		}
+
+		if err := service.storeCommittedFile(task, fileId, commitErr); err != nil {
+			return err
+		}
+	}
+}
+
+// storeCommittedFile отмечает результат записи файла в архив и сохраняет задачу.
+// Если файла в задаче уже нет (или он помечен ошибкой, например при отмене задачи), отмечать нечего.
+// Если записан последний файл задачи, задача завершается, а её архив сохраняется уже без service.mutex (см. completeTask).
+func (service *TaskService) storeCommittedFile(task *model.Task, fileId int, commitErr error) error {
+	service.mutex.Lock()
+	file := findTaskFile(task, fileId)
+	if file == nil {
+		service.mutex.Unlock()
+		log.Printf("задача %d: файл %d записан в архив, но в задаче его уже нет", task.ID, fileId)
+		return nil
+	}
+	file.SpoolPath = ""
+
+	var completion *taskCompletion
+	if commitErr != nil {
+		file.Error = fmt.Sprintf("ошибка обработки файла: %v", commitErr)
+		file.Status = model.FileFailed
+		service.useBytes(task, -file.Size)
+		task.LastError = fmt.Sprintf("%s: %s", file.ArchiveName, file.Error)
+	} else {
+		file.Stored = true
+		file.Status = model.FileStored
+		task.FilesAdded++
+
+		if task.FilesAdded == service.limits.MaxFilesPerTask {
+			var err error
+			if completion, err = service.completeTask(task); err != nil {
+				service.mutex.Unlock()
+				return err
+			}
+		}
+	}
+
+	if completion == nil {
+		err := service.store.Update(task)
+		service.mutex.Unlock()
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения задачи: %w", err)
+		}
+		return nil
+	}
+	service.mutex.Unlock()
+
+	// задачу вместе с отмеченным файлом сохраняет finishCompletion
+	return service.finishCompletion(completion)
+}
+
+// nextFileToCommit возвращает первый по порядку добавления файл задачи, который ещё не записан в архив
+// и не завершился ошибкой.
+// Вызывается под service.mutex.
+func nextFileToCommit(task *model.Task) *model.TaskFile {
+	for i := range task.Files {
+		if task.Files[i].Stored == false && task.Files[i].Error == "" {
+			return &task.Files[i]
+		}
+	}
+
+	return nil
+}
+
+// discardSpooledFiles удаляет временные файлы, которые скачались, но уже не будут записаны в архив,
+// и освобождает занятое ими место.
+// Если reason не пустой, такие файлы помечаются ошибкой, иначе остаются ожидать повторного скачивания.
+// Вызывается под service.mutex.
+func (service *TaskService) discardSpooledFiles(task *model.Task, reason string) {
+	for i := range task.Files {
+		file := &task.Files[i]
+		if file.SpoolPath == "" {
+			continue
+		}
+
+		if err := os.Remove(file.SpoolPath); err != nil && errors.Is(err, os.ErrNotExist) == false {
+			log.Printf("ошибка удаления временного файла %s: %v", file.SpoolPath, err)
+		}
+		file.SpoolPath = ""
+		service.useBytes(task, -file.Size)
+
+		if reason != "" {
+			file.Error = reason
+			file.Status = model.FileFailed
+		} else {
+			file.Status = model.FilePending
+		}
+	}
+}
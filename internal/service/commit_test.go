@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"workmate_test_project/internal/model"
+)
+
+// TestCommitFiles_ConcurrentDownloadsStress добавляет в задачу много файлов, которые скачиваются параллельно
+// и отдаются сервером в случайном порядке, и проверяет, что архив читается целиком,
+// записи в нём идут в порядке добавления файлов, а содержимое не перемешано.
+// Тест имеет смысл запускать с -race.
+func TestCommitFiles_ConcurrentDownloadsStress(t *testing.T) {
+	const filesCount = 40
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(time.Duration(rand.IntN(20)) * time.Millisecond)
+		writer.Header().Set("Content-Type", "application/pdf")
+		// содержимое достаточно большое, чтобы запись одного файла не укладывалась в один вызов Write
+		io.WriteString(writer, "%PDF-1.7\n"+strings.Repeat(request.URL.Path+"\n", 4096))
+	}))
+	defer server.Close()
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:    testDownloadOptions,
+		StorageRoot: t.TempDir(),
+		Limits: TaskLimits{
+			MaxFilesPerTask:     filesCount,
+			DownloadConcurrency: 8,
+			DownloadWorkers:     16,
+		},
+		SpoolDir: t.TempDir(),
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.CreateTask(context.Background(), "", "stress", "", "")
+	assert.NoError(t, err)
+
+	// AddFileToTask только ставит файлы в очередь, поэтому все они скачиваются одновременно
+	for i := 0; i < filesCount; i++ {
+		_, err := taskService.AddFileToTask(context.Background(), task.ID,
+			fmt.Sprintf("%s/file%02d.pdf", server.URL, i), fmt.Sprintf("file%02d", i))
+		assert.NoError(t, err)
+	}
+
+	select {
+	case <-task.DoneChannel:
+	case <-time.After(10 * time.Second):
+		t.Fatal("задача должна завершиться после записи всех файлов")
+	}
+
+	snapshot, err := taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusCompleted, snapshot.Status)
+	assert.Equal(t, filesCount, snapshot.FilesAdded)
+
+	reader, err := readTestArchive(t, taskService, snapshot.ArchiveLink)
+	assert.NoError(t, err, "архив должен открываться")
+	assert.Len(t, reader.File, filesCount+1, "после файлов в архив записывается манифест")
+
+	for i, entry := range reader.File[:filesCount] {
+		expected := snapshot.Files[i]
+		assert.Equal(t, i+1, expected.ID)
+		assert.Equal(t, expected.ArchiveName, entry.Name, "записи должны идти в порядке добавления файлов")
+
+		entryReader, err := entry.Open()
+		assert.NoError(t, err)
+		content, err := io.ReadAll(entryReader)
+		assert.NoError(t, err, "контрольная сумма записи %s должна сходиться", entry.Name)
+		entryReader.Close()
+
+		assert.Equal(t, "%PDF-1.7\n"+strings.Repeat("/"+entry.Name+"\n", 4096), string(content),
+			"содержимое записи %s не должно перемешиваться", entry.Name)
+	}
+}
+
+func TestStoreCommittedFile_MissingFile(t *testing.T) {
+	taskService := newTestTaskService(t)
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+
+	assert.NotPanics(t, func() {
+		assert.NoError(t, taskService.storeCommittedFile(task, 1, nil), "файла могло уже не стать в задаче")
+	})
+	snapshot, err := taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Zero(t, snapshot.FilesAdded)
+}
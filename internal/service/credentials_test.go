@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+	"workmate_test_project/internal/util"
+)
+
+func TestAddFileToTaskWithAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		username, password, _ := request.BasicAuth()
+		authorized := map[string]bool{
+			"/profile.pdf":  request.Header.Get("Authorization") == "Bearer profile-token",
+			"/inline.pdf":   username == "user" && password == "inline-secret",
+			"/userinfo.pdf": username == "user" && password == "url-secret",
+		}
+		if authorized[request.URL.Path] == false {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(writer, "%PDF-1.7 содержимое "+request.URL.Path)
+	}))
+	defer server.Close()
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		ArchiveStorage:     storage.NewMemoryStorage(),
+		Download:           testDownloadOptions,
+		Limits:             TaskLimits{MaxFilesPerTask: 5},
+		CredentialProfiles: map[string]util.Credentials{"reports": {BearerToken: "profile-token"}},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+
+	_, err = taskService.AddFileToTaskWithAuth(context.Background(), task.ID, server.URL+"/profile.pdf", "file1",
+		FileAuth{Profile: "unknown"})
+	assert.ErrorIs(t, err, ErrUnknownCredentialProfile)
+	_, err = taskService.AddFileToTaskWithAuth(context.Background(), task.ID, server.URL+"/profile.pdf", "file1",
+		FileAuth{Profile: "reports", Credentials: util.Credentials{BearerToken: "other"}})
+	assert.ErrorIs(t, err, util.ErrInvalidCredentials, "профиль и учётные данные одновременно")
+	_, err = taskService.AddFileToTaskWithAuth(context.Background(), task.ID, server.URL+"/inline.pdf", "file1",
+		FileAuth{Credentials: util.Credentials{Headers: map[string]string{"X-Api-Key": "a\nb"}}})
+	assert.ErrorIs(t, err, util.ErrInvalidCredentials)
+
+	_, err = taskService.AddFileToTaskWithAuth(context.Background(), task.ID, server.URL+"/profile.pdf", "file1",
+		FileAuth{Profile: "reports"})
+	assert.NoError(t, err)
+	_, err = taskService.AddFileToTaskWithAuth(context.Background(), task.ID, server.URL+"/inline.pdf", "file2",
+		FileAuth{Credentials: util.Credentials{Username: "user", Password: "inline-secret"}})
+	assert.NoError(t, err)
+	userinfoURL := strings.Replace(server.URL, "http://", "http://user:url-secret@", 1) + "/userinfo.pdf"
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, userinfoURL, "file3")
+	assert.NoError(t, err)
+
+	snapshot := waitForFiles(t, taskService, task.ID)
+	for _, file := range snapshot.Files {
+		assert.Equal(t, model.FileStored, file.Status, file.Name+": "+file.Error)
+		assert.Nil(t, file.Credentials, "после скачивания учётные данные не хранятся")
+	}
+	assert.Equal(t, "reports", snapshot.Files[0].CredentialProfile)
+	assert.Equal(t, server.URL+"/userinfo.pdf", snapshot.Files[2].URL, "логин и пароль удаляются из адреса")
+
+	persisted, err := json.Marshal(snapshot)
+	assert.NoError(t, err)
+	manifest, err := json.Marshal(snapshot.Manifest())
+	assert.NoError(t, err)
+	for _, secret := range []string{"profile-token", "inline-secret", "url-secret"} {
+		assert.NotContains(t, string(persisted), secret, "учётные данные не сохраняются в хранилище задач")
+		assert.NotContains(t, string(manifest), secret, "учётные данные не попадают в манифест")
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	taskService := &TaskService{credentialProfiles: map[string]util.Credentials{"reports": {BearerToken: "token"}}}
+
+	credentials, err := taskService.fileCredentials(model.TaskFile{CredentialProfile: "reports"})
+	assert.NoError(t, err)
+	assert.Equal(t, "token", credentials.BearerToken)
+
+	_, err = taskService.fileCredentials(model.TaskFile{CredentialProfile: "removed"})
+	assert.ErrorIs(t, err, ErrUnknownCredentialProfile, "профиль мог пропасть из конфигурации после перезапуска")
+
+	// после перезапуска у файла остаётся только признак InlineCredentials, сами учётные данные не сохраняются
+	_, err = taskService.fileCredentials(model.TaskFile{InlineCredentials: true})
+	assert.ErrorIs(t, err, ErrCredentialsLost)
+	assert.Equal(t, FileErrorCredentialsLost, fileErrorCode(err))
+
+	credentials, err = taskService.fileCredentials(model.TaskFile{})
+	assert.NoError(t, err)
+	assert.Nil(t, credentials, "файл без авторизации")
+
+	_, err = NewTaskServiceWithOptions(TaskServiceOptions{
+		ArchiveStorage:     storage.NewMemoryStorage(),
+		CredentialProfiles: map[string]util.Credentials{"broken": {BearerToken: "a", Username: "b"}},
+	})
+	assert.ErrorIs(t, err, util.ErrInvalidCredentials, "некорректный профиль - ошибка создания сервиса")
+}
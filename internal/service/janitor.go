@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+	"workmate_test_project/internal/model"
+)
+
+// janitorMetrics - счётчики фоновой очистки, доступны по /debug/vars в разделе "janitor".
+var janitorMetrics = expvar.NewMap("janitor")
+
+const defaultJanitorInterval = time.Minute
+
+// startJanitor запускает горутину, которая раз в interval удаляет задачи с истёкшим сроком хранения.
+// Если ни для одного статуса срок хранения не задан, janitor не запускается.
+func (service *TaskService) startJanitor(interval time.Duration) {
+	enabled := false
+	for _, retention := range service.retention {
+		if retention > 0 {
+			enabled = true
+		}
+	}
+	if enabled == false {
+		return
+	}
+
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	service.janitorCancel = cancel
+	service.janitorDone = make(chan struct{})
+
+	go func() {
+		defer close(service.janitorDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				service.sweepExpiredTasks(time.Now())
+			}
+		}
+	}()
+}
+
+// Close останавливает фоновые горутины сервиса (janitor и пул скачивания файлов) и дожидается их завершения.
+// Хранилище архивов, переданное в TaskServiceOptions.ArchiveStorage, закрывает вызывающий код.
+func (service *TaskService) Close() {
+	if service.janitorCancel != nil {
+		service.janitorCancel()
+		<-service.janitorDone
+	}
+	service.stopWorkers()
+	if service.closeArchives {
+		service.archives.Close()
+	}
+}
+
+// sweepExpiredTasks удаляет задачи в конечных статусах, срок хранения которых истёк к моменту now,
+// вместе с их архивами, и сообщает об удалённом в лог и в janitorMetrics.
+//
+// Под service.mutex задачи только удаляются из хранилища задач. Архивы удаляются уже без мьютекса:
+// в S3 это сетевые запросы, и медленное хранилище не должно останавливать API и скачивания.
+// Архив, который не удалось удалить, остаётся в хранилище архивов, ошибка пишется в лог.
+func (service *TaskService) sweepExpiredTasks(now time.Time) {
+	removed := service.removeExpiredTasks(now)
+
+	removedArchives, freedBytes := 0, int64(0)
+	for _, task := range removed {
+		if task.ArchiveLink == "" {
+			continue
+		}
+		size, err := service.removeArchive(task.ArchiveLink)
+		if err != nil {
+			log.Printf("janitor: ошибка удаления архива задачи %d: %v", task.ID, err)
+			continue
+		}
+		if size >= 0 {
+			removedArchives++
+			freedBytes += size
+		}
+	}
+
+	janitorMetrics.Add("sweeps", 1)
+	janitorMetrics.Add("archives_removed", int64(removedArchives))
+	janitorMetrics.Add("bytes_freed", freedBytes)
+	if len(removed) > 0 {
+		log.Printf("janitor: удалено задач: %d, архивов: %d, освобождено байт: %d", len(removed), removedArchives, freedBytes)
+	}
+}
+
+// removeExpiredTasks удаляет из хранилища задач задачи, срок хранения которых истёк к моменту now,
+// и возвращает копии удалённых задач (см. sweepExpiredTasks).
+func (service *TaskService) removeExpiredTasks(now time.Time) []model.Task {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	tasks, err := service.store.List()
+	if err != nil {
+		log.Printf("janitor: ошибка загрузки задач: %v", err)
+		return nil
+	}
+
+	var removed []model.Task
+	for _, task := range tasks {
+		retention := service.retention[task.Status]
+		if task.Status.IsFinal() == false || retention <= 0 || now.Before(task.FinishedAt.Add(retention)) {
+			continue
+		}
+		if taskDone(task) == false {
+			// архив задачи ещё сохраняется или удаляется без service.mutex (см. finishCompletion, abortTask)
+			continue
+		}
+
+		if err := service.store.Delete(task.ID); err != nil {
+			log.Printf("janitor: ошибка удаления задачи %d: %v", task.ID, err)
+			continue
+		}
+		// архив удалённой задачи больше не учитывается в limits.DiskBudget
+		service.releaseTaskBytes(task)
+		removed = append(removed, snapshotTask(task))
+		janitorMetrics.Add("tasks_removed_"+string(task.Status), 1)
+		log.Printf("janitor: удалена задача %d (статус %q, завершена %s)",
+			task.ID, task.Status.Label(), task.FinishedAt.Format(time.RFC3339))
+	}
+
+	return removed
+}
+
+// taskDone сообщает, закрыт ли DoneChannel задачи, то есть закончена ли работа с её архивом.
+func taskDone(task *model.Task) bool {
+	select {
+	case <-task.DoneChannel:
+		return true
+	default:
+		return false
+	}
+}
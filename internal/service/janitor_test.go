@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/store"
+)
+
+func TestSweepExpiredTasks_RemovesExpiredTasksAndArchives(t *testing.T) {
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:           testDownloadOptions,
+		StorageRoot:        t.TempDir(),
+		CompletedRetention: time.Hour,
+		JanitorInterval:    time.Hour,
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	completed, err := taskService.CreateTask(context.Background(), "", "completed", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.FinalizeTask(context.Background(), completed.ID)
+	assert.NoError(t, err)
+
+	cancelled, err := taskService.CreateTask(context.Background(), "", "cancelled", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.CancelTask(context.Background(), cancelled.ID, true)
+	assert.NoError(t, err)
+
+	taskService.sweepExpiredTasks(time.Now())
+	_, err = taskService.store.Get(completed.ID)
+	assert.NoError(t, err, "задача с неистёкшим сроком хранения не должна удаляться")
+	assert.True(t, archiveExists(t, taskService, completed.ArchiveLink))
+
+	taskService.sweepExpiredTasks(time.Now().Add(2 * time.Hour))
+	_, err = taskService.store.Get(completed.ID)
+	assert.ErrorIs(t, err, store.ErrTaskNotFound, "задача с истёкшим сроком хранения должна быть удалена")
+	assert.False(t, archiveExists(t, taskService, completed.ArchiveLink), "архив удалённой задачи должен быть удалён")
+
+	task, err := taskService.store.Get(cancelled.ID)
+	assert.NoError(t, err, "для отменённых задач срок хранения не задан, поэтому они не удаляются")
+	assert.Equal(t, model.StatusCancelled, task.Status)
+}
+
+func TestClose_StopsJanitor(t *testing.T) {
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:        testDownloadOptions,
+		StorageRoot:     t.TempDir(),
+		FailedRetention: time.Minute,
+		JanitorInterval: time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		taskService.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close должен дождаться остановки janitor")
+	}
+}
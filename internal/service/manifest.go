@@ -0,0 +1,50 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/util"
+)
+
+// GetManifest возвращает манифест файлов, записанных в архив задачи, - тот же, что записывается
+// в архив (model.ManifestFileName) при её завершении. Пока задача не завершена, в манифесте
+// только уже записанные файлы.
+func (service *TaskService) GetManifest(ctx context.Context, taskId int) (model.Manifest, error) {
+	task, err := service.GetTaskSnapshot(ctx, taskId)
+	if err != nil {
+		return model.Manifest{}, err
+	}
+
+	return task.Manifest(), nil
+}
+
+// writeManifest записывает в архив манифест model.ManifestFileName и, если включено
+// writeChecksums, файл контрольных сумм model.ChecksumsFileName.
+// Вызывается при завершении задачи без service.mutex, когда архив уже отсоединён от задачи (см. completeTask).
+func (service *TaskService) writeManifest(archiveWriter util.ArchiveWriter, manifest model.Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("ошибка формирования манифеста: %w", err)
+	}
+
+	entries := map[string][]byte{model.ManifestFileName: data}
+	names := []string{model.ManifestFileName}
+	if service.writeChecksums {
+		entries[model.ChecksumsFileName] = []byte(manifest.Checksums())
+		names = append(names, model.ChecksumsFileName)
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		content := entries[name]
+		if err := archiveWriter.AddFile(name, int64(len(content)), now, bytes.NewReader(content)); err != nil {
+			return fmt.Errorf("ошибка записи %s в архив: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+)
+
+func TestFinalizeTask_WritesManifest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/missing.pdf" {
+			http.NotFound(writer, request)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(writer, "%PDF-1.7 содержимое "+request.URL.Path)
+	}))
+	defer server.Close()
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:       testDownloadOptions,
+		ArchiveStorage: storage.NewMemoryStorage(),
+		WriteChecksums: true,
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/docs/contract.pdf", "file1")
+	assert.NoError(t, err)
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/missing.pdf", "file2")
+	assert.NoError(t, err)
+	waitForFiles(t, taskService, task.ID)
+
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/manifest.pdf", "manifest")
+	assert.NoError(t, err, "имя записи зарезервировано целиком, а не по имени без расширения")
+	waitForFiles(t, taskService, task.ID)
+
+	_, err = taskService.FinalizeTask(context.Background(), task.ID)
+	assert.NoError(t, err)
+
+	manifest, err := taskService.GetManifest(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, task.ID, manifest.TaskID)
+	assert.False(t, manifest.FinishedAt.IsZero())
+	assert.Len(t, manifest.Files, 2, "файл с ошибкой не должен попадать в манифест")
+	entry := manifest.Files[0]
+	sum := sha256.Sum256([]byte("%PDF-1.7 содержимое /docs/contract.pdf"))
+	assert.Equal(t, server.URL+"/docs/contract.pdf", entry.URL)
+	assert.Equal(t, "contract.pdf", entry.OriginalName)
+	assert.Equal(t, "file1", entry.Name)
+	assert.Equal(t, "file1.pdf", entry.ArchiveName)
+	assert.Equal(t, int64(len("%PDF-1.7 содержимое /docs/contract.pdf")), entry.Size)
+	assert.Equal(t, "application/pdf", entry.ContentType)
+	assert.Equal(t, hex.EncodeToString(sum[:]), entry.SHA256)
+	assert.False(t, entry.DownloadedAt.IsZero())
+
+	reader, err := readTestArchive(t, taskService, task.ArchiveLink)
+	assert.NoError(t, err)
+	names := make([]string, 0, len(reader.File))
+	contents := map[string][]byte{}
+	for _, file := range reader.File {
+		entryReader, err := file.Open()
+		assert.NoError(t, err)
+		content, err := io.ReadAll(entryReader)
+		assert.NoError(t, err)
+		entryReader.Close()
+		names = append(names, file.Name)
+		contents[file.Name] = content
+	}
+	assert.Equal(t, []string{"file1.pdf", "manifest.pdf", model.ManifestFileName, model.ChecksumsFileName}, names)
+
+	var archived model.Manifest
+	assert.NoError(t, json.Unmarshal(contents[model.ManifestFileName], &archived))
+	assert.Equal(t, manifest.Files[0].SHA256, archived.Files[0].SHA256, "манифест в архиве должен совпадать с манифестом из API")
+	assert.Equal(t, manifest.Files[1].ArchiveName, archived.Files[1].ArchiveName)
+	assert.Equal(t, manifest.Checksums(), string(contents[model.ChecksumsFileName]))
+	assert.Contains(t, string(contents[model.ChecksumsFileName]), hex.EncodeToString(sum[:])+"  file1.pdf\n")
+}
+
+func TestAddFileToTask_RejectsManifestName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		io.WriteString(writer, `{"files": []}`)
+	}))
+	defer server.Close()
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:       testDownloadOptions,
+		ArchiveStorage: storage.NewMemoryStorage(),
+		Limits:         TaskLimits{AllowedMIMETypes: []string{"application/json"}},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/data", "manifest")
+	assert.NoError(t, err, "имя записи становится известно только после скачивания")
+
+	snapshot := waitForFiles(t, taskService, task.ID)
+	assert.Equal(t, model.FileFailed, snapshot.Files[0].Status, "файл не должен подменять манифест архива")
+	assert.Contains(t, snapshot.Files[0].Error, model.ManifestFileName)
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/util"
+)
+
+// BusyPolicy - поведение CreateTask, когда заняты все слоты активных задач.
+type BusyPolicy string
+
+const (
+	// BusyPolicyReject - сразу возвращать ErrServerBusy (поведение по умолчанию).
+	BusyPolicyReject BusyPolicy = "reject"
+	// BusyPolicyQueue - ставить задачу в очередь ожидания в статусе model.StatusQueued,
+	// она запустится автоматически, когда освободится слот.
+	BusyPolicyQueue BusyPolicy = "queue"
+)
+
+// defaultQueueSize - размер очереди ожидания, если он не задан в TaskServiceOptions.QueueSize.
+const defaultQueueSize = 10
+
+var (
+	// ErrQueueFull возвращается, если заняты все слоты активных задач и очередь ожидания заполнена.
+	ErrQueueFull = errors.New("очередь задач заполнена")
+	// ErrTaskQueued возвращается, если задача ещё ждёт слота в очереди и не принимает файлы.
+	ErrTaskQueued = errors.New("задача ожидает в очереди")
+)
+
+// QueueSize возвращает размер очереди ожидания или 0, если задачи при занятом сервере отклоняются.
+func (service *TaskService) QueueSize() int {
+	if service.busyPolicy != BusyPolicyQueue {
+		return 0
+	}
+
+	return service.queueSize
+}
+
+// QueuePosition возвращает позицию задачи в очереди ожидания, начиная с 1.
+// Если задача не ожидает слота, возвращается 0.
+func (service *TaskService) QueuePosition(taskId int) int {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	return slices.Index(service.queue, taskId) + 1
+}
+
+// enqueueTask создаёт задачу в статусе model.StatusQueued без архива и ставит её в конец очереди ожидания.
+// Архив создаётся при запуске задачи в activateQueued.
+func (service *TaskService) enqueueTask(ctx context.Context, archivePath string, archiveName string,
+	format util.ArchiveFormat, password string) (*model.Task, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if len(service.queue) >= service.queueSize {
+		return nil, ErrQueueFull
+	}
+
+	// пустой архив сохраняется сразу, чтобы занять имя до запуска задачи
+	archive, archiveLink, err := service.createArchive(ctx, service.id+1, archivePath, archiveName, format)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания архива: %w", err)
+	}
+	if err := archive.Finalize(); err != nil {
+		return nil, fmt.Errorf("ошибка создания архива: %w", err)
+	}
+	service.id++
+
+	taskCtx, taskCancel := context.WithCancel(context.Background())
+	task := &model.Task{
+		ID:               service.id,
+		Files:            []model.TaskFile{},
+		FileCountChannel: make(chan struct{}, service.limits.DownloadConcurrency),
+		DoneChannel:      make(chan struct{}),
+		CommitChannel:    make(chan struct{}, 1),
+		Context:          taskCtx,
+		Cancel:           taskCancel,
+		Status:           model.StatusQueued,
+		ArchiveLink:      archiveLink,
+		CreatedAt:        time.Now(),
+		Format:           format,
+		Encrypted:        password != "",
+		Password:         password,
+	}
+	if err := service.store.Create(task); err != nil {
+		taskCancel()
+		return nil, fmt.Errorf("ошибка сохранения задачи: %w", err)
+	}
+
+	service.queue = append(service.queue, task.ID)
+	// слот мог освободиться, пока задача ставилась в очередь
+	service.activateQueued()
+
+	return task, nil
+}
+
+// releaseSlot освобождает слот активной задачи.
+// Если в очереди ожидания есть задачи, слот сразу передаётся первой из них, поэтому
+// новая задача, созданная в этот момент через CreateTask, не может обогнать очередь.
+// Вызывается под service.mutex.
+func (service *TaskService) releaseSlot() {
+	if service.startNextQueued() == false {
+		<-service.tasksSlot
+	}
+}
+
+// activateQueued запускает задачи из начала очереди ожидания, пока есть свободные слоты.
+// Вызывается под service.mutex.
+func (service *TaskService) activateQueued() {
+	for len(service.queue) > 0 {
+		select {
+		case service.tasksSlot <- struct{}{}:
+		default:
+			return
+		}
+
+		if service.startNextQueued() == false {
+			<-service.tasksSlot
+			return
+		}
+	}
+}
+
+// startNextQueued запускает первую задачу из очереди ожидания в уже занятом для неё слоте:
+// создаёт архив задачи и переводит её в статус model.StatusCreated. Архив задачи, отложенной при перезапуске
+// (model.Task.PendingRecovery), не создаётся заново, а восстанавливается в resumeRecovery.
+// Если архив создать не удалось, задача переводится в статус model.StatusFailed, а слот достаётся следующей.
+// Возвращает false, если в очереди не осталось задач, которые можно запустить.
+// Вызывается под service.mutex.
+func (service *TaskService) startNextQueued() bool {
+	for len(service.queue) > 0 {
+		taskId := service.queue[0]
+		service.queue = service.queue[1:]
+
+		task, err := service.store.Get(taskId)
+		if err != nil || task.Status != model.StatusQueued {
+			continue
+		}
+
+		if task.PendingRecovery {
+			// архив незавершённой задачи, отложенной при перезапуске, читается из хранилища долго,
+			// поэтому восстанавливается в фоне, не задерживая освобождение слота
+			log.Printf("задача %d получила слот, восстанавливается архив", task.ID)
+			go service.resumeRecovery(task)
+			return true
+		}
+
+		archive, archiveWriter, err := service.reopenArchive(task)
+		if err != nil {
+			log.Printf("ошибка создания архива задачи %d из очереди: %v", task.ID, err)
+			if err := task.SetStatus(model.StatusFailed); err != nil {
+				log.Printf("задача %d: %v", task.ID, err)
+			}
+			task.LastError = fmt.Sprintf("ошибка создания архива: %v", err)
+			task.Cancel()
+			close(task.DoneChannel)
+			if err := service.store.Update(task); err != nil {
+				log.Printf("ошибка сохранения задачи %d: %v", task.ID, err)
+			}
+			continue
+		}
+
+		task.ArchiveOutput = archive
+		task.ArchiveWriter = archiveWriter
+		if err := task.SetStatus(model.StatusCreated); err != nil {
+			log.Printf("задача %d: %v", task.ID, err)
+		}
+		if err := service.store.Update(task); err != nil {
+			log.Printf("ошибка сохранения задачи %d: %v", task.ID, err)
+		}
+		log.Printf("задача %d запущена из очереди, в очереди осталось %d", task.ID, len(service.queue))
+
+		return true
+	}
+
+	return false
+}
+
+// removeFromQueue убирает задачу из очереди ожидания, например при её отмене.
+// Вызывается под service.mutex.
+func (service *TaskService) removeFromQueue(taskId int) {
+	service.queue = slices.DeleteFunc(service.queue, func(id int) bool {
+		return id == taskId
+	})
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"workmate_test_project/internal/model"
+)
+
+func newQueueTestService(t *testing.T, queueSize int) *TaskService {
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:    testDownloadOptions,
+		StorageRoot: t.TempDir(),
+		Limits:      TaskLimits{MaxActiveTasks: 1},
+		BusyPolicy:  BusyPolicyQueue,
+		QueueSize:   queueSize,
+	})
+	assert.NoError(t, err)
+
+	return taskService
+}
+
+func TestCreateTask_QueuedWhenBusy(t *testing.T) {
+	taskService := newQueueTestService(t, 2)
+
+	first, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusCreated, first.Status)
+
+	second, err := taskService.CreateTask(context.Background(), "", "test2", "", "")
+	assert.NoError(t, err, "при занятых слотах задача должна ставиться в очередь")
+	assert.Equal(t, model.StatusQueued, second.Status)
+	assert.Equal(t, 1, taskService.QueuePosition(second.ID))
+	info, err := taskService.archives.Stat(context.Background(), second.ArchiveLink)
+	assert.NoError(t, err, "имя архива задачи в очереди занимается сразу")
+	assert.Zero(t, info.Size, "сам архив задачи в очереди создаётся только при её запуске")
+
+	third, err := taskService.CreateTask(context.Background(), "", "test3", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, taskService.QueuePosition(third.ID))
+
+	_, err = taskService.CreateTask(context.Background(), "", "test4", "", "")
+	assert.ErrorIs(t, err, ErrQueueFull, "очередь ограничена QueueSize")
+
+	_, err = taskService.AddFileToTask(context.Background(), second.ID, "https://example.com/file.pdf", "file")
+	assert.ErrorIs(t, err, ErrTaskQueued, "задача в очереди не принимает файлы")
+	_, err = taskService.FinalizeTask(context.Background(), second.ID)
+	assert.ErrorIs(t, err, ErrTaskQueued)
+
+	_, err = taskService.FinalizeTask(context.Background(), first.ID)
+	assert.NoError(t, err)
+
+	assert.Equal(t, model.StatusCreated, second.Status, "после освобождения слота задача из очереди должна запуститься")
+	assert.Equal(t, 0, taskService.QueuePosition(second.ID))
+	assert.Equal(t, 1, taskService.QueuePosition(third.ID), "позиции оставшихся задач должны сдвинуться")
+	assert.True(t, archiveExists(t, taskService, second.ArchiveLink), "архив запущенной задачи должен быть создан")
+}
+
+func TestCancelTask_RemovesFromQueue(t *testing.T) {
+	taskService := newQueueTestService(t, 3)
+
+	var tasks []*model.Task
+	for i := 0; i < 3; i++ {
+		task, err := taskService.CreateTask(context.Background(), "", fmt.Sprintf("test%d", i), "", "")
+		assert.NoError(t, err)
+		tasks = append(tasks, task)
+	}
+
+	_, err := taskService.CancelTask(context.Background(), tasks[1].ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusCancelled, tasks[1].Status)
+	assert.Equal(t, 0, taskService.QueuePosition(tasks[1].ID))
+	assert.Equal(t, 1, taskService.QueuePosition(tasks[2].ID))
+
+	_, err = taskService.CancelTask(context.Background(), tasks[0].ID, false)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusCreated, tasks[2].Status, "слот отменённой задачи должен достаться следующей в очереди")
+}
+
+func TestCreateTask_RejectPolicyIsDefault(t *testing.T) {
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{StorageRoot: t.TempDir(), Limits: TaskLimits{MaxActiveTasks: 1}, Download: testDownloadOptions})
+	assert.NoError(t, err)
+
+	_, err = taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.CreateTask(context.Background(), "", "test2", "", "")
+	assert.ErrorIs(t, err, ErrServerBusy)
+
+	_, err = NewTaskServiceWithOptions(TaskServiceOptions{BusyPolicy: "wait"})
+	assert.Error(t, err, "неизвестная политика должна отклоняться")
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/util"
+)
+
+var (
+	// ErrFileTooLarge возвращается, если файл больше limits.MaxFileSize.
+	ErrFileTooLarge = errors.New("файл превышает максимальный размер")
+	// ErrTaskTooLarge возвращается, если файлы задачи вместе превышают limits.MaxTaskSize.
+	ErrTaskTooLarge = errors.New("файлы задачи превышают максимальный размер задачи")
+	// ErrDiskBudgetExceeded возвращается, если файлы всех задач вместе превышают limits.DiskBudget.
+	ErrDiskBudgetExceeded = errors.New("исчерпано место, отведённое сервису под файлы")
+)
+
+// Коды ошибок файлов задачи (model.TaskFile.ErrorCode), по которым клиент может отличить причину,
+// не разбирая текст ошибки.
+const (
+	FileErrorTooLarge          = "file_too_large"
+	FileErrorTaskTooLarge      = "task_too_large"
+	FileErrorDiskBudget        = "disk_budget_exceeded"
+	FileErrorUnsupportedType   = "unsupported_type"
+	FileErrorForbiddenURL      = "forbidden_url"
+	FileErrorCredentialsLost   = "credentials_lost"
+	FileErrorUploadInterrupted = "upload_interrupted"
+)
+
+// fileErrorCode возвращает код ошибки файла для известных причин или пустую строку.
+func fileErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrFileTooLarge):
+		return FileErrorTooLarge
+	case errors.Is(err, ErrTaskTooLarge):
+		return FileErrorTaskTooLarge
+	case errors.Is(err, ErrDiskBudgetExceeded):
+		return FileErrorDiskBudget
+	case errors.Is(err, util.ErrUnsupportedMIMEType):
+		return FileErrorUnsupportedType
+	case errors.Is(err, util.ErrURLForbidden):
+		return FileErrorForbiddenURL
+	case errors.Is(err, ErrCredentialsLost):
+		return FileErrorCredentialsLost
+	case errors.Is(err, ErrUploadInterrupted):
+		return FileErrorUploadInterrupted
+	default:
+		return ""
+	}
+}
+
+// downloadQuota резервирует место под один скачиваемый файл задачи task сразу в трёх лимитах:
+// limits.MaxFileSize (reserved - сколько уже зарезервировано под этот файл), limits.MaxTaskSize
+// (task.UsedBytes) и limits.DiskBudget (service.diskUsage).
+type downloadQuota struct {
+	service  *TaskService
+	task     *model.Task
+	reserved int64
+}
+
+func (quota *downloadQuota) Reserve(size int64) error {
+	service := quota.service
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	switch {
+	case service.limits.MaxFileSize > 0 && quota.reserved+size > service.limits.MaxFileSize:
+		return fmt.Errorf("%w (%d байт)", ErrFileTooLarge, service.limits.MaxFileSize)
+	case service.limits.MaxTaskSize > 0 && quota.task.UsedBytes+size > service.limits.MaxTaskSize:
+		return fmt.Errorf("%w (%d байт)", ErrTaskTooLarge, service.limits.MaxTaskSize)
+	case service.limits.DiskBudget > 0 && service.diskUsage+size > service.limits.DiskBudget:
+		return fmt.Errorf("%w (%d байт)", ErrDiskBudgetExceeded, service.limits.DiskBudget)
+	}
+
+	quota.reserved += size
+	service.useBytes(quota.task, size)
+
+	return nil
+}
+
+// shrink уменьшает резерв до size байт: до реального размера скачанного файла
+// или до нуля, если файл не скачался. Вызывается под service.mutex.
+func (quota *downloadQuota) shrink(size int64) {
+	quota.service.useBytes(quota.task, size-quota.reserved)
+	quota.reserved = size
+}
+
+// release освобождает всё место, зарезервированное под файл.
+func (quota *downloadQuota) release() {
+	quota.service.mutex.Lock()
+	defer quota.service.mutex.Unlock()
+
+	quota.shrink(0)
+}
+
+// checkQuota проверяет, что в задачу ещё можно добавить файл: место, отведённое задаче и сервису, не исчерпано.
+// Вызывается под service.mutex.
+func (service *TaskService) checkQuota(task *model.Task) error {
+	if service.limits.MaxTaskSize > 0 && task.UsedBytes >= service.limits.MaxTaskSize {
+		return fmt.Errorf("%w (%d байт)", ErrTaskTooLarge, service.limits.MaxTaskSize)
+	}
+	if service.limits.DiskBudget > 0 && service.diskUsage >= service.limits.DiskBudget {
+		return fmt.Errorf("%w (%d байт)", ErrDiskBudgetExceeded, service.limits.DiskBudget)
+	}
+
+	return nil
+}
+
+// useBytes учитывает size байт (отрицательный size - освобождение) в размере задачи и в месте, занятом сервисом.
+// Вызывается под service.mutex.
+func (service *TaskService) useBytes(task *model.Task, size int64) {
+	task.UsedBytes += size
+	service.diskUsage += size
+}
+
+// releaseTaskBytes освобождает всё место задачи, когда её архив удалён или задача больше не хранится в сервисе.
+// Вызывается под service.mutex.
+func (service *TaskService) releaseTaskBytes(task *model.Task) {
+	service.useBytes(task, -task.UsedBytes)
+}
+
+// storedBytes возвращает суммарный размер файлов задачи, записанных в архив.
+func storedBytes(task *model.Task) int64 {
+	var size int64
+	for _, file := range task.Files {
+		if file.Stored {
+			size += file.Size
+		}
+	}
+
+	return size
+}
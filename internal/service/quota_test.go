@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+)
+
+// newSizedFileServer отдаёт PDF размером, указанным в пути: /<размер>/<имя>.pdf.
+func newSizedFileServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		size, _ := strconv.Atoi(strings.Split(request.URL.Path, "/")[1])
+		writer.Header().Set("Content-Type", "application/pdf")
+		if request.URL.Query().Get("chunked") == "" {
+			writer.Header().Set("Content-Length", strconv.Itoa(size))
+		}
+		io.WriteString(writer, "%PDF-"+strings.Repeat("0", size-len("%PDF-")))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestDownloadFile_SizeLimits(t *testing.T) {
+	server := newSizedFileServer(t)
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:       testDownloadOptions,
+		ArchiveStorage: storage.NewMemoryStorage(),
+		Limits:         TaskLimits{MaxFilesPerTask: 10, MaxFileSize: 100, MaxTaskSize: 250, DiskBudget: -1},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	for i, fileURL := range []string{"/200/big.pdf", "/200/big.pdf?chunked=1", "/90/a.pdf", "/90/b.pdf", "/90/c.pdf?chunked=1"} {
+		_, err := taskService.AddFileToTask(context.Background(), task.ID, server.URL+fileURL, strconv.Itoa(i+1))
+		assert.NoError(t, err)
+		waitForFiles(t, taskService, task.ID)
+	}
+
+	snapshot, err := taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, FileErrorTooLarge, snapshot.Files[0].ErrorCode, "файл больше лимита отклоняется по Content-Length")
+	assert.Equal(t, FileErrorTooLarge, snapshot.Files[1].ErrorCode, "файл без Content-Length отклоняется при скачивании")
+	assert.Equal(t, model.FileStored, snapshot.Files[2].Status)
+	assert.Equal(t, model.FileStored, snapshot.Files[3].Status)
+	assert.Equal(t, model.FileFailed, snapshot.Files[4].Status)
+	assert.Equal(t, FileErrorTaskTooLarge, snapshot.Files[4].ErrorCode)
+	assert.Equal(t, int64(180), snapshot.UsedBytes, "место отклонённых файлов должно освобождаться")
+	assert.Equal(t, int64(180), taskService.diskUsage)
+
+	_, err = taskService.FinalizeTask(context.Background(), task.ID)
+	assert.NoError(t, err)
+	reader, err := readTestArchive(t, taskService, task.ArchiveLink)
+	assert.NoError(t, err)
+	assert.Len(t, reader.File, 3, "в архив не должны попадать недокачанные записи")
+}
+
+func TestDownloadFile_DiskBudget(t *testing.T) {
+	server := newSizedFileServer(t)
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:       testDownloadOptions,
+		ArchiveStorage: storage.NewMemoryStorage(),
+		Limits:         TaskLimits{MaxFilesPerTask: 10, DiskBudget: 150},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	first, err := taskService.CreateTask(context.Background(), "", "first", "", "")
+	assert.NoError(t, err)
+	second, err := taskService.CreateTask(context.Background(), "", "second", "", "")
+	assert.NoError(t, err)
+
+	_, err = taskService.AddFileToTask(context.Background(), first.ID, server.URL+"/100/a.pdf", "a")
+	assert.NoError(t, err)
+	waitForFiles(t, taskService, first.ID)
+	_, err = taskService.AddFileToTask(context.Background(), second.ID, server.URL+"/100/b.pdf?chunked=1", "b")
+	assert.NoError(t, err)
+	snapshot := waitForFiles(t, taskService, second.ID)
+	assert.Equal(t, FileErrorDiskBudget, snapshot.Files[0].ErrorCode, "лимит места общий для всех задач")
+
+	_, err = taskService.AddFileToTask(context.Background(), first.ID, server.URL+"/50/c.pdf", "c")
+	assert.NoError(t, err)
+	waitForFiles(t, taskService, first.ID)
+	_, err = taskService.AddFileToTask(context.Background(), second.ID, server.URL+"/10/d.pdf", "d")
+	assert.ErrorIs(t, err, ErrDiskBudgetExceeded, "при исчерпанном месте файл не принимается в задачу")
+
+	assert.NoError(t, taskService.DeleteTask(context.Background(), first.ID, false))
+	assert.Zero(t, taskService.diskUsage, "место удалённой задачи освобождается")
+	_, err = taskService.AddFileToTask(context.Background(), second.ID, server.URL+"/100/d.pdf", "d")
+	assert.NoError(t, err)
+	snapshot = waitForFiles(t, taskService, second.ID)
+	assert.Equal(t, model.FileStored, snapshot.Files[1].Status)
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+	"workmate_test_project/internal/util"
+)
+
+// errNoTaskSlot возвращается recoverTask, если после перезапуска для задачи не нашлось свободного слота.
+var errNoTaskSlot = errors.New("нет свободного слота для задачи")
+
+// recoverUnfinishedTasks - проход восстановления, который выполняется при запуске сервиса.
+//
+// Если процесс упал, пока задача была в незавершённом статусе ("создана" или "выполняется"), её архив остался
+// без центрального каталога. Для каждой такой задачи:
+// 1. Занимается слот задачи, как при её создании.
+// 2. Архив пересобирается из записей, которые успели полностью записаться (util.RecoverArchive).
+// Незавершённый архив видно не во всех хранилищах (например, в S3 его нет до завершения загрузки),
+// поэтому без архива восстанавливается только задача, в архив которой ещё ничего не было записано.
+// 3. Файлы задачи, которых нет в восстановленном архиве, заново ставятся на скачивание.
+//
+// Если свободного слота нет (например, уменьшился tasks.max_active_tasks), задача откладывается (см. deferRecovery).
+// Если архив восстановить не удалось, задача переводится в статус model.StatusFailed с указанием причины.
+// Задачи с шифрованием архива не восстанавливаются: пароль не сохраняется (ErrArchivePasswordLost).
+func (service *TaskService) recoverUnfinishedTasks() {
+	tasks, err := service.store.List()
+	if err != nil {
+		log.Printf("ошибка загрузки задач для восстановления: %v", err)
+		return
+	}
+
+	type requeuedFile struct {
+		task   *model.Task
+		fileId int
+	}
+	var requeued []requeuedFile
+
+	for _, task := range tasks {
+		if task.Status.IsFinal() || task.Status == model.StatusQueued {
+			continue
+		}
+
+		missing, err := service.recoverTask(task)
+		if errors.Is(err, errNoTaskSlot) {
+			service.deferRecovery(task)
+			continue
+		}
+		if err != nil {
+			log.Printf("не удалось восстановить архив задачи %d: %v", task.ID, err)
+			service.failTask(task, fmt.Sprintf("архив не удалось восстановить после перезапуска: %v", err))
+			continue
+		}
+
+		log.Printf("задача %d восстановлена: файлов в архиве %d, повторно скачивается %d",
+			task.ID, task.FilesAdded, len(missing))
+		for _, fileId := range missing {
+			requeued = append(requeued, requeuedFile{task: task, fileId: fileId})
+		}
+	}
+
+	for _, file := range requeued {
+		go service.requeueFile(file.task, file.fileId)
+	}
+}
+
+// recoverTask занимает слот для незавершённой задачи и пересобирает её архив (см. restoreTaskArchive).
+// Возвращает ID файлов, которые нужно скачать повторно, или errNoTaskSlot, если свободного слота нет.
+func (service *TaskService) recoverTask(task *model.Task) ([]int, error) {
+	if task.Encrypted {
+		return nil, ErrArchivePasswordLost
+	}
+
+	select {
+	case service.tasksSlot <- struct{}{}:
+	default:
+		return nil, errNoTaskSlot
+	}
+
+	return service.restoreTaskArchive(task)
+}
+
+// deferRecovery обрабатывает незавершённую задачу, для которой после перезапуска не нашлось свободного слота.
+//
+// При BusyPolicyQueue задача возвращается в очередь ожидания в статусе model.StatusQueued (на место по порядку
+// создания), а её архив восстанавливается, когда она получит слот (см. resumeRecovery).
+// Иначе задача завершается ошибкой с указанием причины, но уже записанные файлы не теряются:
+// архив пересобирается и остаётся в хранилище архивов.
+func (service *TaskService) deferRecovery(task *model.Task) {
+	if service.busyPolicy == BusyPolicyQueue {
+		service.mutex.Lock()
+		defer service.mutex.Unlock()
+
+		if err := task.RequeueForRecovery(); err != nil {
+			log.Printf("задача %d: %v", task.ID, err)
+			return
+		}
+		position, _ := slices.BinarySearch(service.queue, task.ID)
+		service.queue = slices.Insert(service.queue, position, task.ID)
+		if err := service.store.Update(task); err != nil {
+			log.Printf("ошибка сохранения задачи %d: %v", task.ID, err)
+		}
+		log.Printf("задача %d ждёт свободного слота, её архив будет восстановлен при запуске", task.ID)
+		return
+	}
+
+	reason := "после перезапуска не нашлось свободного слота для задачи (tasks.max_active_tasks)"
+	archive, archiveWriter, recoveredNames, err := util.RecoverArchive(context.Background(), service.archives,
+		task.ArchiveLink, task.Format, service.compressionLevel(task.Format), service.spoolDir)
+	if err == nil {
+		err = (&taskArchive{writer: archiveWriter, output: archive}).close(true)
+	}
+	if err != nil {
+		log.Printf("не удалось сохранить архив задачи %d: %v", task.ID, err)
+		reason += fmt.Sprintf(", архив не удалось восстановить: %v", err)
+	} else {
+		reason += ", уже записанные файлы сохранены в архиве"
+	}
+
+	service.mutex.Lock()
+	for _, fileId := range applyRecoveredFiles(task, recoveredNames) {
+		file := findTaskFile(task, fileId)
+		file.Error = reason
+		file.Status = model.FileFailed
+	}
+	service.useBytes(task, storedBytes(task)-task.UsedBytes)
+	service.mutex.Unlock()
+
+	log.Printf("задача %d: %s", task.ID, reason)
+	service.failTask(task, reason)
+}
+
+// resumeRecovery восстанавливает архив задачи, которая ждала в очереди после перезапуска (см. deferRecovery)
+// и получила слот, и ставит на скачивание файлы, которых нет в архиве.
+func (service *TaskService) resumeRecovery(task *model.Task) {
+	missing, err := service.restoreTaskArchive(task)
+	if err != nil {
+		log.Printf("не удалось восстановить архив задачи %d: %v", task.ID, err)
+		service.failTask(task, fmt.Sprintf("архив не удалось восстановить после перезапуска: %v", err))
+		return
+	}
+
+	log.Printf("задача %d восстановлена из очереди: файлов в архиве %d, повторно скачивается %d",
+		task.ID, task.FilesAdded, len(missing))
+	for _, fileId := range missing {
+		service.requeueFile(task, fileId)
+	}
+}
+
+// restoreTaskArchive пересобирает архив одной незавершённой задачи, для которой уже занят слот, и возвращает
+// ID файлов, которые нужно скачать повторно. При ошибке слот освобождается.
+// Архив читается без service.mutex: задача в это время не активна и не принимает файлы.
+func (service *TaskService) restoreTaskArchive(task *model.Task) ([]int, error) {
+	output, archiveWriter, recoveredNames, err := util.RecoverArchive(context.Background(), service.archives,
+		task.ArchiveLink, task.Format, service.compressionLevel(task.Format), service.spoolDir)
+	if errors.Is(err, storage.ErrNotFound) && task.FilesAdded == 0 {
+		// в архив ещё ничего не было записано, поэтому его можно просто создать заново
+		output, archiveWriter, err = service.reopenArchive(task)
+	}
+
+	service.mutex.Lock()
+	if err != nil {
+		service.releaseSlot()
+		service.mutex.Unlock()
+		return nil, err
+	}
+
+	if task.Status.IsFinal() {
+		// задачу отменили, пока она ждала в очереди и восстанавливался архив
+		service.releaseSlot()
+		service.mutex.Unlock()
+		if err := (&taskArchive{writer: archiveWriter, output: output}).close(true); err != nil {
+			log.Printf("задача %d: %v", task.ID, err)
+		}
+		return nil, nil
+	}
+
+	task.ArchiveOutput = output
+	task.ArchiveWriter = archiveWriter
+	missing, completion, err := service.resumeRestoredTask(task, recoveredNames)
+	service.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if completion != nil {
+		// все файлы задачи уже в архиве: архив сохраняется без service.mutex, см. completeTask
+		if err := service.finishCompletion(completion); err != nil {
+			return nil, err
+		}
+	}
+
+	return missing, nil
+}
+
+// resumeRestoredTask возвращает в работу задачу, архив которой восстановлен (recoveredNames - имена его записей),
+// и возвращает ID файлов, которые нужно скачать повторно. Если в архиве уже все файлы задачи, задача завершается,
+// и возвращается её незаконченное завершение (см. completeTask).
+// Вызывается под service.mutex.
+func (service *TaskService) resumeRestoredTask(task *model.Task, recoveredNames []string) ([]int, *taskCompletion, error) {
+	if task.Status == model.StatusQueued {
+		if err := task.SetStatus(model.StatusCreated); err != nil {
+			return nil, nil, err
+		}
+	}
+	task.PendingRecovery = false
+
+	missing := applyRecoveredFiles(task, recoveredNames)
+
+	// файлы, которых не оказалось в архиве, больше не занимают место
+	service.useBytes(task, storedBytes(task)-task.UsedBytes)
+
+	if task.FilesAdded >= service.limits.MaxFilesPerTask {
+		completion, err := service.completeTask(task)
+		if err != nil {
+			return nil, nil, err
+		}
+		// задачу вместе с восстановленными файлами сохраняет finishCompletion
+		return missing, completion, nil
+	}
+	if countActiveFiles(task) > 0 {
+		if err := task.SetStatus(model.StatusRunning); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := service.store.Update(task); err != nil {
+		return nil, nil, fmt.Errorf("ошибка сохранения задачи: %w", err)
+	}
+
+	return missing, nil, nil
+}
+
+// applyRecoveredFiles отмечает записанными файлы задачи, которые нашлись в восстановленном архиве
+// (recoveredNames - имена его записей), пересчитывает task.FilesAdded и возвращает ID остальных файлов,
+// которые снова ожидают скачивания.
+func applyRecoveredFiles(task *model.Task, recoveredNames []string) []int {
+	recovered := make(map[string]struct{}, len(recoveredNames))
+	for _, name := range recoveredNames {
+		recovered[name] = struct{}{}
+	}
+
+	task.FilesAdded = 0
+	var missing []int
+	for i := range task.Files {
+		if task.Files[i].Error != "" {
+			continue
+		}
+		_, task.Files[i].Stored = recovered[task.Files[i].ArchiveName]
+		if task.Files[i].Stored {
+			task.Files[i].Status = model.FileStored
+			task.FilesAdded++
+		} else {
+			task.Files[i].Status = model.FilePending
+			missing = append(missing, task.Files[i].ID)
+		}
+	}
+
+	return missing
+}
+
+// failTask переводит задачу в статус model.StatusFailed с указанной причиной.
+func (service *TaskService) failTask(task *model.Task, reason string) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	if err := task.SetStatus(model.StatusFailed); err != nil {
+		log.Printf("задача %d: %v", task.ID, err)
+		return
+	}
+	task.LastError = reason
+	task.ArchiveOutput = nil
+	task.ArchiveWriter = nil
+	task.Password = ""
+	close(task.DoneChannel)
+
+	if err := service.store.Update(task); err != nil {
+		log.Printf("ошибка сохранения задачи %d: %v", task.ID, err)
+	}
+}
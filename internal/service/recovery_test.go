@@ -0,0 +1,248 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+	"workmate_test_project/internal/store"
+)
+
+func TestRecoverUnfinishedTasks_RebuildsArchiveAndRequeuesMissingFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(writer, "%PDF-1.7 содержимое "+request.URL.Path)
+	}))
+	defer server.Close()
+
+	archiveDir := t.TempDir()
+	archive, err := os.Create(filepath.Join(archiveDir, "task_1.zip"))
+	assert.NoError(t, err)
+	zipWriter := zip.NewWriter(archive)
+	for _, name := range []string{"file1.pdf", "file2.pdf", "file3.pdf"} {
+		entry, err := zipWriter.Create(name)
+		assert.NoError(t, err)
+		io.WriteString(entry, "содержимое /"+name)
+	}
+	// имитируем падение процесса: zip.Writer так и не был закрыт
+	assert.NoError(t, zipWriter.Flush())
+	assert.NoError(t, archive.Close())
+
+	journalStore, err := store.OpenJournalStore(filepath.Join(t.TempDir(), "tasks.journal"))
+	assert.NoError(t, err)
+	defer journalStore.Close()
+
+	files := make([]model.TaskFile, 0, 3)
+	for _, name := range []string{"file1", "file2", "file3"} {
+		files = append(files, model.TaskFile{
+			Name:        name,
+			URL:         server.URL + "/" + name + ".pdf",
+			ArchiveName: name + ".pdf",
+			Stored:      name != "file3",
+		})
+	}
+	assert.NoError(t, journalStore.Create(&model.Task{
+		ID:    1,
+		Files: files,
+		// полный путь до архива - так ссылки на архивы хранились в журнале до появления хранилищ архивов
+		ArchiveLink: archiveDir + "/task_1.zip",
+		Status:      model.StatusRunning,
+		FilesAdded:  2,
+	}))
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{Store: journalStore, StorageRoot: archiveDir, Download: testDownloadOptions})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		taskService.mutex.Lock()
+		defer taskService.mutex.Unlock()
+		task, _ := taskService.GetTaskStatusById(context.Background(), 1)
+		return task.Status == model.StatusCompleted
+	}, 5*time.Second, 10*time.Millisecond, "недостающий файл должен быть скачан повторно, а задача завершена")
+
+	reader, err := zip.OpenReader(archiveDir + "/task_1.zip")
+	assert.NoError(t, err, "восстановленный архив должен открываться")
+	defer reader.Close()
+
+	names := make([]string, 0, len(reader.File))
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	assert.ElementsMatch(t, []string{"file1.pdf", "file2.pdf", "file3.pdf", "manifest.json"}, names)
+}
+
+func TestRecoverUnfinishedTasks_MarksTaskFailedWithoutArchive(t *testing.T) {
+	journalStore, err := store.OpenJournalStore(filepath.Join(t.TempDir(), "tasks.journal"))
+	assert.NoError(t, err)
+	defer journalStore.Close()
+
+	assert.NoError(t, journalStore.Create(&model.Task{
+		ID: 1,
+		Files: []model.TaskFile{
+			{Name: "file1", URL: "https://example.com/file1.pdf", ArchiveName: "file1.pdf", Stored: true},
+		},
+		ArchiveLink: "missing.zip",
+		Status:      model.StatusRunning,
+		FilesAdded:  1,
+	}))
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{Store: journalStore, ArchiveStorage: storage.NewMemoryStorage(), Download: testDownloadOptions})
+	assert.NoError(t, err)
+
+	task, err := taskService.GetTaskStatusById(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusFailed, task.Status)
+	assert.NotEmpty(t, task.LastError, "у задачи должна быть указана причина ошибки")
+	assert.Len(t, taskService.tasksSlot, 0, "слот упавшей задачи должен быть освобождён")
+}
+
+func TestRecoverUnfinishedTasks_FailsEncryptedTask(t *testing.T) {
+	journalStore, err := store.OpenJournalStore(filepath.Join(t.TempDir(), "tasks.journal"))
+	assert.NoError(t, err)
+	defer journalStore.Close()
+
+	archives := storage.NewMemoryStorage()
+	for _, name := range []string{"running.zip", "queued.zip"} {
+		archive, err := archives.Create(context.Background(), name, false)
+		assert.NoError(t, err)
+		assert.NoError(t, archive.Finalize())
+	}
+	assert.NoError(t, journalStore.Create(&model.Task{
+		ID: 1, ArchiveLink: "running.zip", Status: model.StatusCreated, Encrypted: true,
+	}))
+	assert.NoError(t, journalStore.Create(&model.Task{
+		ID: 2, ArchiveLink: "queued.zip", Status: model.StatusQueued, Encrypted: true,
+	}))
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{Store: journalStore, ArchiveStorage: archives, Download: testDownloadOptions})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	for _, taskId := range []int{1, 2} {
+		task, err := taskService.GetTaskSnapshot(context.Background(), taskId)
+		assert.NoError(t, err)
+		assert.Equal(t, model.StatusFailed, task.Status, "без пароля архив нельзя продолжить незашифрованным")
+		assert.Contains(t, task.LastError, ErrArchivePasswordLost.Error())
+	}
+}
+
+// writeUnfinishedZIP создаёт в dir архив name с записями entries без центрального каталога,
+// как если бы процесс упал во время записи архива.
+func writeUnfinishedZIP(t *testing.T, dir string, name string, entries ...string) {
+	archive, err := os.Create(filepath.Join(dir, name))
+	assert.NoError(t, err)
+	zipWriter := zip.NewWriter(archive)
+	for _, entry := range entries {
+		writer, err := zipWriter.Create(entry)
+		assert.NoError(t, err)
+		io.WriteString(writer, "содержимое /"+entry)
+	}
+	// запись файла считается полной, только когда за ней начата следующая: эта так и остаётся недописанной
+	_, err = zipWriter.Create("недописанный.pdf")
+	assert.NoError(t, err)
+	assert.NoError(t, zipWriter.Flush())
+	assert.NoError(t, archive.Close())
+}
+
+// newNoSlotRecoveryStore создаёт журнал с двумя незавершёнными задачами, у второй из которых
+// один файл записан в архив, а второй нужно скачать заново.
+func newNoSlotRecoveryStore(t *testing.T, archiveDir string, serverURL string) *store.JournalStore {
+	writeUnfinishedZIP(t, archiveDir, "task_1.zip", "file1.pdf")
+	writeUnfinishedZIP(t, archiveDir, "task_2.zip", "file1.pdf")
+
+	journalStore, err := store.OpenJournalStore(filepath.Join(t.TempDir(), "tasks.journal"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { journalStore.Close() })
+
+	for _, taskId := range []int{1, 2} {
+		files := []model.TaskFile{{ID: 1, Name: "file1", URL: serverURL + "/file1.pdf", ArchiveName: "file1.pdf", Stored: true}}
+		if taskId == 2 {
+			files = append(files, model.TaskFile{ID: 2, Name: "file2", URL: serverURL + "/file2.pdf"})
+		}
+		assert.NoError(t, journalStore.Create(&model.Task{
+			ID:          taskId,
+			Files:       files,
+			ArchiveLink: fmt.Sprintf("task_%d.zip", taskId),
+			Status:      model.StatusRunning,
+			FilesAdded:  1,
+		}))
+	}
+
+	return journalStore
+}
+
+func TestRecoverUnfinishedTasks_QueuesTaskWithoutSlot(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(writer, "%PDF-1.7 содержимое "+request.URL.Path)
+	}))
+	defer server.Close()
+
+	archiveDir := t.TempDir()
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Store:       newNoSlotRecoveryStore(t, archiveDir, server.URL),
+		StorageRoot: archiveDir,
+		Download:    testDownloadOptions,
+		Limits:      TaskLimits{MaxActiveTasks: 1},
+		BusyPolicy:  BusyPolicyQueue,
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.GetTaskSnapshot(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusQueued, task.Status, "задача без слота ждёт в очереди, а не завершается ошибкой")
+	assert.Equal(t, 1, taskService.QueuePosition(2))
+
+	_, err = taskService.FinalizeTask(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		task, err := taskService.GetTaskSnapshot(context.Background(), 2)
+		return err == nil && task.FilesAdded == 2
+	}, 5*time.Second, 10*time.Millisecond, "получив слот, задача восстанавливает архив и докачивает файлы")
+
+	finalized, err := taskService.FinalizeTask(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.False(t, finalized.PendingRecovery)
+	reader, err := zip.OpenReader(filepath.Join(archiveDir, "task_2.zip"))
+	assert.NoError(t, err)
+	defer reader.Close()
+	names := make([]string, 0, len(reader.File))
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	assert.ElementsMatch(t, []string{"file1.pdf", "file2.pdf", "manifest.json"}, names, "записанный до перезапуска файл сохранён")
+}
+
+func TestRecoverUnfinishedTasks_KeepsArchiveWithoutSlot(t *testing.T) {
+	archiveDir := t.TempDir()
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Store:       newNoSlotRecoveryStore(t, archiveDir, "http://127.0.0.1:1"),
+		StorageRoot: archiveDir,
+		Download:    testDownloadOptions,
+		Limits:      TaskLimits{MaxActiveTasks: 1},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.GetTaskSnapshot(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusFailed, task.Status)
+	assert.Contains(t, task.LastError, "свободного слота", "в статусе указана причина")
+	assert.True(t, task.Files[0].Stored)
+	assert.Equal(t, model.FileFailed, task.Files[1].Status)
+
+	reader, err := zip.OpenReader(filepath.Join(archiveDir, "task_2.zip"))
+	assert.NoError(t, err, "архив с уже записанными файлами сохраняется")
+	defer reader.Close()
+	assert.Len(t, reader.File, 1)
+}
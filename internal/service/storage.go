@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+	"workmate_test_project/internal/util"
+)
+
+// CollisionPolicy определяет, что делать, если архив с запрошенным именем уже существует.
+type CollisionPolicy string
+
+const (
+	// CollisionReject - отклонять создание задачи (ErrArchiveExists).
+	CollisionReject CollisionPolicy = "reject"
+	// CollisionSuffix - добавлять к имени архива суффикс "_1", "_2", ... до первого свободного имени.
+	CollisionSuffix CollisionPolicy = "suffix"
+	// CollisionOverwrite - перезаписывать существующий архив, если он не принадлежит другой задаче.
+	CollisionOverwrite CollisionPolicy = "overwrite"
+)
+
+// defaultStorageRoot - корневой каталог архивов по умолчанию (если хранилище архивов не задано).
+const defaultStorageRoot = "./data/archives"
+
+// maxNameSuffix - сколько суффиксов перебирается при политике CollisionSuffix.
+const maxNameSuffix = 1000
+
+var (
+	// ErrInvalidArchivePath возвращается, если путь или имя архива выходят за пределы корневого каталога архивов.
+	ErrInvalidArchivePath = errors.New("недопустимый путь архива")
+	// ErrArchiveExists возвращается, если архив с таким именем уже существует (или принадлежит другой задаче).
+	ErrArchiveExists = errors.New("архив с таким именем уже существует")
+	// ErrArchivePasswordLost возвращается, если архив задачи с шифрованием нужно открыть заново после перезапуска:
+	// пароль хранится только в памяти процесса.
+	ErrArchivePasswordLost = errors.New("пароль архива не сохраняется и утерян после перезапуска сервера")
+)
+
+// createArchive открывает на запись архив задачи taskId в подкаталоге archiveDir хранилища архивов
+// и возвращает его вместе с именем в хранилище (ArchiveLink задачи).
+// archiveDir должен быть относительным путём без выхода наверх ("" - корень хранилища),
+// archiveName - именем файла без каталогов (расширение формата format, например ".tar.gz", добавляется автоматически).
+// Если имя не задано, оно генерируется ("task_<ID>"), и при совпадении к нему всегда добавляется суффикс.
+// Иначе совпадение имён разрешается по service.collisionPolicy.
+// Вызывается под service.mutex, поэтому две задачи не могут получить одно и то же имя.
+func (service *TaskService) createArchive(ctx context.Context, taskId int, archiveDir string,
+	archiveName string, format util.ArchiveFormat) (storage.ArchiveWriter, string, error) {
+	archiveDir = filepath.Clean(archiveDir)
+	if archiveDir != "." && filepath.IsLocal(archiveDir) == false {
+		return nil, "", fmt.Errorf("%w: каталог %q вне корневого каталога архивов", ErrInvalidArchivePath, archiveDir)
+	}
+
+	policy := service.collisionPolicy
+	archiveName = strings.TrimSuffix(archiveName, format.Extension())
+	if archiveName == "" {
+		archiveName = fmt.Sprintf("task_%d", taskId)
+		policy = CollisionSuffix
+	}
+	if archiveName == "." || archiveName == ".." || strings.ContainsAny(archiveName, `/\`) {
+		return nil, "", fmt.Errorf("%w: имя архива %q", ErrInvalidArchivePath, archiveName)
+	}
+
+	for i := 0; i <= maxNameSuffix; i++ {
+		name := archiveName
+		if i > 0 {
+			name = fmt.Sprintf("%s_%d", archiveName, i)
+		}
+		archiveLink := path.Join(filepath.ToSlash(archiveDir), name+format.Extension())
+
+		var archive storage.ArchiveWriter
+		err := storage.ErrExists
+		if service.archiveInUse(archiveLink) == false {
+			archive, err = service.archives.Create(ctx, archiveLink, policy == CollisionOverwrite)
+		}
+		if errors.Is(err, storage.ErrExists) {
+			if policy == CollisionSuffix {
+				continue
+			}
+			return nil, "", fmt.Errorf("%w: %s", ErrArchiveExists, archiveLink)
+		}
+		if errors.Is(err, storage.ErrInvalidName) {
+			return nil, "", fmt.Errorf("%w: %v", ErrInvalidArchivePath, err)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		return archive, archiveLink, nil
+	}
+
+	return nil, "", fmt.Errorf("%w: не найдено свободного имени для %q", ErrArchiveExists, archiveName)
+}
+
+// archiveInUse проверяет, ссылается ли на архив archiveLink какая-либо задача из хранилища.
+// Такой архив нельзя перезаписать: его удаление вместе с задачей удалило бы и новый архив.
+func (service *TaskService) archiveInUse(archiveLink string) bool {
+	tasks, err := service.store.List()
+	if err != nil {
+		// при ошибке хранилища считаем архив занятым, чтобы ничего не перезаписать
+		return true
+	}
+
+	for _, task := range tasks {
+		if task.ArchiveLink == archiveLink {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reopenArchive заново открывает на запись пустой архив задачи (по имени ArchiveLink), например при запуске
+// задачи из очереди или при восстановлении после перезапуска.
+func (service *TaskService) reopenArchive(task *model.Task) (storage.ArchiveWriter, util.ArchiveWriter, error) {
+	if task.Encrypted && task.Password == "" {
+		return nil, nil, ErrArchivePasswordLost
+	}
+
+	archive, err := service.archives.Create(context.Background(), task.ArchiveLink, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка создания архива: %w", err)
+	}
+
+	archiveWriter, err := service.newArchiveWriter(task.Format, task.Password, archive)
+	if err != nil {
+		archive.Abort()
+		return nil, nil, fmt.Errorf("ошибка создания архива: %w", err)
+	}
+
+	return archive, archiveWriter, nil
+}
+
+// newArchiveWriter создаёт запись архива формата format в output с настроенным для формата уровнем сжатия.
+// Непустой password включает шифрование архива.
+func (service *TaskService) newArchiveWriter(format util.ArchiveFormat, password string,
+	output storage.ArchiveWriter) (util.ArchiveWriter, error) {
+	return util.NewArchiveWriter(format, output, service.compressionLevel(format), password)
+}
+
+// compressionLevel возвращает уровень сжатия формата из TaskServiceOptions.CompressionLevels
+// или уровень по умолчанию.
+func (service *TaskService) compressionLevel(format util.ArchiveFormat) int {
+	if level, exist := service.compressionLevels[format]; exist {
+		return level
+	}
+
+	return format.DefaultCompressionLevel()
+}
+
+// removeArchive удаляет архив из хранилища архивов и возвращает его размер.
+// Если архива уже нет, возвращается -1 без ошибки.
+func (service *TaskService) removeArchive(archiveLink string) (int64, error) {
+	ctx := context.Background()
+
+	info, err := service.archives.Stat(ctx, archiveLink)
+	if errors.Is(err, storage.ErrNotFound) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := service.archives.Delete(ctx, archiveLink); err != nil && errors.Is(err, storage.ErrNotFound) == false {
+		return 0, err
+	}
+
+	return info.Size, nil
+}
+
+// taskArchive - архив задачи, отсоединённый от неё под service.mutex (см. detachArchive), чтобы закрыть его
+// уже без мьютекса: в S3 завершение и отмена записи - сетевые запросы, и медленное хранилище
+// не должно останавливать API и скачивания.
+type taskArchive struct {
+	writer util.ArchiveWriter
+	output storage.ArchiveWriter
+}
+
+// detachArchive забирает у задачи открытый архив и стирает пароль архива, который больше не нужен.
+// Возвращает nil, если архив задачи не открыт. Вызывается под service.mutex.
+func detachArchive(task *model.Task) *taskArchive {
+	task.Password = ""
+	if task.ArchiveWriter == nil {
+		return nil
+	}
+
+	archive := &taskArchive{writer: task.ArchiveWriter, output: task.ArchiveOutput}
+	task.ArchiveWriter = nil
+	task.ArchiveOutput = nil
+
+	return archive
+}
+
+// close закрывает ArchiveWriter и завершает запись архива в хранилище.
+// Если keep = false, запись прерывается, и незавершённый архив удаляется.
+// Вызывается без service.mutex; для nil ничего не делает.
+func (archive *taskArchive) close(keep bool) error {
+	if archive == nil {
+		return nil
+	}
+
+	writerErr := archive.writer.Close()
+	var err error
+	if keep && writerErr == nil {
+		err = archive.output.Finalize()
+	} else {
+		err = archive.output.Abort()
+	}
+
+	if writerErr != nil {
+		return fmt.Errorf("ошибка закрытия архива: %w", writerErr)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения архива: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"workmate_test_project/internal/storage"
+	"workmate_test_project/internal/store"
+	"workmate_test_project/internal/util"
+)
+
+func newStorageTestService(t *testing.T, storageRoot string, policy CollisionPolicy) *TaskService {
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:        testDownloadOptions,
+		StorageRoot:     storageRoot,
+		CollisionPolicy: policy,
+		Limits:          TaskLimits{MaxActiveTasks: 10},
+	})
+	assert.NoError(t, err)
+	t.Cleanup(taskService.Close)
+
+	return taskService
+}
+
+func TestCreateTask_ArchiveUnderStorageRoot(t *testing.T) {
+	storageRoot := t.TempDir()
+	taskService := newStorageTestService(t, storageRoot, CollisionReject)
+
+	task, err := taskService.CreateTask(context.Background(), "reports/2025", "july", "", "")
+	assert.NoError(t, err, "вложенные каталоги внутри корня создаются автоматически")
+	assert.Equal(t, "reports/2025/july.zip", task.ArchiveLink, "ссылка на архив - его имя в хранилище архивов")
+	assert.FileExists(t, filepath.Join(storageRoot, "reports", "2025", "july.zip"))
+
+	task, err = taskService.CreateTask(context.Background(), "", "", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "task_2.zip", task.ArchiveLink, "имя архива генерируется по ID задачи")
+}
+
+func TestCreateTask_RejectsPathEscape(t *testing.T) {
+	storageRoot := t.TempDir()
+	outside := t.TempDir()
+	assert.NoError(t, os.Symlink(outside, filepath.Join(storageRoot, "link")))
+	taskService := newStorageTestService(t, storageRoot, CollisionReject)
+
+	tests := []struct {
+		name        string
+		archivePath string
+		archiveName string
+	}{
+		{"выход наверх в каталоге", "../escape", "archive"},
+		{"выход наверх внутри каталога", "reports/../../escape", "archive"},
+		{"абсолютный путь", outside, "archive"},
+		{"каталог в имени", "", "../archive"},
+		{"имя из точек", "", ".."},
+		{"символическая ссылка наружу", "link", "archive"},
+		{"каталог за символической ссылкой", "link/nested", "archive"},
+	}
+
+	for _, test := range tests {
+		task, err := taskService.CreateTask(context.Background(), test.archivePath, test.archiveName, "", "")
+		assert.ErrorIs(t, err, ErrInvalidArchivePath, test.name)
+		assert.Nil(t, task, test.name)
+	}
+
+	entries, err := os.ReadDir(outside)
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "за пределами корня ничего не должно создаваться")
+	assert.Len(t, taskService.tasksSlot, 0, "слоты отклонённых задач должны освобождаться")
+}
+
+func TestCreateTask_CollisionPolicy(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		taskService := newStorageTestService(t, t.TempDir(), CollisionReject)
+
+		_, err := taskService.CreateTask(context.Background(), "", "archive", "", "")
+		assert.NoError(t, err)
+		_, err = taskService.CreateTask(context.Background(), "", "archive.zip", "", "")
+		assert.ErrorIs(t, err, ErrArchiveExists)
+
+		_, err = taskService.CreateTask(context.Background(), "", "", "", "")
+		assert.NoError(t, err, "сгенерированные имена не отклоняются")
+	})
+
+	t.Run("suffix", func(t *testing.T) {
+		taskService := newStorageTestService(t, t.TempDir(), CollisionSuffix)
+
+		for _, expected := range []string{"archive.zip", "archive_1.zip", "archive_2.zip"} {
+			task, err := taskService.CreateTask(context.Background(), "", "archive", "", "")
+			assert.NoError(t, err)
+			assert.Equal(t, expected, task.ArchiveLink)
+		}
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		storageRoot := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(storageRoot, "stale.zip"), []byte("старый архив"), 0644))
+		taskService := newStorageTestService(t, storageRoot, CollisionOverwrite)
+
+		task, err := taskService.CreateTask(context.Background(), "", "stale", "", "")
+		assert.NoError(t, err, "архив, не принадлежащий задаче, перезаписывается")
+		info, err := os.Stat(filepath.Join(storageRoot, task.ArchiveLink))
+		assert.NoError(t, err)
+		assert.Zero(t, info.Size())
+
+		_, err = taskService.CreateTask(context.Background(), "", "stale", "", "")
+		assert.ErrorIs(t, err, ErrArchiveExists, "архив другой задачи перезаписывать нельзя")
+	})
+
+	_, err := NewTaskServiceWithOptions(TaskServiceOptions{StorageRoot: t.TempDir(), CollisionPolicy: "rename"})
+	assert.Error(t, err, "неизвестная политика должна приводить к ошибке")
+}
+
+func TestCreateTask_ArchiveFormats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(writer, "%PDF-1.7 содержимое "+request.URL.Path)
+	}))
+	defer server.Close()
+
+	_, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		ArchiveStorage:    storage.NewMemoryStorage(),
+		CompressionLevels: map[util.ArchiveFormat]int{util.FormatTarZst: 23},
+	})
+	assert.ErrorIs(t, err, util.ErrUnsupportedArchiveFormat, "недопустимый уровень сжатия - ошибка создания сервиса")
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:          testDownloadOptions,
+		ArchiveStorage:    storage.NewMemoryStorage(),
+		CompressionLevels: map[util.ArchiveFormat]int{util.FormatTarGz: 9},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	_, err = taskService.CreateTask(context.Background(), "", "archive", "rar", "")
+	assert.ErrorIs(t, err, util.ErrUnsupportedArchiveFormat)
+	assert.Len(t, taskService.tasksSlot, 0, "слот не должен заниматься задачей с неизвестным форматом")
+
+	task, err := taskService.CreateTask(context.Background(), "reports", "archive.tar.gz", "TAR.GZ", "")
+	assert.NoError(t, err)
+	assert.Equal(t, util.FormatTarGz, task.Format)
+	assert.Equal(t, "reports/archive.tar.gz", task.ArchiveLink, "расширение формата не должно удваиваться")
+
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/file1.pdf", "file1")
+	assert.NoError(t, err)
+	waitForFiles(t, taskService, task.ID)
+	_, err = taskService.FinalizeTask(context.Background(), task.ID)
+	assert.NoError(t, err)
+
+	archive, err := taskService.archives.Open(context.Background(), task.ArchiveLink)
+	assert.NoError(t, err)
+	defer archive.Close()
+	decompressor, err := gzip.NewReader(archive)
+	assert.NoError(t, err, "архив tar.gz должен быть сжат gzip")
+	reader := tar.NewReader(decompressor)
+	header, err := reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "file1.pdf", header.Name)
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.7 содержимое /file1.pdf", string(content))
+	header, err = reader.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, "manifest.json", header.Name, "после файлов в архив записывается манифест")
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestCreateTask_EncryptedArchive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(writer, "%PDF-1.7 содержимое "+request.URL.Path)
+	}))
+	defer server.Close()
+
+	journalPath := filepath.Join(t.TempDir(), "tasks.journal")
+	journalStore, err := store.OpenJournalStore(journalPath)
+	assert.NoError(t, err)
+	defer journalStore.Close()
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:       testDownloadOptions,
+		Store:          journalStore,
+		ArchiveStorage: storage.NewMemoryStorage(),
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	_, err = taskService.CreateTask(context.Background(), "", "contracts", util.FormatTarGz, "секретный пароль")
+	assert.ErrorIs(t, err, util.ErrUnsupportedArchiveFormat, "шифрование поддерживается только для zip")
+
+	task, err := taskService.CreateTask(context.Background(), "", "contracts", util.FormatZIP, "секретный пароль")
+	assert.NoError(t, err)
+	assert.True(t, task.Encrypted)
+
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/contract.pdf", "contract")
+	assert.NoError(t, err)
+	waitForFiles(t, taskService, task.ID)
+	task, err = taskService.FinalizeTask(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, task.Password, "после закрытия архива пароль не должен оставаться в памяти")
+
+	reader, err := readTestArchive(t, taskService, task.ArchiveLink)
+	assert.NoError(t, err)
+	assert.Len(t, reader.File, 2)
+	assert.NotZero(t, reader.File[0].Flags&0x1, "файл в архиве должен быть зашифрован")
+	assert.NotZero(t, reader.File[1].Flags&0x1, "манифест в архиве должен быть зашифрован")
+	_, err = reader.File[0].Open()
+	assert.Error(t, err, "без пароля файл не распаковывается")
+
+	journal, err := os.ReadFile(journalPath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(journal), "секретный пароль", "пароль не должен сохраняться в хранилище задач")
+	assert.Contains(t, string(journal), `"encrypted":true`)
+}
+
+// blockingStorage - хранилище архивов, в котором Finalize и Delete, как запросы к медленному S3,
+// не завершаются, пока тест не отправит сигнал в release. О начале такой операции сообщается в blocked.
+type blockingStorage struct {
+	storage.ArchiveStorage
+	blocked chan string
+	release chan struct{}
+}
+
+func (archives *blockingStorage) Create(ctx context.Context, name string, overwrite bool) (storage.ArchiveWriter, error) {
+	writer, err := archives.ArchiveStorage.Create(ctx, name, overwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockingWriter{ArchiveWriter: writer, archives: archives}, nil
+}
+
+func (archives *blockingStorage) Delete(ctx context.Context, name string) error {
+	archives.wait("delete")
+	return archives.ArchiveStorage.Delete(ctx, name)
+}
+
+func (archives *blockingStorage) wait(operation string) {
+	archives.blocked <- operation
+	<-archives.release
+}
+
+type blockingWriter struct {
+	storage.ArchiveWriter
+	archives *blockingStorage
+}
+
+func (writer *blockingWriter) Finalize() error {
+	writer.archives.wait("finalize")
+	return writer.ArchiveWriter.Finalize()
+}
+
+func TestArchiveStorage_SlowStorageDoesNotBlockService(t *testing.T) {
+	archives := &blockingStorage{
+		ArchiveStorage: storage.NewMemoryStorage(),
+		blocked:        make(chan string, 4),
+		release:        make(chan struct{}),
+	}
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{Download: testDownloadOptions, ArchiveStorage: archives})
+	assert.NoError(t, err)
+	t.Cleanup(taskService.Close)
+	// если тест упал, пока операция заблокирована, она отпускается, чтобы сервис мог остановиться
+	t.Cleanup(func() {
+		close(archives.release)
+	})
+
+	task, err := taskService.CreateTask(context.Background(), "", "slow", "", "")
+	assert.NoError(t, err)
+
+	waitBlocked := func(operation string) {
+		select {
+		case blocked := <-archives.blocked:
+			assert.Equal(t, operation, blocked)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("хранилище архивов не получило запрос %s", operation)
+		}
+	}
+	assertResponsive := func(message string) {
+		snapshot := make(chan error, 1)
+		go func() {
+			_, err := taskService.GetTaskSnapshot(context.Background(), task.ID)
+			snapshot <- err
+		}()
+		select {
+		case err := <-snapshot:
+			assert.NoError(t, err, message)
+		case <-time.After(time.Second):
+			t.Fatal(message)
+		}
+	}
+
+	finalized := make(chan error, 1)
+	go func() {
+		_, err := taskService.FinalizeTask(context.Background(), task.ID)
+		finalized <- err
+	}()
+	waitBlocked("finalize")
+	assertResponsive("статус задачи должен отдаваться, пока архив сохраняется в хранилище")
+	archives.release <- struct{}{}
+	assert.NoError(t, <-finalized)
+
+	deleted := make(chan error, 1)
+	go func() {
+		deleted <- taskService.DeleteTask(context.Background(), task.ID, false)
+	}()
+	waitBlocked("delete")
+	assertResponsive("статус задачи должен отдаваться, пока архив удаляется из хранилища")
+	archives.release <- struct{}{}
+	assert.NoError(t, <-deleted)
+
+	_, err = taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.ErrorIs(t, err, store.ErrTaskNotFound)
+	_, err = archives.Stat(context.Background(), task.ArchiveLink)
+	assert.ErrorIs(t, err, storage.ErrNotFound, "архив удалённой задачи удаляется из хранилища")
+}
@@ -2,58 +2,442 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"path/filepath"
+	"log"
+	"net/url"
+	"os"
+	"slices"
 	"sync"
+	"time"
 	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+	"workmate_test_project/internal/store"
 	"workmate_test_project/internal/util"
 )
 
 // TaskService - сервис для работы с задачами, он состоит из:
 // id - счётчик для генерации уникальных идентификаторов задач
-// tasksSlot - буферизированный канал, ограничивающий максимальное количество активных задач (3 по ТЗ)
-// tasks - мапа активных задач, где ключ — id задачи, а значение — указатель на структуру model.Task
+// tasksSlot - буферизированный канал, ограничивающий максимальное количество активных задач (limits.MaxActiveTasks)
+// store - хранилище задач (в памяти или долговременное, см. store.TaskStore)
 // mutex - мьютекс для защиты от гонки данных
+// limits - лимиты задач и файлов
+// retention - сроки хранения задач в конечных статусах (см. janitor.go)
+// janitorCancel, janitorDone - остановка фоновой очистки и ожидание её завершения
+// busyPolicy, queueSize - что делать с новой задачей, когда заняты все слоты (см. queue.go)
+// queue - ID задач в статусе "в очереди" в порядке постановки в очередь
+// jobs, workersCtx, workersCancel, workersWait - очередь скачивания файлов и пул скачивающих их горутин (см. worker.go)
+// spoolDir - каталог для временных файлов, в которые скачиваются файлы до записи в архив
+// downloader - скачивает файлы с повторами и докачкой (см. util.Downloader)
+// archives, closeArchives - хранилище архивов и признак того, что его создал (и закрывает) сам сервис
+// collisionPolicy - политика совпадения имён архивов (см. storage.go)
+// compressionLevels - уровни сжатия архивов по форматам
+// writeChecksums - записывать ли в архив SHA256SUMS вместе с манифестом (см. manifest.go)
+// diskUsage - сколько байт занимают файлы всех задач, сумма model.Task.UsedBytes (см. quota.go)
+// credentialProfiles - именованные учётные данные для скачивания файлов (см. credentials.go)
 type TaskService struct {
-	id        int
-	tasksSlot chan struct{}
-	tasks     map[int]*model.Task
-	mutex     sync.Mutex
+	id                 int
+	tasksSlot          chan struct{}
+	store              store.TaskStore
+	mutex              sync.Mutex
+	limits             TaskLimits
+	retention          map[model.TaskStatus]time.Duration
+	janitorCancel      context.CancelFunc
+	janitorDone        chan struct{}
+	busyPolicy         BusyPolicy
+	queueSize          int
+	queue              []int
+	jobs               chan fileJob
+	workersCtx         context.Context
+	workersCancel      context.CancelFunc
+	workersWait        sync.WaitGroup
+	spoolDir           string
+	downloader         *util.Downloader
+	archives           storage.ArchiveStorage
+	closeArchives      bool
+	collisionPolicy    CollisionPolicy
+	compressionLevels  map[util.ArchiveFormat]int
+	writeChecksums     bool
+	diskUsage          int64
+	credentialProfiles map[string]util.Credentials
 }
 
-var fileExtension = map[string]struct{}{
-	".jpg":  {},
-	".jpeg": {},
-	".png":  {},
-	".webp": {},
-	".pdf":  {},
+// TaskServiceOptions - параметры создания TaskService.
+// Store - хранилище задач, если не задано, используется store.MemoryStore.
+// Limits - лимиты задач и файлов, незаданные (нулевые) лимиты берутся из DefaultTaskLimits.
+// CompletedRetention, FailedRetention, CancelledRetention - сколько задача в соответствующем статусе
+// хранится (вместе с архивом), прежде чем её удалит janitor; если не больше нуля, такие задачи не удаляются.
+// JanitorInterval - как часто janitor ищет задачи с истёкшим сроком хранения (по умолчанию раз в минуту).
+// BusyPolicy - что делать с новой задачей, когда заняты все слоты: отклонять (по умолчанию) или ставить в очередь.
+// QueueSize - максимальное количество задач в очереди ожидания при BusyPolicyQueue (по умолчанию 10).
+// SpoolDir - каталог для временных файлов со скачанными файлами (по умолчанию системный каталог временных файлов).
+// ArchiveStorage - хранилище архивов (локальный диск, S3 или память), если не задано,
+// используется storage.LocalStorage в каталоге StorageRoot.
+// StorageRoot - корневой каталог архивов (по умолчанию defaultStorageRoot), если ArchiveStorage не задано.
+// CollisionPolicy - что делать, если архив с запрошенным именем уже существует (по умолчанию CollisionReject).
+// CompressionLevels - уровни сжатия по форматам архивов, для незаданных форматов
+// используется util.ArchiveFormat.DefaultCompressionLevel.
+// WriteChecksums - записывать ли в архив при завершении задачи, кроме манифеста, файл SHA256SUMS.
+// Download - таймауты и повторы скачивания файлов (см. util.DownloaderOptions).
+// CredentialProfiles - именованные учётные данные, на которые можно сослаться при добавлении файла (см. FileAuth).
+type TaskServiceOptions struct {
+	Store              store.TaskStore
+	Limits             TaskLimits
+	CompletedRetention time.Duration
+	FailedRetention    time.Duration
+	CancelledRetention time.Duration
+	JanitorInterval    time.Duration
+	BusyPolicy         BusyPolicy
+	QueueSize          int
+	SpoolDir           string
+	ArchiveStorage     storage.ArchiveStorage
+	StorageRoot        string
+	CollisionPolicy    CollisionPolicy
+	CompressionLevels  map[util.ArchiveFormat]int
+	WriteChecksums     bool
+	Download           util.DownloaderOptions
+	CredentialProfiles map[string]util.Credentials
 }
 
+// TaskLimits - лимиты задач и файлов.
+// MaxActiveTasks - максимальное количество одновременно активных задач (статусы "создана" и "выполняется")
+// MaxFilesPerTask - максимальное количество файлов в одной задаче, после записи последнего задача завершается
+// DownloadConcurrency - сколько файлов одной задачи может скачиваться одновременно
+// AllowedMIMETypes - допустимые типы файлов, определённые по содержимому при скачивании (см. util.DetectContentType)
+// DownloadWorkers - сколько файлов (всех задач вместе) может скачиваться одновременно
+// DownloadQueueSize - сколько файлов может ожидать скачивания, сверх этого AddFileToTask возвращает ErrDownloadQueueFull
+// MaxFileSize - максимальный размер одного файла в байтах (ErrFileTooLarge)
+// MaxTaskSize - максимальный суммарный размер файлов одной задачи в байтах (ErrTaskTooLarge)
+// DiskBudget - сколько байт могут занимать файлы всех задач вместе: во временных файлах и в архивах,
+// которые ещё не удалены (ErrDiskBudgetExceeded)
+// Для MaxFileSize, MaxTaskSize и DiskBudget отрицательное значение отключает лимит.
+type TaskLimits struct {
+	MaxActiveTasks      int
+	MaxFilesPerTask     int
+	DownloadConcurrency int
+	AllowedMIMETypes    []string
+	DownloadWorkers     int
+	DownloadQueueSize   int
+	MaxFileSize         int64
+	MaxTaskSize         int64
+	DiskBudget          int64
+}
+
+// DefaultTaskLimits возвращает лимиты по умолчанию (значения из исходного ТЗ).
+func DefaultTaskLimits() TaskLimits {
+	return TaskLimits{
+		MaxActiveTasks:      3,
+		MaxFilesPerTask:     3,
+		DownloadConcurrency: 3,
+		AllowedMIMETypes:    []string{"image/jpeg", "image/png", "image/webp", "application/pdf"},
+		DownloadWorkers:     4,
+		DownloadQueueSize:   100,
+		MaxFileSize:         100 << 20,
+		MaxTaskSize:         300 << 20,
+		DiskBudget:          10 << 30,
+	}
+}
+
+// withDefaults заменяет незаданные лимиты значениями по умолчанию.
+func (limits TaskLimits) withDefaults() TaskLimits {
+	defaults := DefaultTaskLimits()
+	if limits.MaxActiveTasks <= 0 {
+		limits.MaxActiveTasks = defaults.MaxActiveTasks
+	}
+	if limits.MaxFilesPerTask <= 0 {
+		limits.MaxFilesPerTask = defaults.MaxFilesPerTask
+	}
+	if limits.DownloadConcurrency <= 0 {
+		limits.DownloadConcurrency = defaults.DownloadConcurrency
+	}
+	if len(limits.AllowedMIMETypes) == 0 {
+		limits.AllowedMIMETypes = defaults.AllowedMIMETypes
+	}
+	if limits.DownloadWorkers <= 0 {
+		limits.DownloadWorkers = defaults.DownloadWorkers
+	}
+	if limits.DownloadQueueSize <= 0 {
+		limits.DownloadQueueSize = defaults.DownloadQueueSize
+	}
+	if limits.MaxFileSize == 0 {
+		limits.MaxFileSize = defaults.MaxFileSize
+	}
+	if limits.MaxTaskSize == 0 {
+		limits.MaxTaskSize = defaults.MaxTaskSize
+	}
+	if limits.DiskBudget == 0 {
+		limits.DiskBudget = defaults.DiskBudget
+	}
+
+	return limits
+}
+
+var (
+	// ErrServerBusy возвращается, если заняты все слоты активных задач.
+	ErrServerBusy = errors.New("сервер в данный момент занят")
+	// ErrTooManyFiles возвращается, если в задаче уже максимальное количество файлов.
+	ErrTooManyFiles = errors.New("достигнут максимальный лимит файлов в задаче")
+	// ErrInvalidFileURL возвращается, если URL файла нельзя использовать для скачивания.
+	ErrInvalidFileURL = errors.New("некорректный URL файла")
+	// ErrFilesInProgress возвращается, если задачу нельзя завершить, пока в неё скачиваются файлы.
+	ErrFilesInProgress = errors.New("в задачу ещё скачиваются файлы")
+	// ErrFileNotFound возвращается, если в задаче нет файла с указанным ID.
+	ErrFileNotFound = errors.New("файл не найден в задаче")
+)
+
+// NewTaskService создаёт сервис, хранящий задачи в памяти.
 func NewTaskService() *TaskService {
-	return &TaskService{
-		tasksSlot: make(chan struct{}, 3),
-		tasks:     make(map[int]*model.Task),
+	service, _ := NewTaskServiceWithOptions(TaskServiceOptions{})
+	return service
+}
+
+// NewTaskServiceWithOptions создаёт сервис с указанными параметрами
+// и восстанавливает состояние задач из хранилища.
+func NewTaskServiceWithOptions(options TaskServiceOptions) (*TaskService, error) {
+	taskStore := options.Store
+	if taskStore == nil {
+		taskStore = store.NewMemoryStore()
+	}
+
+	limits := options.Limits.withDefaults()
+
+	busyPolicy := options.BusyPolicy
+	switch busyPolicy {
+	case "":
+		busyPolicy = BusyPolicyReject
+	case BusyPolicyReject, BusyPolicyQueue:
+	default:
+		return nil, fmt.Errorf("неизвестная политика при занятом сервере: %q", busyPolicy)
+	}
+	queueSize := options.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	collisionPolicy := options.CollisionPolicy
+	switch collisionPolicy {
+	case "":
+		collisionPolicy = CollisionReject
+	case CollisionReject, CollisionSuffix, CollisionOverwrite:
+	default:
+		return nil, fmt.Errorf("неизвестная политика совпадения имён архивов: %q", collisionPolicy)
+	}
+	compressionLevels := make(map[util.ArchiveFormat]int, len(options.CompressionLevels))
+	for format, level := range options.CompressionLevels {
+		if err := format.CheckCompressionLevel(level); err != nil {
+			return nil, err
+		}
+		compressionLevels[format] = level
+	}
+
+	downloader, err := util.NewDownloader(options.Download)
+	if err != nil {
+		return nil, err
+	}
+	credentialProfiles, err := checkCredentialProfiles(options.CredentialProfiles)
+	if err != nil {
+		return nil, err
+	}
+
+	archives := options.ArchiveStorage
+	closeArchives := false
+	if archives == nil {
+		storageRoot := options.StorageRoot
+		if storageRoot == "" {
+			storageRoot = defaultStorageRoot
+		}
+		localStorage, err := storage.NewLocalStorage(storageRoot)
+		if err != nil {
+			return nil, err
+		}
+		archives = localStorage
+		closeArchives = true
+	}
+
+	service := &TaskService{
+		tasksSlot: make(chan struct{}, limits.MaxActiveTasks),
+		store:     taskStore,
 		mutex:     sync.Mutex{},
+		limits:    limits,
+		retention: map[model.TaskStatus]time.Duration{
+			model.StatusCompleted: options.CompletedRetention,
+			model.StatusFailed:    options.FailedRetention,
+			model.StatusCancelled: options.CancelledRetention,
+		},
+		busyPolicy:         busyPolicy,
+		queueSize:          queueSize,
+		jobs:               make(chan fileJob, limits.DownloadQueueSize),
+		spoolDir:           options.SpoolDir,
+		downloader:         downloader,
+		archives:           archives,
+		closeArchives:      closeArchives,
+		collisionPolicy:    collisionPolicy,
+		compressionLevels:  compressionLevels,
+		writeChecksums:     options.WriteChecksums,
+		credentialProfiles: credentialProfiles,
+	}
+
+	if err := service.restore(); err != nil {
+		if closeArchives {
+			archives.Close()
+		}
+		return nil, err
+	}
+	service.startWorkers()
+	service.recoverUnfinishedTasks()
+	service.mutex.Lock()
+	service.activateQueued()
+	service.mutex.Unlock()
+	service.startJanitor(options.JanitorInterval)
+
+	return service, nil
+}
+
+// restore восстанавливает счётчик ID, служебные каналы и контексты задач, загруженных из хранилища.
+// Архивы незавершённых задач после этого обрабатываются в recoverUnfinishedTasks,
+// а задачи в статусе "в очереди" возвращаются в очередь ожидания в прежнем порядке.
+func (service *TaskService) restore() error {
+	tasks, err := service.store.List()
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки задач из хранилища: %w", err)
+	}
+
+	for _, task := range tasks {
+		if task.ID > service.id {
+			service.id = task.ID
+		}
+		if task.Files == nil {
+			task.Files = []model.TaskFile{}
+		}
+		if task.Format == "" {
+			task.Format = util.FormatZIP
+		}
+		for i := range task.Files {
+			restoreFileStatus(&task.Files[i], i+1)
+		}
+		if task.ArchiveLink != "" {
+			service.useBytes(task, storedBytes(task))
+		}
+		task.FileCountChannel = make(chan struct{}, service.limits.DownloadConcurrency)
+		task.DoneChannel = make(chan struct{})
+		task.CommitChannel = make(chan struct{}, 1)
+		task.Context, task.Cancel = context.WithCancel(context.Background())
+		if task.Status.IsFinal() {
+			task.Cancel()
+			if task.FinishedAt.IsZero() {
+				// срок хранения задач, записанных без времени завершения, отсчитывается с момента запуска
+				task.FinishedAt = time.Now()
+			}
+			close(task.DoneChannel)
+		}
+		if task.Status == model.StatusQueued {
+			service.queue = append(service.queue, task.ID)
+		}
 	}
+
+	return nil
+}
+
+// Limits возвращает лимиты, с которыми работает сервис.
+func (service *TaskService) Limits() TaskLimits {
+	return service.limits
 }
 
 // GetTaskStatusById возвращает задачу по её ID.
 // Если задача с таким ID не найдена, возвращается ошибка.
 func (service *TaskService) GetTaskStatusById(ctx context.Context, taskId int) (*model.Task, error) {
-	task, exist := service.tasks[taskId]
-	if exist == false {
-		return nil, fmt.Errorf("задача с id = %d не найдена", taskId)
+	task, err := service.store.Get(taskId)
+	if err != nil {
+		return nil, fmt.Errorf("задача с id = %d не найдена: %w", taskId, err)
 	}
 
 	return task, nil
 }
 
-// CreateTask создает новую задачу с архивом ZIP в указанном пути и имени.
+// GetTaskSnapshot возвращает копию задачи по её ID, снятую под мьютексом.
+// В отличие от GetTaskStatusById копию можно читать, пока файлы задачи скачиваются в фоне.
+func (service *TaskService) GetTaskSnapshot(ctx context.Context, taskId int) (model.Task, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	task, err := service.GetTaskStatusById(ctx, taskId)
+	if err != nil {
+		return model.Task{}, err
+	}
+
+	return snapshotTask(task), nil
+}
+
+// snapshotTask возвращает копию задачи, которую можно читать без service.mutex.
+// Вызывается под service.mutex.
+func snapshotTask(task *model.Task) model.Task {
+	snapshot := *task
+	snapshot.Files = slices.Clone(task.Files)
+
+	return snapshot
+}
+
+// ListTasks возвращает копии всех задач, отсортированные по ID.
+// Если status не пустой, возвращаются только задачи в этом статусе.
+func (service *TaskService) ListTasks(ctx context.Context, status model.TaskStatus) ([]model.Task, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	tasks, err := service.store.List()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки задач: %w", err)
+	}
+
+	snapshots := make([]model.Task, 0, len(tasks))
+	for _, task := range tasks {
+		if status != "" && task.Status != status {
+			continue
+		}
+		snapshots = append(snapshots, snapshotTask(task))
+	}
+
+	return snapshots, nil
+}
+
+// GetTaskFile возвращает копию файла задачи по ID задачи и ID файла.
+// Если файла с таким ID в задаче нет, возвращается ErrFileNotFound.
+func (service *TaskService) GetTaskFile(ctx context.Context, taskId int, fileId int) (model.TaskFile, error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	task, err := service.GetTaskStatusById(ctx, taskId)
+	if err != nil {
+		return model.TaskFile{}, err
+	}
+
+	for _, file := range task.Files {
+		if file.ID == fileId {
+			return file, nil
+		}
+	}
+
+	return model.TaskFile{}, fmt.Errorf("%w: id = %d", ErrFileNotFound, fileId)
+}
+
+// CreateTask создает новую задачу с архивом формата format (пустой - zip) в указанном пути и имени.
 // Метод использует контекст для отмены операции и ограничивает
 // количество одновременно создаваемых задач через канал tasksSlot.
-// Возвращает созданную задачу или ошибку, если архив не удалось создать
-// или сервер занят.
-func (service *TaskService) CreateTask(ctx context.Context, zipArchivePath string, zipArchiveName string) (*model.Task, error) {
+// Если все слоты заняты, задача либо отклоняется с ErrServerBusy, либо при BusyPolicyQueue
+// ставится в очередь ожидания в статусе model.StatusQueued (см. enqueueTask).
+// Непустой password включает шифрование файлов архива WinZip AES-256 (только для zip). Пароль хранится
+// только в памяти, поэтому незавершённую задачу с шифрованием нельзя продолжить после перезапуска сервера.
+// Возвращает созданную задачу или ошибку, если формат не поддерживается или не поддерживает шифрование
+// (util.ErrUnsupportedArchiveFormat), архив не удалось создать, сервер занят или очередь заполнена.
+func (service *TaskService) CreateTask(ctx context.Context, archivePath string, archiveName string,
+	format util.ArchiveFormat, password string) (*model.Task, error) {
+	format, err := util.ParseArchiveFormat(string(format))
+	if err != nil {
+		return nil, err
+	}
+	if err := format.CheckEncryption(password); err != nil {
+		return nil, err
+	}
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
@@ -62,102 +446,533 @@ func (service *TaskService) CreateTask(ctx context.Context, zipArchivePath strin
 		service.mutex.Lock()
 		defer service.mutex.Unlock()
 
-		service.id++
-
-		archiveFile, zipWriter, err := util.CreateZIPArchive(zipArchivePath, zipArchiveName)
+		// ID занимается только после создания архива, чтобы отклонённые запросы не оставляли пропусков
+		archive, archiveLink, err := service.createArchive(ctx, service.id+1, archivePath, archiveName, format)
+		if err != nil {
+			service.releaseSlot()
+			return nil, fmt.Errorf("ошибка создания архива: %w", err)
+		}
+		archiveWriter, err := service.newArchiveWriter(format, password, archive)
 		if err != nil {
-			<-service.tasksSlot
+			archive.Abort()
+			service.releaseSlot()
 			return nil, fmt.Errorf("ошибка создания архива: %w", err)
 		}
+		service.id++
 
+		taskCtx, taskCancel := context.WithCancel(context.Background())
 		task := &model.Task{
 			ID:               service.id,
-			Files:            []string{},
-			FileCountChannel: make(chan struct{}, 3),
+			Files:            []model.TaskFile{},
+			FileCountChannel: make(chan struct{}, service.limits.DownloadConcurrency),
 			DoneChannel:      make(chan struct{}),
-			ArchiveFile:      archiveFile,
-			ArchiveWriter:    zipWriter,
-			Status:           "создана",
-			ArchiveLink:      zipArchivePath + "/" + zipArchiveName + ".zip",
+			CommitChannel:    make(chan struct{}, 1),
+			ArchiveOutput:    archive,
+			ArchiveWriter:    archiveWriter,
+			Context:          taskCtx,
+			Cancel:           taskCancel,
+			Status:           model.StatusCreated,
+			ArchiveLink:      archiveLink,
+			CreatedAt:        time.Now(),
+			Format:           format,
+			Encrypted:        password != "",
+			Password:         password,
+		}
+		if err := service.store.Create(task); err != nil {
+			taskCancel()
+			archive.Abort()
+			service.releaseSlot()
+			return nil, fmt.Errorf("ошибка сохранения задачи: %w", err)
 		}
-		service.tasks[task.ID] = task
 
 		return task, nil
 
 	default:
-		return nil, fmt.Errorf("сервер в данный момент занят")
+		if service.busyPolicy == BusyPolicyQueue {
+			return service.enqueueTask(ctx, archivePath, archiveName, format, password)
+		}
+		return nil, ErrServerBusy
 	}
 }
 
-// AddFileToTask добавляет один файл к задаче с заданным taskId.
-// Метод проверяет расширение файла и контролирует максимальное количество файлов,
-// обновляет статус задачи и формирует zip архив с добавленными файлами.
-// Ограничение на обработку файлов реализовано через канал FileCountChannel,
-// для соблюдения услвоия, что для 1 задачи не более 3 файлов.
+// AddFileToTask добавляет один файл к задаче с заданным taskId и возвращает ID файла внутри задачи.
+// Метод проверяет URL и имя файла и контролирует максимальное количество файлов,
+// обновляет статус задачи и ставит файл в очередь скачивания в статусе model.FilePending.
+// Сам файл скачивается и записывается в архив пулом горутин (см. worker.go), его состояние
+// отражается в TaskFile.Status.
+// Количество файлов в задаче ограничено limits.MaxFilesPerTask, а количество одновременных
+// скачиваний в одну задачу - каналом FileCountChannel (limits.DownloadConcurrency).
 //
-// Метод является синхронным, но безопасно может вызываться из отдельной горутины,
-// чтобы, например, вызывать его в отдельном методе для загрузки сразу нескольких файлов.
-// Содержимое case task.FileCountChannel <- struct{}{}: можно обернуть в отдельную горутину,
-// чтобы сделать выполнение полностью асинхронным. Однако в этом случае управление и обработка ошибок
-// станут менее контролируемыми.
-func (service *TaskService) AddFileToTask(ctx context.Context, taskId int, fileURL string, fileName string) error {
-	extension := filepath.Ext(fileURL)
-	if _, exist := fileExtension[extension]; exist == false {
-		return fmt.Errorf("не поддерживаемое расширение файла")
-	}
+// Тип файла по URL не проверяется: он определяется по содержимому при скачивании (см. util.Downloader),
+// там же выбирается расширение записи в архиве, поэтому подходят и адреса вида "/download?id=1".
+//
+// Файл записывается в задачу (и в хранилище) до начала скачивания, чтобы после
+// перезапуска сервера недокачанные файлы можно было поставить в очередь повторно.
+func (service *TaskService) AddFileToTask(ctx context.Context, taskId int, fileURL string, fileName string) (int, error) {
+	return service.AddFileToTaskWithAuth(ctx, taskId, fileURL, fileName, FileAuth{})
+}
 
-	var task *model.Task
+// AddFileToTaskWithAuth добавляет к задаче файл, который скачивается с авторизацией auth
+// (см. FileAuth), в остальном работает так же, как AddFileToTask.
+// Логин и пароль в самом адресе файла тоже считаются учётными данными и из адреса удаляются.
+// Учётные данные не попадают ни в хранилище задач, ни в статус, ни в манифест архива, а переданные
+// в запросе хранятся только в памяти: если сервер перезапустится до окончания скачивания,
+// файл завершится ошибкой ErrCredentialsLost.
+// Возвращает util.ErrInvalidCredentials для некорректных учётных данных и ErrUnknownCredentialProfile,
+// если профиля нет в конфигурации.
+func (service *TaskService) AddFileToTaskWithAuth(ctx context.Context, taskId int, fileURL string, fileName string,
+	auth FileAuth) (int, error) {
+	newFile := model.TaskFile{Name: fileName, URL: fileURL, Status: model.FilePending}
+	if err := service.applyFileAuth(&newFile, auth); err != nil {
+		return 0, err
+	}
+	if err := service.checkFileURL(ctx, newFile.URL); err != nil {
+		return 0, err
+	}
 
 	service.mutex.Lock()
-	task, err := service.GetTaskStatusById(ctx, taskId)
+	defer service.mutex.Unlock()
+
+	_, fileId, err := service.addTaskFile(ctx, taskId, newFile)
+	return fileId, err
+}
 
+// addTaskFile добавляет файл newFile в задачу taskId и возвращает задачу и ID файла.
+// Проверяет, что задача принимает файлы, лимиты количества файлов и места и уникальность имени файла.
+// Файл, который скачивается по URL, ставится в очередь скачивания, а загружаемый клиентом (Uploaded) -
+// нет: его сохраняет сам вызывающий код (см. UploadFileToTask).
+// Вызывается под service.mutex.
+func (service *TaskService) addTaskFile(ctx context.Context, taskId int, newFile model.TaskFile) (*model.Task, int, error) {
+	task, err := service.GetTaskStatusById(ctx, taskId)
 	if err != nil {
-		service.mutex.Unlock()
-		return fmt.Errorf("не удалось найти задачу: %w", err)
+		return nil, 0, fmt.Errorf("не удалось найти задачу: %w", err)
 	}
 
-	if task.FilesAdded >= 3 {
-		service.mutex.Unlock()
-		return fmt.Errorf("достигнут максимальный лимит файлов в задаче")
+	if task.Status == model.StatusQueued {
+		return nil, 0, fmt.Errorf("%w: позиция %d", ErrTaskQueued, slices.Index(service.queue, task.ID)+1)
+	}
+	if task.Status.CanTransitionTo(model.StatusRunning) == false {
+		return nil, 0, fmt.Errorf("%w: задача в статусе %q не принимает файлы", model.ErrInvalidTransition, task.Status.Label())
+	}
+
+	if countActiveFiles(task) >= service.limits.MaxFilesPerTask {
+		return nil, 0, fmt.Errorf("%w (%d)", ErrTooManyFiles, service.limits.MaxFilesPerTask)
+	}
+	if err := service.checkQuota(task); err != nil {
+		return nil, 0, err
 	}
 
-	task.Status = "выполняется"
+	if task.ArchiveWriter == nil {
+		return nil, 0, fmt.Errorf("архив задачи недоступен")
+	}
+
+	// расширение станет известно только после скачивания, поэтому имена сравниваются без него
+	for _, file := range task.Files {
+		if file.Name == newFile.Name && file.Error == "" {
+			return nil, 0, fmt.Errorf("файл %s уже добавлен в задачу", newFile.Name)
+		}
+	}
+
+	// задание попадёт к горутине пула не раньше, чем будет снят мьютекс, то есть после добавления файла в задачу
+	fileId := len(task.Files) + 1
+	if newFile.Uploaded == false && service.enqueueFile(task, fileId) == false {
+		return nil, 0, fmt.Errorf("%w (%d)", ErrDownloadQueueFull, service.limits.DownloadQueueSize)
+	}
+
+	if err := task.SetStatus(model.StatusRunning); err != nil {
+		return nil, 0, err
+	}
+	newFile.ID = fileId
+	task.Files = append(task.Files, newFile)
+	if err := service.store.Update(task); err != nil {
+		return nil, 0, fmt.Errorf("ошибка сохранения задачи: %w", err)
+	}
+
+	return task, fileId, nil
+}
+
+// downloadFile скачивает уже добавленный в задачу файл во временный файл, выбирает имя записи в архиве
+// по типу содержимого (см. attachSpool) и передаёт файл в commitFiles,
+// который записывает файлы в архив строго по одному и в порядке их добавления в задачу.
+// Если файл скачать или записать не удалось, ошибка сохраняется в файле и в LastError задачи,
+// а место, которое занимал файл, освобождается.
+// После записи последнего файла архив закрывается, а слот задачи освобождается.
+//
+// Временные ошибки скачивания повторяются (см. util.Downloader.Download), количество попыток
+// и ошибка последней неудачной из них сохраняются в файле (Attempts, LastError).
+// Файл скачивается с учётными данными из профиля или из запроса (см. AddFileToTaskWithAuth).
+//
+// Скачивание прерывается как при отмене ctx, так и при отмене самой задачи (task.Context).
+// Если ctx отменён из-за остановки сервиса, файл возвращается в статус model.FilePending.
+func (service *TaskService) downloadFile(ctx context.Context, task *model.Task, fileId int) error {
+	parentCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(task.Context, cancel)
+	defer stop()
+
+	service.mutex.Lock()
+	taskFile := findTaskFile(task, fileId)
+	if taskFile == nil {
+		service.mutex.Unlock()
+		return fmt.Errorf("%w: id = %d", ErrFileNotFound, fileId)
+	}
+	file := *taskFile
 	service.mutex.Unlock()
 
 	select {
 	case <-ctx.Done():
+		service.interruptFile(parentCtx, task, fileId, ctx.Err())
 		return ctx.Err()
 
 	case task.FileCountChannel <- struct{}{}:
+		// разрешение держится и во время записи в архив: так abortTask, заняв все разрешения,
+		// может быть уверен, что в архив никто не пишет
 		defer func() {
 			<-task.FileCountChannel
 		}()
 
-		if err := util.DownloadAndAddToZip(task.ArchiveWriter, fileURL, fileName); err != nil {
-			return fmt.Errorf("ошибка обработки файла: %v", err)
+		// задачу могли отменить, пока скачивание ждало своей очереди
+		if err := ctx.Err(); err != nil {
+			service.interruptFile(parentCtx, task, fileId, err)
+			return err
 		}
 
-		service.mutex.Lock()
-		task.FilesAdded++
-		task.Files = append(task.Files, fileName)
-
-		if task.FilesAdded == 3 {
-			task.Status = "завершена"
-			if err := task.ArchiveWriter.Close(); err != nil {
-				service.mutex.Unlock()
-				return fmt.Errorf("ошибка закрытия архива: %v", err)
+		service.setFileStatus(task, fileId, model.FileDownloading)
+
+		quota := &downloadQuota{service: service, task: task}
+		var spooled util.SpooledFile
+		credentials, err := service.fileCredentials(file)
+		if err == nil && file.Uploaded {
+			// файл, который загружал клиент, после перезапуска сервера взять негде
+			err = ErrUploadInterrupted
+		}
+		if err == nil {
+			spooled, err = service.downloader.Download(ctx, util.DownloadRequest{
+				URL:              file.URL,
+				SpoolDir:         service.spoolDir,
+				AllowedMIMETypes: service.limits.AllowedMIMETypes,
+				Quota:            quota,
+				OnAttemptError: func(attempt int, err error) {
+					service.recordAttempt(task, fileId, file.Attempts+attempt, err)
+				},
+				Credentials: credentials,
+			})
+		}
+		if err == nil {
+			// попытки до перезапуска сервера тоже учитываются
+			spooled.Attempts += file.Attempts
+			err = service.attachSpool(task, fileId, spooled, quota)
+		} else {
+			quota.release()
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				service.interruptFile(parentCtx, task, fileId, err)
+				return err
 			}
-			if err := task.ArchiveFile.Close(); err != nil {
-				service.mutex.Unlock()
-				return fmt.Errorf("ошибка закрытия файла: %v", err)
+			err = fmt.Errorf("ошибка обработки файла: %w", err)
+			service.failFile(task, fileId, err)
+			// следующие файлы могли уже скачаться и ждать, пока запишется этот
+			if commitErr := service.commitFiles(task); commitErr != nil {
+				log.Printf("ошибка записи файлов задачи %d в архив: %v", task.ID, commitErr)
 			}
-			<-service.tasksSlot
+			return err
 		}
 
-		service.mutex.Unlock()
+		return service.commitFiles(task)
+	}
+}
+
+// attachSpool сохраняет в файле задачи скачанный временный файл, его метаданные и имя записи в архиве:
+// имя файла + расширение по типу содержимого (см. util.ArchiveEntryName).
+// Резерв места quota уменьшается до реального размера файла.
+// Если имя записи занято манифестом или другим файлом задачи, временный файл удаляется, резерв освобождается
+// и возвращается ошибка.
+// Задача сохраняется в хранилище, чтобы после перезапуска записанный файл нашёлся в архиве по имени.
+func (service *TaskService) attachSpool(task *model.Task, fileId int, spooled util.SpooledFile, quota *downloadQuota) error {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
 
+	taskFile := findTaskFile(task, fileId)
+	if taskFile == nil {
+		os.Remove(spooled.Path)
+		quota.shrink(0)
 		return nil
+	}
+
+	archiveName := util.ArchiveEntryName(taskFile.Name, spooled.ContentType)
+	var nameErr error
+	if archiveName == model.ManifestFileName || archiveName == model.ChecksumsFileName {
+		nameErr = fmt.Errorf("имя %s занято манифестом архива", archiveName)
+	}
+	for _, file := range task.Files {
+		if file.ID != fileId && file.ArchiveName == archiveName && file.Error == "" {
+			nameErr = fmt.Errorf("имя %s уже занято файлом %d", archiveName, file.ID)
+		}
+	}
+	if nameErr != nil {
+		os.Remove(spooled.Path)
+		quota.shrink(0)
+		return nameErr
+	}
+
+	quota.shrink(spooled.Size)
+
+	taskFile.Attempts = spooled.Attempts
+	// файл скачан, учётные данные больше не нужны
+	taskFile.Credentials = nil
+	taskFile.ArchiveName = archiveName
+	taskFile.SpoolPath = spooled.Path
+	taskFile.Size = spooled.Size
+	taskFile.ContentType = spooled.ContentType
+	taskFile.SHA256 = spooled.SHA256
+	taskFile.DownloadedAt = spooled.DownloadedAt
+
+	if err := service.store.Update(task); err != nil {
+		log.Printf("ошибка сохранения задачи %d: %v", task.ID, err)
+	}
+
+	return nil
+}
+
+// FinalizeTask досрочно завершает задачу независимо от количества добавленных файлов:
+// закрывает архив, переводит задачу в статус model.StatusCompleted (после чего становится доступна
+// ссылка на архив) и освобождает слот задачи.
+//
+// Задачу нельзя завершить, пока в неё скачиваются файлы (ErrFilesInProgress),
+// а также если она уже находится в конечном статусе (model.ErrInvalidTransition) или ещё ждёт слота в очереди (ErrTaskQueued).
+// Если архив не удалось сохранить в хранилище архивов, задача переходит в статус model.StatusFailed, и возвращается ошибка.
+// Возвращает копию завершённой задачи (см. GetTaskSnapshot).
+func (service *TaskService) FinalizeTask(ctx context.Context, taskId int) (*model.Task, error) {
+	service.mutex.Lock()
+	task, err := service.GetTaskStatusById(ctx, taskId)
+	if err != nil {
+		service.mutex.Unlock()
+		return nil, fmt.Errorf("не удалось найти задачу: %w", err)
+	}
+
+	if task.Status.IsFinal() {
+		service.mutex.Unlock()
+		return nil, fmt.Errorf("%w: задача уже в статусе %q", model.ErrInvalidTransition, task.Status.Label())
+	}
+	if task.Status == model.StatusQueued {
+		service.mutex.Unlock()
+		return nil, ErrTaskQueued
+	}
+
+	if countActiveFiles(task) > task.FilesAdded {
+		service.mutex.Unlock()
+		return nil, ErrFilesInProgress
+	}
+
+	// пустая задача проходит через "выполняется", так как из "создана" сразу завершиться нельзя
+	if err := task.SetStatus(model.StatusRunning); err != nil {
+		service.mutex.Unlock()
+		return nil, err
+	}
+	completion, err := service.completeTask(task)
+	service.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.finishCompletion(completion); err != nil {
+		return nil, err
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	snapshot := snapshotTask(task)
+
+	return &snapshot, nil
+}
+
+// taskCompletion - завершение задачи, начатое под service.mutex (см. completeTask): архив задачи,
+// в который ещё нужно дописать манифест manifest и сохранить в хранилище архивов (см. finishCompletion).
+type taskCompletion struct {
+	task     *model.Task
+	archive  *taskArchive
+	manifest model.Manifest
+}
+
+// completeTask помечает задачу завершённой, отсоединяет от неё архив (см. detachArchive) и освобождает слот.
+// Вызывается под service.mutex. Манифест и сохранение архива - запись в хранилище архивов, поэтому после
+// разблокировки вызывающий код должен вызвать finishCompletion, который и сохранит задачу в хранилище задач.
+func (service *TaskService) completeTask(task *model.Task) (*taskCompletion, error) {
+	if err := task.SetStatus(model.StatusCompleted); err != nil {
+		return nil, err
+	}
+	completion := &taskCompletion{task: task, archive: detachArchive(task), manifest: task.Manifest()}
+	service.releaseSlot()
+
+	return completion, nil
+}
+
+// finishCompletion дописывает в архив завершённой задачи манифест (см. writeManifest), сохраняет архив
+// в хранилище архивов, сохраняет задачу и сигнализирует через DoneChannel, что архив готов.
+// Если архив сохранить не удалось, задача переводится в статус model.StatusFailed (см. model.Task.FailCompletion).
+// Вызывается без service.mutex.
+func (service *TaskService) finishCompletion(completion *taskCompletion) error {
+	task := completion.task
+	var archiveErr error
+	if completion.archive != nil {
+		archiveErr = service.writeManifest(completion.archive.writer, completion.manifest)
+		if archiveErr == nil {
+			archiveErr = completion.archive.close(true)
+		} else {
+			completion.archive.close(false)
+		}
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	defer close(task.DoneChannel)
+
+	if archiveErr != nil {
+		log.Printf("задача %d: %v", task.ID, archiveErr)
+		if err := task.FailCompletion(fmt.Sprintf("архив не удалось сохранить: %v", archiveErr)); err != nil {
+			log.Printf("задача %d: %v", task.ID, err)
+		}
+	}
+	if err := service.store.Update(task); err != nil {
+		if archiveErr != nil {
+			log.Printf("ошибка сохранения задачи %d: %v", task.ID, err)
+			return archiveErr
+		}
+		return fmt.Errorf("ошибка сохранения задачи: %w", err)
+	}
+
+	return archiveErr
+}
+
+// failFile помечает файл, который не удалось записать в архив, ошибкой.
+// Такой файл остаётся в задаче для истории, но не учитывается в лимите файлов.
+// Файлы отменённой задачи уже помечены ошибкой в abortTask, и их состояние не меняется.
+func (service *TaskService) failFile(task *model.Task, fileId int, fileErr error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	file := findTaskFile(task, fileId)
+	if file == nil && task.Status == model.StatusCancelled {
+		return
+	}
+	if file == nil {
+		task.LastError = fmt.Sprintf("файл %d: %v", fileId, fileErr)
+	} else {
+		task.LastError = fmt.Sprintf("%s: %v", file.Name, fileErr)
+		if file.Stored == false {
+			file.Error = fileErr.Error()
+			file.ErrorCode = fileErrorCode(fileErr)
+			file.Status = model.FileFailed
+			file.Credentials = nil
+		}
+	}
+
+	if err := service.store.Update(task); err != nil {
+		log.Printf("ошибка сохранения задачи %d: %v", task.ID, err)
+	}
+}
+
+// recordAttempt сохраняет в файле задачи количество сделанных попыток скачивания и ошибку последней из них.
+func (service *TaskService) recordAttempt(task *model.Task, fileId int, attempts int, attemptErr error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	file := findTaskFile(task, fileId)
+	if file == nil {
+		return
+	}
+	file.Attempts = attempts
+	file.LastError = attemptErr.Error()
+
+	if err := service.store.Update(task); err != nil {
+		log.Printf("ошибка сохранения задачи %d: %v", task.ID, err)
+	}
+}
+
+// interruptFile обрабатывает прерванное скачивание: если прерван сам родительский контекст
+// (остановка сервиса), файл возвращается в очередь в статусе model.FilePending,
+// иначе (задача отменена) помечается ошибкой через failFile.
+func (service *TaskService) interruptFile(parentCtx context.Context, task *model.Task, fileId int, err error) {
+	if parentCtx.Err() != nil && task.Context.Err() == nil {
+		service.setFileStatus(task, fileId, model.FilePending)
+		return
+	}
+
+	service.failFile(task, fileId, err)
+}
+
+// setFileStatus меняет состояние файла задачи и сохраняет задачу.
+func (service *TaskService) setFileStatus(task *model.Task, fileId int, status model.FileStatus) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	file := findTaskFile(task, fileId)
+	if file == nil {
+		return
+	}
+	file.Status = status
+
+	if err := service.store.Update(task); err != nil {
+		log.Printf("ошибка сохранения задачи %d: %v", task.ID, err)
+	}
+}
+
+// restoreFileStatus заполняет ID и состояние файла, сохранённого до появления этих полей.
+// Файл, скачивание которого было прервано перезапуском, снова ожидает скачивания.
+func restoreFileStatus(file *model.TaskFile, id int) {
+	if file.ID == 0 {
+		file.ID = id
+	}
+
+	switch {
+	case file.Stored:
+		file.Status = model.FileStored
+	case file.Error != "":
+		file.Status = model.FileFailed
 	default:
-		return fmt.Errorf("одновременно может обрабатываться только 3 файла")
+		file.Status = model.FilePending
+	}
+}
+
+// findTaskFile ищет файл задачи по ID среди файлов без ошибки.
+func findTaskFile(task *model.Task, fileId int) *model.TaskFile {
+	for i := range task.Files {
+		if task.Files[i].ID == fileId && task.Files[i].Error == "" {
+			return &task.Files[i]
+		}
+	}
+
+	return nil
+}
+
+// countActiveFiles возвращает количество файлов задачи, которые записаны или ещё записываются в архив.
+func countActiveFiles(task *model.Task) int {
+	count := 0
+	for _, file := range task.Files {
+		if file.Error == "" {
+			count++
+		}
 	}
+
+	return count
+}
+
+// checkFileURL проверяет, что файл можно скачать по URL: адрес абсолютный, со схемой http или https
+// и разрешён политикой исходящих запросов (см. util.URLPolicy), в том числе после разрешения имени хоста.
+// Ошибка политики оборачивается вместе с util.ErrURLForbidden.
+func (service *TaskService) checkFileURL(ctx context.Context, fileURL string) error {
+	parsedURL, err := url.Parse(fileURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFileURL, err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" || parsedURL.Host == "" {
+		return fmt.Errorf("%w: %q, нужен адрес http или https", ErrInvalidFileURL, fileURL)
+	}
+	if err := service.downloader.CheckURL(ctx, fileURL); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidFileURL, err)
+	}
+
+	return nil
 }
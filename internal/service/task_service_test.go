@@ -1,14 +1,64 @@
 package service
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+	"workmate_test_project/internal/store"
+	"workmate_test_project/internal/util"
 )
 
+// testDownloadOptions разрешает скачивать файлы с тестовых серверов на loopback-адресе,
+// который политика исходящих запросов по умолчанию запрещает.
+var testDownloadOptions = util.DownloaderOptions{URLPolicy: util.URLPolicy{AllowedNetworks: []string{"127.0.0.0/8"}}}
+
+// newTestTaskService создаёт сервис, хранящий в памяти и задачи, и архивы.
+func newTestTaskService(t *testing.T) *TaskService {
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{ArchiveStorage: storage.NewMemoryStorage(), Download: testDownloadOptions})
+	assert.NoError(t, err)
+	t.Cleanup(taskService.Close)
+	return taskService
+}
+
+// archiveExists сообщает, есть ли архив archiveLink в хранилище архивов сервиса.
+func archiveExists(t *testing.T, taskService *TaskService, archiveLink string) bool {
+	_, err := taskService.archives.Stat(context.Background(), archiveLink)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false
+	}
+	assert.NoError(t, err)
+	return true
+}
+
+// readTestArchive читает архив archiveLink из хранилища архивов сервиса и открывает его как ZIP.
+func readTestArchive(t *testing.T, taskService *TaskService, archiveLink string) (*zip.Reader, error) {
+	archive, err := taskService.archives.Open(context.Background(), archiveLink)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	data, err := io.ReadAll(archive)
+	assert.NoError(t, err)
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
 func TestCreateTask_Success(t *testing.T) {
-	service := NewTaskService()
+	service := newTestTaskService(t)
 
-	task, err := service.CreateTask()
+	task, err := service.CreateTask(context.Background(), "", "test1", "", "")
 	assert.NoError(t, err, "ошибка не должна возникать при создании задачи")
 	assert.NotNil(t, task, "задача не должна быть nil")
 	assert.Equal(t, 1, task.ID, "первая задача должна иметь ID = 1")
@@ -16,22 +66,323 @@ func TestCreateTask_Success(t *testing.T) {
 	assert.NotNil(t, task.FileCountChannel, "канал FileCountChannel должен быть создан")
 	assert.NotNil(t, task.DoneChannel, "канал DoneChannel должен быть создан")
 
-	service.mutex.Lock()
-	_, ok := service.tasks[task.ID]
-	service.mutex.Unlock()
-	assert.True(t, ok, "задача должна быть сохранена в сервисе")
+	_, err = service.store.Get(task.ID)
+	assert.NoError(t, err, "задача должна быть сохранена в сервисе")
 }
 
 func TestCreateTask_ExceedsLimit(t *testing.T) {
-	taskService := NewTaskService()
+	taskService := newTestTaskService(t)
 
 	for i := 0; i < 3; i++ {
-		_, err := taskService.CreateTask()
+		_, err := taskService.CreateTask(context.Background(), "", fmt.Sprintf("test%d", i), "", "")
 		assert.NoError(t, err)
 	}
 
-	task, err := taskService.CreateTask()
+	task, err := taskService.CreateTask(context.Background(), "", "test4", "", "")
 	assert.Nil(t, task, "если превышен лимит задач, задача должна быть nil")
 	assert.Error(t, err, "ожидается ошибка при создании 4-й задачи, по требованию максимум 3")
 	assert.Equal(t, "сервер в данный момент занят", err.Error())
 }
+
+func TestNewTaskService_RestoresFromJournal(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "tasks.journal")
+	archivePath := t.TempDir()
+
+	journalStore, err := store.OpenJournalStore(journalPath)
+	assert.NoError(t, err)
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{Store: journalStore, StorageRoot: archivePath, Download: testDownloadOptions})
+	assert.NoError(t, err)
+
+	_, err = taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.CreateTask(context.Background(), "", "test2", "", "")
+	assert.NoError(t, err)
+	assert.NoError(t, journalStore.Close())
+
+	journalStore, err = store.OpenJournalStore(journalPath)
+	assert.NoError(t, err)
+	defer journalStore.Close()
+	restoredService, err := NewTaskServiceWithOptions(TaskServiceOptions{Store: journalStore, StorageRoot: archivePath, Download: testDownloadOptions})
+	assert.NoError(t, err)
+
+	task, err := restoredService.GetTaskStatusById(context.Background(), 2)
+	assert.NoError(t, err, "задача должна быть восстановлена из журнала")
+	assert.Equal(t, model.StatusCreated, task.Status)
+	assert.Equal(t, "test2.zip", task.ArchiveLink)
+	assert.NotNil(t, task.FileCountChannel, "канал FileCountChannel должен быть восстановлен")
+
+	task, err = restoredService.CreateTask(context.Background(), "", "test3", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, task.ID, "счётчик ID должен продолжиться после восстановленных задач")
+}
+
+func TestFinalizeTask_WithFewerFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(writer, "%PDF-1.7 содержимое "+request.URL.Path)
+	}))
+	defer server.Close()
+
+	taskService := newTestTaskService(t)
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	fileId, err := taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/file1.pdf", "file1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fileId)
+	snapshot := waitForFiles(t, taskService, task.ID)
+	assert.Equal(t, model.FileStored, snapshot.Files[0].Status)
+
+	task, err = taskService.FinalizeTask(context.Background(), task.ID)
+	assert.NoError(t, err, "задачу с одним файлом можно завершить")
+	assert.Equal(t, model.StatusCompleted, task.Status)
+	assert.Len(t, taskService.tasksSlot, 0, "слот завершённой задачи должен быть освобождён")
+
+	select {
+	case <-task.DoneChannel:
+	default:
+		t.Error("DoneChannel должен быть закрыт после завершения задачи")
+	}
+
+	reader, err := readTestArchive(t, taskService, task.ArchiveLink)
+	assert.NoError(t, err, "архив завершённой задачи должен открываться")
+	assert.Len(t, reader.File, 2, "кроме файла, в архив записывается манифест")
+
+	_, err = taskService.FinalizeTask(context.Background(), task.ID)
+	assert.ErrorIs(t, err, model.ErrInvalidTransition, "повторно завершить задачу нельзя")
+
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/file2.pdf", "file2")
+	assert.ErrorIs(t, err, model.ErrInvalidTransition, "в завершённую задачу нельзя добавить файл")
+}
+
+func TestFinalizeTask_Empty(t *testing.T) {
+	taskService := newTestTaskService(t)
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+
+	task, err = taskService.FinalizeTask(context.Background(), task.ID)
+	assert.NoError(t, err, "пустую задачу тоже можно завершить")
+	assert.Equal(t, model.StatusCompleted, task.Status)
+	assert.Len(t, taskService.tasksSlot, 0)
+}
+
+func TestTaskService_ConfiguredLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(writer, "содержимое "+request.URL.String())
+	}))
+	defer server.Close()
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:    testDownloadOptions,
+		StorageRoot: t.TempDir(),
+		Limits: TaskLimits{
+			MaxActiveTasks:   1,
+			MaxFilesPerTask:  2,
+			AllowedMIMETypes: []string{"text/plain"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cap(taskService.tasksSlot))
+	assert.Equal(t, DefaultTaskLimits().DownloadConcurrency, taskService.Limits().DownloadConcurrency,
+		"незаданный лимит должен браться из значений по умолчанию")
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.CreateTask(context.Background(), "", "test2", "", "")
+	assert.ErrorIs(t, err, ErrServerBusy)
+
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, "ftp://example.com/file1.txt", "file1")
+	assert.ErrorIs(t, err, ErrInvalidFileURL)
+
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/file1.txt?sig=abc", "file1")
+	assert.NoError(t, err, "параметры запроса в URL не мешают добавлению файла")
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/file2.txt", "file1")
+	assert.Error(t, err, "имя файла в задаче должно быть уникальным")
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/download?id=2", "file2")
+	assert.NoError(t, err, "расширение в URL не обязательно")
+
+	select {
+	case <-task.DoneChannel:
+	case <-time.After(3 * time.Second):
+		t.Fatal("задача должна завершиться после MaxFilesPerTask файлов")
+	}
+	snapshot, err := taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.StatusCompleted, snapshot.Status, "задача завершается после MaxFilesPerTask файлов")
+	assert.Equal(t, "file1.txt", snapshot.Files[0].ArchiveName)
+	assert.Equal(t, "file2.txt", snapshot.Files[1].ArchiveName, "расширение берётся из типа содержимого")
+}
+
+func TestAddFileToTask_DetectsContentType(t *testing.T) {
+	pngHeader := "\x89PNG\r\n\x1a\n"
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/download":
+			writer.Header().Set("Content-Type", "application/octet-stream")
+			io.WriteString(writer, pngHeader+"изображение")
+		case "/photo.jpg":
+			writer.Header().Set("Content-Type", "image/jpeg")
+			io.WriteString(writer, "<!DOCTYPE html><html><body>404</body></html>")
+		default:
+			io.WriteString(writer, "%PDF-1.7 содержимое "+request.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	taskService := newTestTaskService(t)
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+
+	for i, fileURL := range []string{"/file.pdf?sig=abc", "/download?id=1", "/photo.jpg"} {
+		_, err := taskService.AddFileToTask(context.Background(), task.ID, server.URL+fileURL, fmt.Sprintf("file%d", i+1))
+		assert.NoError(t, err)
+	}
+	snapshot := waitForFiles(t, taskService, task.ID)
+
+	assert.Equal(t, model.FileStored, snapshot.Files[0].Status)
+	assert.Equal(t, "file1.pdf", snapshot.Files[0].ArchiveName)
+	assert.Equal(t, "application/pdf", snapshot.Files[0].ContentType, "без Content-Type тип определяется по сигнатуре")
+
+	assert.Equal(t, model.FileStored, snapshot.Files[1].Status)
+	assert.Equal(t, "file2.png", snapshot.Files[1].ArchiveName, "расширение записи берётся из типа содержимого")
+	assert.Equal(t, "image/png", snapshot.Files[1].ContentType)
+
+	assert.Equal(t, model.FileFailed, snapshot.Files[2].Status, "HTML-страница не должна приниматься за изображение")
+	assert.Contains(t, snapshot.Files[2].Error, "text/html")
+}
+
+func TestAddFileToTask_URLPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		http.Redirect(writer, request, "http://10.0.0.1/file.pdf", http.StatusFound)
+	}))
+	defer server.Close()
+
+	taskService := newTestTaskService(t)
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+
+	for _, fileURL := range []string{"http://169.254.169.254/latest/meta-data/", "http://192.168.0.1/file.pdf", "http://[::1]/file.pdf"} {
+		_, err = taskService.AddFileToTask(context.Background(), task.ID, fileURL, "file1")
+		assert.ErrorIs(t, err, ErrInvalidFileURL, fileURL)
+		assert.ErrorIs(t, err, util.ErrURLForbidden, fileURL)
+	}
+
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/redirect.pdf", "file1")
+	assert.NoError(t, err)
+	snapshot := waitForFiles(t, taskService, task.ID)
+	assert.Len(t, snapshot.Files, 1, "запрещённые адреса не добавляются в задачу")
+	assert.Equal(t, model.FileFailed, snapshot.Files[0].Status)
+	assert.Equal(t, FileErrorForbiddenURL, snapshot.Files[0].ErrorCode, "перенаправление на внутренний адрес запрещено")
+}
+
+func TestAddFileToTask_Async(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		<-release
+		if request.URL.Path == "/missing.pdf" {
+			http.NotFound(writer, request)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(writer, "%PDF-1.7 содержимое "+request.URL.Path)
+	}))
+	defer server.Close()
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		Download:    testDownloadOptions,
+		StorageRoot: t.TempDir(),
+		Limits:      TaskLimits{DownloadWorkers: 1, DownloadQueueSize: 1},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+
+	firstId, err := taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/file1.pdf", "file1")
+	assert.NoError(t, err, "файл должен ставиться в очередь, не дожидаясь скачивания")
+	assert.Eventually(t, func() bool {
+		snapshot, _ := taskService.GetTaskSnapshot(context.Background(), task.ID)
+		return snapshot.Files[0].Status == model.FileDownloading
+	}, 3*time.Second, 10*time.Millisecond, "единственная горутина пула должна взять файл в работу")
+
+	secondId, err := taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/missing.pdf", "file2")
+	assert.NoError(t, err)
+	assert.Equal(t, firstId+1, secondId)
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/file3.pdf", "file3")
+	assert.ErrorIs(t, err, ErrDownloadQueueFull, "очередь скачивания ограничена DownloadQueueSize")
+
+	snapshot, err := taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Len(t, snapshot.Files, 2, "файл, не попавший в очередь, не должен добавляться в задачу")
+	assert.Equal(t, model.FilePending, snapshot.Files[1].Status)
+
+	close(release)
+	snapshot = waitForFiles(t, taskService, task.ID)
+	assert.Equal(t, model.FileStored, snapshot.Files[0].Status)
+	assert.Equal(t, model.FileFailed, snapshot.Files[1].Status)
+	assert.NotEmpty(t, snapshot.Files[1].Error)
+	assert.Equal(t, 1, snapshot.FilesAdded)
+}
+
+func TestDownloadFile_RecordsAttempts(t *testing.T) {
+	var flakyRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/broken.pdf" || (request.URL.Path == "/flaky.pdf" && flakyRequests.Add(1) == 1) {
+			writer.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(writer, "%PDF-1.7 содержимое "+request.URL.Path)
+	}))
+	defer server.Close()
+
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		ArchiveStorage: storage.NewMemoryStorage(),
+		Download: util.DownloaderOptions{
+			MaxAttempts:    2,
+			RetryBaseDelay: time.Millisecond,
+			URLPolicy:      testDownloadOptions.URLPolicy,
+		},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/flaky.pdf", "flaky")
+	assert.NoError(t, err)
+	_, err = taskService.AddFileToTask(context.Background(), task.ID, server.URL+"/broken.pdf", "broken")
+	assert.NoError(t, err)
+
+	snapshot := waitForFiles(t, taskService, task.ID)
+	assert.Equal(t, model.FileStored, snapshot.Files[0].Status, "временная ошибка должна повторяться")
+	assert.Equal(t, 2, snapshot.Files[0].Attempts)
+	assert.Contains(t, snapshot.Files[0].LastError, "502", "ошибка неудачной попытки сохраняется и после успешного повтора")
+	assert.Equal(t, model.FileFailed, snapshot.Files[1].Status)
+	assert.Equal(t, 2, snapshot.Files[1].Attempts, "попыток не больше MaxAttempts")
+	assert.Contains(t, snapshot.Files[1].Error, "попыток: 2")
+}
+
+// waitForFiles дожидается, пока все файлы задачи будут записаны в архив или завершатся ошибкой,
+// и возвращает копию задачи.
+func waitForFiles(t *testing.T, taskService *TaskService, taskId int) model.Task {
+	var snapshot model.Task
+	assert.Eventually(t, func() bool {
+		var err error
+		snapshot, err = taskService.GetTaskSnapshot(context.Background(), taskId)
+		if err != nil {
+			return false
+		}
+		for _, file := range snapshot.Files {
+			if file.Status == model.FilePending || file.Status == model.FileDownloading {
+				return false
+			}
+		}
+		return true
+	}, 3*time.Second, 10*time.Millisecond, "файлы задачи должны быть обработаны")
+
+	return snapshot
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/util"
+)
+
+var (
+	// ErrUploadInterrupted возвращается для загруженного клиентом файла, который не успел записаться в архив
+	// до перезапуска сервера: содержимое такого файла взять негде, его нужно загрузить заново.
+	ErrUploadInterrupted = errors.New("загрузка файла прервана перезапуском сервера, загрузите файл заново")
+	// ErrUploadFailed возвращается, если файл не удалось принять от клиента: тело запроса оборвалось,
+	// загрузку прервали или содержимое не удалось сохранить.
+	ErrUploadFailed = errors.New("ошибка загрузки файла")
+)
+
+// FileUpload - файл, который клиент загружает в теле запроса.
+// Name - имя файла в архиве без расширения, как в AddFileToTask (расширение добавляется по типу содержимого)
+// OriginalName - исходное имя файла у клиента, попадает в манифест (может быть пустым)
+// ContentType - тип, объявленный клиентом; окончательно тип определяется по содержимому
+// Size - размер файла, если он известен заранее (Content-Length), иначе -1
+// Body - содержимое файла
+// Interrupt - прерывает заблокированное чтение Body (например, выставляет соединению дедлайн чтения),
+// вызывается, если загрузку нужно прервать: задача отменена или сервис останавливается; может быть nil
+type FileUpload struct {
+	Name         string
+	OriginalName string
+	ContentType  string
+	Size         int64
+	Body         io.Reader
+	Interrupt    func()
+}
+
+// UploadFileToTask добавляет к задаче файл, загруженный клиентом, и возвращает его ID внутри задачи.
+// Файл проходит те же проверки, что и файл, скачанный по URL (см. AddFileToTask): задача должна принимать
+// файлы, файл учитывается в limits.MaxFilesPerTask, его тип определяется по содержимому и проверяется
+// по limits.AllowedMIMETypes, размер ограничен limits.MaxFileSize, MaxTaskSize и DiskBudget.
+//
+// В отличие от AddFileToTask метод возвращает управление, только когда содержимое прочитано:
+// файл сохраняется во временный файл потоком, не держась целиком в памяти, и передаётся в commitFiles,
+// который запишет его в архив в порядке добавления файлов в задачу. Одновременно в задачу сохраняется
+// не больше limits.DownloadConcurrency файлов вместе со скачиваемыми.
+//
+// Если файл не удалось сохранить, он остаётся в задаче со статусом model.FileFailed, ошибкой и кодом
+// (например, FileErrorTooLarge), а метод возвращает ту же ошибку. Файл, который не успел записаться
+// в архив до перезапуска сервера, после перезапуска завершается ошибкой ErrUploadInterrupted.
+func (service *TaskService) UploadFileToTask(ctx context.Context, taskId int, upload FileUpload) (int, error) {
+	service.mutex.Lock()
+	task, fileId, err := service.addTaskFile(ctx, taskId, model.TaskFile{
+		Name:         upload.Name,
+		Status:       model.FileDownloading,
+		Uploaded:     true,
+		OriginalName: upload.OriginalName,
+	})
+	service.mutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	return fileId, service.uploadFile(ctx, task, fileId, upload)
+}
+
+// uploadFile сохраняет содержимое загружаемого файла во временный файл и передаёт его в commitFiles,
+// так же как downloadFile - скачанный. Загрузка прерывается при отмене ctx, задачи или остановке сервиса;
+// прерванный файл, в отличие от скачиваемого, не возвращается в очередь, а помечается ошибкой.
+func (service *TaskService) uploadFile(ctx context.Context, task *model.Task, fileId int, upload FileUpload) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopTask := context.AfterFunc(task.Context, cancel)
+	defer stopTask()
+	stopWorkers := context.AfterFunc(service.workersCtx, cancel)
+	defer stopWorkers()
+	if upload.Interrupt != nil {
+		stopInterrupt := context.AfterFunc(ctx, upload.Interrupt)
+		defer stopInterrupt()
+	}
+
+	select {
+	case <-ctx.Done():
+		interruptErr := fmt.Errorf("загрузка прервана: %w", ctx.Err())
+		// failUpload пишет в архив следующие файлы, а писать в архив можно только с разрешением (см. abortTask)
+		select {
+		case task.FileCountChannel <- struct{}{}:
+			defer func() {
+				<-task.FileCountChannel
+			}()
+			return service.failUpload(task, fileId, interruptErr)
+
+		case <-task.Context.Done():
+			// задача отменена, в её архив больше ничего не пишется
+			interruptErr = fmt.Errorf("%w: %w", ErrUploadFailed, interruptErr)
+			service.failFile(task, fileId, interruptErr)
+			return interruptErr
+		}
+
+	case task.FileCountChannel <- struct{}{}:
+		// разрешение держится и во время записи в архив, см. downloadFile
+		defer func() {
+			<-task.FileCountChannel
+		}()
+	}
+
+	quota := &downloadQuota{service: service, task: task}
+	spooled, err := util.SpoolUpload(ctx, upload.Body, util.UploadRequest{
+		SpoolDir:         service.spoolDir,
+		AllowedMIMETypes: service.limits.AllowedMIMETypes,
+		Quota:            quota,
+		ContentType:      upload.ContentType,
+		Size:             upload.Size,
+	})
+	if err == nil && ctx.Err() != nil {
+		// загрузку прервали, когда файл уже дочитан: в архив он не попадёт
+		os.Remove(spooled.Path)
+		err = fmt.Errorf("загрузка прервана: %w", ctx.Err())
+	}
+	if err == nil {
+		err = service.attachSpool(task, fileId, spooled, quota)
+	} else {
+		quota.release()
+	}
+	if err != nil {
+		return service.failUpload(task, fileId, err)
+	}
+
+	return service.commitFiles(task)
+}
+
+// failUpload помечает загружаемый файл ошибкой и продолжает запись в архив следующих за ним файлов.
+// Возвращает ошибку файла. Вызывается с занятым разрешением task.FileCountChannel.
+func (service *TaskService) failUpload(task *model.Task, fileId int, uploadErr error) error {
+	uploadErr = fmt.Errorf("%w: %w", ErrUploadFailed, uploadErr)
+	service.failFile(task, fileId, uploadErr)
+	// следующие файлы могли уже скачаться и ждать, пока запишется этот
+	if err := service.commitFiles(task); err != nil {
+		log.Printf("ошибка записи файлов задачи %d в архив: %v", task.ID, err)
+	}
+
+	return uploadErr
+}
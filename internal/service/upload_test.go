@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"workmate_test_project/internal/model"
+	"workmate_test_project/internal/storage"
+)
+
+// endlessPDF - бесконечное содержимое, которое по первым байтам определяется как PDF.
+type endlessPDF struct {
+	read int
+}
+
+func (reader *endlessPDF) Read(data []byte) (int, error) {
+	n := copy(data, strings.Repeat("%PDF-1.7 ", len(data)/9+1))
+	reader.read += n
+	return n, nil
+}
+
+func TestUploadFileToTask(t *testing.T) {
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		ArchiveStorage: storage.NewMemoryStorage(),
+		Limits:         TaskLimits{MaxFilesPerTask: 2, MaxFileSize: 1 << 20},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+
+	endless := &endlessPDF{}
+	fileId, err := taskService.UploadFileToTask(context.Background(), task.ID, FileUpload{Name: "endless", Size: -1, Body: endless})
+	assert.ErrorIs(t, err, ErrFileTooLarge, "файл без размера прерывается, как только превысит лимит")
+	assert.Less(t, endless.read, 2<<20, "содержимое сверх лимита не читается")
+	file, err := taskService.GetTaskFile(context.Background(), task.ID, fileId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.FileFailed, file.Status)
+	assert.Equal(t, FileErrorTooLarge, file.ErrorCode)
+
+	declared := &endlessPDF{}
+	_, err = taskService.UploadFileToTask(context.Background(), task.ID, FileUpload{Name: "declared", Size: 2 << 20, Body: declared})
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+	assert.Zero(t, declared.read, "объявленный размер проверяется до чтения содержимого")
+
+	fileId, err = taskService.UploadFileToTask(context.Background(), task.ID, FileUpload{
+		Name:         "report",
+		OriginalName: "report.pdf",
+		Size:         -1,
+		Body:         strings.NewReader("%PDF-1.7 отчёт"),
+	})
+	assert.NoError(t, err)
+	file, err = taskService.GetTaskFile(context.Background(), task.ID, fileId)
+	assert.NoError(t, err)
+	assert.Equal(t, model.FileStored, file.Status)
+	assert.Equal(t, "report.pdf", file.ArchiveName)
+
+	snapshot, err := taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("%PDF-1.7 отчёт")), snapshot.UsedBytes, "место отклонённых файлов освобождено")
+	assert.Equal(t, 1, countActiveFiles(&snapshot), "отклонённые файлы не учитываются в лимите файлов")
+
+	// так выглядит после перезапуска загруженный файл, который не успел записаться в архив:
+	// восстановление ставит его в очередь скачивания, но взять его содержимое негде
+	taskService.mutex.Lock()
+	restoredTask, err := taskService.GetTaskStatusById(context.Background(), task.ID)
+	assert.NoError(t, err)
+	restoredTask.Files = append(restoredTask.Files, model.TaskFile{ID: 4, Name: "lost", Uploaded: true, Status: model.FilePending})
+	taskService.mutex.Unlock()
+	err = taskService.downloadFile(context.Background(), restoredTask, 4)
+	assert.ErrorIs(t, err, ErrUploadInterrupted)
+	snapshot, err = taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, FileErrorUploadInterrupted, snapshot.Files[3].ErrorCode)
+}
+
+func TestUploadFileToTask_CancelTask(t *testing.T) {
+	taskService := newTestTaskService(t)
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+
+	reader, writer := io.Pipe()
+	go io.WriteString(writer, "%PDF-1.7 начало файла, остальное клиент не присылает")
+
+	interrupted := make(chan struct{})
+	uploadErr := make(chan error, 1)
+	go func() {
+		_, err := taskService.UploadFileToTask(context.Background(), task.ID, FileUpload{
+			Name: "slow",
+			Size: -1,
+			Body: reader,
+			Interrupt: func() {
+				close(interrupted)
+				reader.CloseWithError(errors.New("соединение закрыто"))
+			},
+		})
+		uploadErr <- err
+	}()
+
+	assert.Eventually(t, func() bool {
+		file, err := taskService.GetTaskFile(context.Background(), task.ID, 1)
+		return err == nil && file.Status == model.FileDownloading
+	}, time.Second, 5*time.Millisecond)
+	_, err = taskService.CancelTask(context.Background(), task.ID, false)
+	assert.NoError(t, err, "отмена задачи не ждёт, пока клиент дошлёт файл")
+
+	<-interrupted
+	assert.Error(t, <-uploadErr)
+	snapshot, err := taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.FileFailed, snapshot.Files[0].Status)
+}
+
+func TestUploadFileToTask_InterruptedWaitsForPermit(t *testing.T) {
+	taskService, err := NewTaskServiceWithOptions(TaskServiceOptions{
+		ArchiveStorage: storage.NewMemoryStorage(),
+		Limits:         TaskLimits{DownloadConcurrency: 1},
+	})
+	assert.NoError(t, err)
+	defer taskService.Close()
+
+	task, err := taskService.CreateTask(context.Background(), "", "test1", "", "")
+	assert.NoError(t, err)
+
+	// первая загрузка занимает единственное разрешение, пока клиент не дошлёт файл
+	reader, writer := io.Pipe()
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := taskService.UploadFileToTask(context.Background(), task.ID, FileUpload{Name: "first", Size: -1, Body: reader})
+		firstErr <- err
+	}()
+	_, err = io.WriteString(writer, "%PDF-1.7 начало файла")
+	assert.NoError(t, err)
+
+	// клиент второй загрузки отключился, пока ждал разрешения: без разрешения в архив писать нельзя
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	secondErr := make(chan error, 1)
+	go func() {
+		_, err := taskService.UploadFileToTask(ctx, task.ID, FileUpload{Name: "second", Size: -1, Body: strings.NewReader("%PDF-1.7")})
+		secondErr <- err
+	}()
+	assert.Never(t, func() bool {
+		return len(secondErr) > 0
+	}, 50*time.Millisecond, 5*time.Millisecond, "прерванная загрузка ждёт разрешения, чтобы записать следующие файлы")
+
+	writer.Close()
+	assert.NoError(t, <-firstErr)
+	assert.ErrorIs(t, <-secondErr, context.Canceled)
+
+	snapshot, err := taskService.GetTaskSnapshot(context.Background(), task.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.FileStored, snapshot.Files[0].Status)
+	assert.Equal(t, model.FileFailed, snapshot.Files[1].Status)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"workmate_test_project/internal/model"
+)
+
+// ErrDownloadQueueFull возвращается, если очередь скачивания файлов заполнена.
+var ErrDownloadQueueFull = errors.New("очередь скачивания файлов заполнена")
+
+// fileJob - задание на скачивание файла задачи в её архив.
+type fileJob struct {
+	task   *model.Task
+	fileId int
+}
+
+// startWorkers запускает пул из limits.DownloadWorkers горутин, которые скачивают файлы
+// из очереди service.jobs (размером limits.DownloadQueueSize) и записывают их в архивы задач.
+// Пул останавливается в Close.
+func (service *TaskService) startWorkers() {
+	service.workersCtx, service.workersCancel = context.WithCancel(context.Background())
+
+	for i := 0; i < service.limits.DownloadWorkers; i++ {
+		service.workersWait.Add(1)
+		go func() {
+			defer service.workersWait.Done()
+
+			for {
+				select {
+				case <-service.workersCtx.Done():
+					return
+				case job := <-service.jobs:
+					if err := service.downloadFile(service.workersCtx, job.task, job.fileId); err != nil {
+						log.Printf("ошибка скачивания файла %d задачи %d: %v", job.fileId, job.task.ID, err)
+					}
+				}
+			}
+		}()
+	}
+}
+
+// stopWorkers прерывает текущие скачивания и дожидается завершения пула.
+// Прерванные, ещё не начатые и скачанные, но не записанные в архив файлы остаются в статусе
+// model.FilePending (их временные файлы удаляются), поэтому при долговременном хранилище
+// они будут скачаны заново после перезапуска (см. recoverUnfinishedTasks).
+func (service *TaskService) stopWorkers() {
+	if service.workersCancel == nil {
+		return
+	}
+
+	service.workersCancel()
+	service.workersWait.Wait()
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	tasks, err := service.store.List()
+	if err != nil {
+		log.Printf("ошибка загрузки задач при остановке: %v", err)
+		return
+	}
+	for _, task := range tasks {
+		service.discardSpooledFiles(task, "")
+	}
+}
+
+// enqueueFile ставит файл задачи в очередь скачивания, не дожидаясь свободного места.
+// Возвращает false, если очередь заполнена.
+func (service *TaskService) enqueueFile(task *model.Task, fileId int) bool {
+	select {
+	case service.jobs <- fileJob{task: task, fileId: fileId}:
+		return true
+	default:
+		return false
+	}
+}
+
+// requeueFile ставит в очередь скачивания файл, который не успел записаться в архив до перезапуска.
+// В отличие от enqueueFile ждёт свободного места в очереди, так как файл уже принят в задачу.
+func (service *TaskService) requeueFile(task *model.Task, fileId int) {
+	select {
+	case <-service.workersCtx.Done():
+	case service.jobs <- fileJob{task: task, fileId: fileId}:
+	}
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage хранит архивы в каталоге на диске.
+// Все файлы открываются через os.Root, поэтому ни "../" в имени, ни символические ссылки
+// не позволяют выйти за пределы корневого каталога.
+// Данные архива пишутся сразу в итоговый файл: архив, запись в который оборвалась при падении процесса,
+// можно открыть через Open и восстановить (см. util.RecoverArchive).
+type LocalStorage struct {
+	root *os.Root
+	path string
+}
+
+// NewLocalStorage создаёт (при необходимости) корневой каталог rootPath и открывает хранилище в нём.
+func NewLocalStorage(rootPath string) (*LocalStorage, error) {
+	absolutePath, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка определения каталога архивов: %w", err)
+	}
+	if err := os.MkdirAll(absolutePath, 0755); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога архивов: %w", err)
+	}
+	root, err := os.OpenRoot(absolutePath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия каталога архивов: %w", err)
+	}
+
+	return &LocalStorage{root: root, path: absolutePath}, nil
+}
+
+// Path возвращает полный путь до корневого каталога хранилища.
+func (storage *LocalStorage) Path() string {
+	return storage.path
+}
+
+func (storage *LocalStorage) Create(ctx context.Context, name string, overwrite bool) (ArchiveWriter, error) {
+	relativePath, err := storage.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.mkdirAll(filepath.Dir(relativePath)); err != nil {
+		return nil, err
+	}
+
+	flags := os.O_RDWR | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flags = os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := storage.root.OpenFile(relativePath, flags, 0644)
+	if err != nil {
+		return nil, storage.wrapError(name, err)
+	}
+
+	return &localWriter{File: file, storage: storage, relativePath: relativePath}, nil
+}
+
+func (storage *LocalStorage) Open(ctx context.Context, name string) (ArchiveReader, error) {
+	relativePath, err := storage.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := storage.root.Open(relativePath)
+	if err != nil {
+		return nil, storage.wrapError(name, err)
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("ошибка чтения архива %s: %w", name, err)
+	}
+
+	return &localReader{File: file, info: ArchiveInfo{Name: name, Size: fileInfo.Size(), ModTime: fileInfo.ModTime()}}, nil
+}
+
+func (storage *LocalStorage) Stat(ctx context.Context, name string) (ArchiveInfo, error) {
+	relativePath, err := storage.resolve(name)
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+
+	fileInfo, err := storage.root.Stat(relativePath)
+	if err != nil {
+		return ArchiveInfo{}, storage.wrapError(name, err)
+	}
+
+	return ArchiveInfo{Name: name, Size: fileInfo.Size(), ModTime: fileInfo.ModTime()}, nil
+}
+
+func (storage *LocalStorage) Delete(ctx context.Context, name string) error {
+	relativePath, err := storage.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.root.Remove(relativePath); err != nil {
+		return storage.wrapError(name, err)
+	}
+
+	return nil
+}
+
+func (storage *LocalStorage) Close() error {
+	return storage.root.Close()
+}
+
+// resolve переводит имя архива в путь относительно корневого каталога.
+// Полные пути внутри корневого каталога тоже принимаются: так хранятся ссылки на архивы
+// в журнале задач, записанном до появления хранилищ архивов.
+func (storage *LocalStorage) resolve(name string) (string, error) {
+	relativePath := filepath.FromSlash(name)
+	if filepath.IsAbs(relativePath) {
+		var err error
+		relativePath, err = filepath.Rel(storage.path, relativePath)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", ErrInvalidName, name)
+		}
+	}
+	if filepath.IsLocal(relativePath) == false {
+		return "", fmt.Errorf("%w: %s вне корневого каталога архивов", ErrInvalidName, name)
+	}
+
+	return relativePath, nil
+}
+
+// mkdirAll создаёт каталог relativeDir внутри корневого каталога со всеми родительскими каталогами.
+func (storage *LocalStorage) mkdirAll(relativeDir string) error {
+	if relativeDir == "." {
+		return nil
+	}
+
+	current := ""
+	for _, part := range strings.Split(relativeDir, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		err := storage.root.Mkdir(current, 0755)
+		if err != nil && errors.Is(err, fs.ErrExist) == false {
+			return storage.wrapError(current, err)
+		}
+	}
+
+	return nil
+}
+
+// wrapError переводит ошибки файловой системы в ошибки хранилища.
+// os.Root не экспортирует ошибку выхода за пределы корня, поэтому все ошибки, кроме отсутствия файла,
+// его существования и прав доступа, считаются следствием недопустимого пути.
+func (storage *LocalStorage) wrapError(name string, err error) error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	case errors.Is(err, fs.ErrExist):
+		return fmt.Errorf("%w: %s", ErrExists, name)
+	case errors.Is(err, fs.ErrPermission):
+		return fmt.Errorf("ошибка доступа к архиву %s: %w", name, err)
+	default:
+		return fmt.Errorf("%w: %v", ErrInvalidName, err)
+	}
+}
+
+// localWriter пишет архив прямо в итоговый файл.
+type localWriter struct {
+	*os.File
+	storage      *LocalStorage
+	relativePath string
+}
+
+func (writer *localWriter) Finalize() error {
+	if err := writer.File.Sync(); err != nil {
+		writer.File.Close()
+		return fmt.Errorf("ошибка записи архива на диск: %w", err)
+	}
+	if err := writer.File.Close(); err != nil {
+		return fmt.Errorf("ошибка закрытия файла архива: %w", err)
+	}
+
+	return nil
+}
+
+func (writer *localWriter) Abort() error {
+	writer.File.Close()
+	if err := writer.storage.root.Remove(writer.relativePath); err != nil && errors.Is(err, fs.ErrNotExist) == false {
+		return fmt.Errorf("ошибка удаления архива: %w", err)
+	}
+
+	return nil
+}
+
+type localReader struct {
+	*os.File
+	info ArchiveInfo
+}
+
+func (reader *localReader) Info() ArchiveInfo {
+	return reader.info
+}
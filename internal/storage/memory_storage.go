@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// MemoryStorage хранит архивы в памяти процесса, используется в тестах.
+// Как и в LocalStorage, имя архива занимается сразу при Create (пустым архивом),
+// а записанные данные появляются после Finalize.
+type MemoryStorage struct {
+	mutex   sync.Mutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryStorage создаёт пустое хранилище в памяти.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{objects: make(map[string]memoryObject)}
+}
+
+func (storage *MemoryStorage) Create(ctx context.Context, name string, overwrite bool) (ArchiveWriter, error) {
+	if fs.ValidPath(name) == false || name == "." {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if _, ok := storage.objects[name]; ok && overwrite == false {
+		return nil, fmt.Errorf("%w: %s", ErrExists, name)
+	}
+	storage.objects[name] = memoryObject{modTime: time.Now()}
+
+	return &memoryWriter{storage: storage, name: name}, nil
+}
+
+func (storage *MemoryStorage) Open(ctx context.Context, name string) (ArchiveReader, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	object, ok := storage.objects[name]
+	if ok == false {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	return &memoryReader{
+		Reader: bytes.NewReader(object.data),
+		info:   ArchiveInfo{Name: name, Size: int64(len(object.data)), ModTime: object.modTime},
+	}, nil
+}
+
+func (storage *MemoryStorage) Stat(ctx context.Context, name string) (ArchiveInfo, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	object, ok := storage.objects[name]
+	if ok == false {
+		return ArchiveInfo{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	return ArchiveInfo{Name: name, Size: int64(len(object.data)), ModTime: object.modTime}, nil
+}
+
+func (storage *MemoryStorage) Delete(ctx context.Context, name string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if _, ok := storage.objects[name]; ok == false {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	delete(storage.objects, name)
+
+	return nil
+}
+
+func (storage *MemoryStorage) Close() error {
+	return nil
+}
+
+type memoryWriter struct {
+	bytes.Buffer
+	storage *MemoryStorage
+	name    string
+}
+
+func (writer *memoryWriter) Finalize() error {
+	writer.storage.mutex.Lock()
+	defer writer.storage.mutex.Unlock()
+
+	writer.storage.objects[writer.name] = memoryObject{data: bytes.Clone(writer.Bytes()), modTime: time.Now()}
+	return nil
+}
+
+func (writer *memoryWriter) Abort() error {
+	writer.storage.mutex.Lock()
+	defer writer.storage.mutex.Unlock()
+
+	delete(writer.storage.objects, writer.name)
+	return nil
+}
+
+type memoryReader struct {
+	*bytes.Reader
+	info ArchiveInfo
+}
+
+func (reader *memoryReader) Info() ArchiveInfo {
+	return reader.info
+}
+
+func (reader *memoryReader) Close() error {
+	return nil
+}
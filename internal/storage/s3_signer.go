@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash - SHA-256 пустого тела запроса.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Signer подписывает запросы к S3 по схеме AWS Signature Version 4 (заголовок Authorization).
+type s3Signer struct {
+	accessKey string
+	secretKey string
+	region    string
+}
+
+// sign добавляет к запросу заголовки X-Amz-Date, X-Amz-Content-Sha256 и Authorization.
+// Подписываются заголовок Host и все заголовки запроса, кроме Authorization, Content-Length и User-Agent,
+// поэтому заголовки нужно выставлять до подписи.
+func (signer s3Signer) sign(request *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + signer.region + "/s3/aws4_request"
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range request.Header {
+		name = strings.ToLower(name)
+		if name == "authorization" || name == "content-length" || name == "user-agent" {
+			continue
+		}
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalPath := request.URL.Path
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		s3URIEncode(canonicalPath, false),
+		s3CanonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+signer.secretKey), amzDate[:8])
+	key = hmacSHA256(key, signer.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+signer.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery возвращает параметры запроса в каноническом виде: отсортированными по имени
+// и закодированными по правилам s3URIEncode.
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, s3URIEncode(key, true)+"="+s3URIEncode(value, true))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// s3URIEncode кодирует строку так, как этого требует SigV4: без изменений остаются только
+// латинские буквы, цифры и символы "-._~", а "/" - ещё и в пути (encodeSlash = false).
+func s3URIEncode(value string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			builder.WriteByte(c)
+		case c == '/' && encodeSlash == false:
+			builder.WriteByte(c)
+		default:
+			builder.WriteByte('%')
+			builder.WriteByte(hexDigits[c>>4])
+			builder.WriteByte(hexDigits[c&15])
+		}
+	}
+
+	return builder.String()
+}
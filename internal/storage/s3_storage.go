@@ -0,0 +1,432 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultS3PartSize - размер части multipart upload по умолчанию.
+// AWS S3 и MinIO не принимают части меньше 5 МиБ (кроме последней).
+const DefaultS3PartSize = 5 << 20
+
+// S3Options - параметры S3Storage.
+// Endpoint - адрес S3-совместимого хранилища, например "https://s3.eu-central-1.amazonaws.com"
+// или "http://localhost:9000" для MinIO; запросы отправляются в path-style: {Endpoint}/{Bucket}/{Prefix}{имя архива}
+// Region - регион для подписи запросов (по умолчанию "us-east-1")
+// Bucket - бакет для архивов
+// AccessKey, SecretKey - ключи доступа
+// Prefix - префикс имён объектов, например "archives/"
+// PartSize - размер части multipart upload (по умолчанию DefaultS3PartSize)
+// HTTPClient - HTTP-клиент для запросов (по умолчанию новый http.Client)
+type S3Options struct {
+	Endpoint   string
+	Region     string
+	Bucket     string
+	AccessKey  string
+	SecretKey  string
+	Prefix     string
+	PartSize   int
+	HTTPClient *http.Client
+}
+
+// S3Storage хранит архивы в S3-совместимом объектном хранилище.
+// Архив загружается по частям (multipart upload) по мере записи: в памяти держится не больше одной части.
+// Архив, запись которого уместилась в одну часть, загружается одним запросом PUT.
+// Незавершённый архив в хранилище не виден, поэтому после падения процесса его нельзя восстановить.
+//
+// Существование архива при overwrite = false проверяется в Create и ещё раз при завершении загрузки
+// (заголовок If-None-Match: *), так что параллельная запись не перезапишет чужой архив.
+type S3Storage struct {
+	endpoint *url.URL
+	bucket   string
+	prefix   string
+	partSize int
+	signer   s3Signer
+	client   *http.Client
+}
+
+// NewS3Storage проверяет параметры и создаёт хранилище. Обращений к S3 при создании не выполняется.
+func NewS3Storage(options S3Options) (*S3Storage, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(options.Endpoint, "/"))
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("некорректный адрес S3: %q", options.Endpoint)
+	}
+	if options.Bucket == "" {
+		return nil, errors.New("не указан бакет S3")
+	}
+
+	storage := &S3Storage{
+		endpoint: endpoint,
+		bucket:   options.Bucket,
+		partSize: options.PartSize,
+		signer:   s3Signer{accessKey: options.AccessKey, secretKey: options.SecretKey, region: options.Region},
+		client:   options.HTTPClient,
+	}
+	if prefix := strings.Trim(options.Prefix, "/"); prefix != "" {
+		storage.prefix = prefix + "/"
+	}
+	if storage.partSize <= 0 {
+		storage.partSize = DefaultS3PartSize
+	}
+	if storage.signer.region == "" {
+		storage.signer.region = "us-east-1"
+	}
+	if storage.client == nil {
+		storage.client = &http.Client{}
+	}
+
+	return storage, nil
+}
+
+func (storage *S3Storage) Create(ctx context.Context, name string, overwrite bool) (ArchiveWriter, error) {
+	key, err := storage.objectKey(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if overwrite == false {
+		_, err := storage.Stat(ctx, name)
+		if err == nil {
+			return nil, fmt.Errorf("%w: %s", ErrExists, name)
+		}
+		if errors.Is(err, ErrNotFound) == false {
+			return nil, err
+		}
+	}
+
+	return &s3Writer{storage: storage, name: name, key: key, overwrite: overwrite}, nil
+}
+
+func (storage *S3Storage) Open(ctx context.Context, name string) (ArchiveReader, error) {
+	info, err := storage.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	key, _ := storage.objectKey(name)
+
+	return &s3Reader{ctx: ctx, storage: storage, key: key, info: info}, nil
+}
+
+func (storage *S3Storage) Stat(ctx context.Context, name string) (ArchiveInfo, error) {
+	key, err := storage.objectKey(name)
+	if err != nil {
+		return ArchiveInfo{}, err
+	}
+
+	response, err := storage.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return ArchiveInfo{}, fmt.Errorf("архив %s: %w", name, err)
+	}
+	response.Body.Close()
+
+	info := ArchiveInfo{Name: name, Size: response.ContentLength}
+	if modTime, err := http.ParseTime(response.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+
+	return info, nil
+}
+
+func (storage *S3Storage) Delete(ctx context.Context, name string) error {
+	key, err := storage.objectKey(name)
+	if err != nil {
+		return err
+	}
+
+	response, err := storage.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("архив %s: %w", name, err)
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+func (storage *S3Storage) Close() error {
+	storage.client.CloseIdleConnections()
+	return nil
+}
+
+// objectKey возвращает ключ объекта для имени архива.
+func (storage *S3Storage) objectKey(name string) (string, error) {
+	if fs.ValidPath(name) == false || name == "." {
+		return "", fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+
+	return storage.prefix + name, nil
+}
+
+// do подписывает и выполняет запрос к объекту key.
+// Ответы с кодом не из 2xx закрываются и возвращаются ошибкой: 404 - ErrNotFound, 412 - ErrExists.
+func (storage *S3Storage) do(ctx context.Context, method string, key string, query url.Values,
+	header http.Header, body []byte) (*http.Response, error) {
+	objectPath := storage.endpoint.Path + "/" + storage.bucket + "/" + key
+	requestURL := *storage.endpoint
+	requestURL.Path = objectPath
+	requestURL.RawPath = s3URIEncode(objectPath, false)
+	requestURL.RawQuery = s3CanonicalQuery(query)
+
+	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса к S3: %w", err)
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	payloadHash := sha256.Sum256(body)
+	storage.signer.sign(request, hex.EncodeToString(payloadHash[:]), time.Now())
+
+	response, err := storage.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса к S3: %w", err)
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response, nil
+	}
+	defer response.Body.Close()
+
+	responseErr := s3ResponseError(response.StatusCode, response.Body)
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, responseErr)
+	case http.StatusPreconditionFailed:
+		return nil, fmt.Errorf("%w: %v", ErrExists, responseErr)
+	default:
+		return nil, responseErr
+	}
+}
+
+// s3ErrorResponse - тело ответа S3 с ошибкой.
+type s3ErrorResponse struct {
+	XMLName xml.Name
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3ResponseError формирует ошибку из ответа S3.
+func s3ResponseError(statusCode int, body io.Reader) error {
+	var errorResponse s3ErrorResponse
+	xml.NewDecoder(io.LimitReader(body, 64<<10)).Decode(&errorResponse)
+	if errorResponse.Code == "" {
+		return fmt.Errorf("S3 вернул ошибку: %d %s", statusCode, http.StatusText(statusCode))
+	}
+
+	return fmt.Errorf("S3 вернул ошибку: %d %s: %s", statusCode, errorResponse.Code, errorResponse.Message)
+}
+
+// s3Part - загруженная часть multipart upload.
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// s3Writer загружает архив в S3 частями по partSize байт.
+// Первая часть начинает multipart upload, Finalize загружает остаток и завершает его.
+type s3Writer struct {
+	storage   *S3Storage
+	name      string
+	key       string
+	overwrite bool
+	buffer    bytes.Buffer
+	uploadID  string
+	parts     []s3Part
+	err       error
+}
+
+func (writer *s3Writer) Write(p []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+
+	writer.buffer.Write(p)
+	for writer.buffer.Len() >= writer.storage.partSize {
+		if err := writer.uploadPart(writer.buffer.Next(writer.storage.partSize)); err != nil {
+			writer.err = err
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (writer *s3Writer) Finalize() error {
+	if writer.err != nil {
+		writer.Abort()
+		return writer.err
+	}
+
+	header := http.Header{}
+	if writer.overwrite == false {
+		header.Set("If-None-Match", "*")
+	}
+
+	if writer.uploadID == "" {
+		response, err := writer.storage.do(context.Background(), http.MethodPut, writer.key, nil, header, writer.buffer.Bytes())
+		if err != nil {
+			return fmt.Errorf("ошибка загрузки архива %s: %w", writer.name, err)
+		}
+		response.Body.Close()
+		return nil
+	}
+
+	if writer.buffer.Len() > 0 {
+		if err := writer.uploadPart(writer.buffer.Bytes()); err != nil {
+			writer.Abort()
+			return err
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: writer.parts})
+	if err != nil {
+		writer.Abort()
+		return fmt.Errorf("ошибка завершения загрузки архива %s: %w", writer.name, err)
+	}
+
+	query := url.Values{"uploadId": {writer.uploadID}}
+	response, err := writer.storage.do(context.Background(), http.MethodPost, writer.key, query, header, body)
+	if err != nil {
+		writer.Abort()
+		return fmt.Errorf("ошибка завершения загрузки архива %s: %w", writer.name, err)
+	}
+	defer response.Body.Close()
+
+	// S3 может сообщить об ошибке завершения загрузки в теле ответа с кодом 200
+	var result s3ErrorResponse
+	if err := xml.NewDecoder(response.Body).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+		writer.Abort()
+		return fmt.Errorf("ошибка завершения загрузки архива %s: %s: %s", writer.name, result.Code, result.Message)
+	}
+
+	return nil
+}
+
+func (writer *s3Writer) Abort() error {
+	if writer.uploadID == "" {
+		return nil
+	}
+
+	query := url.Values{"uploadId": {writer.uploadID}}
+	response, err := writer.storage.do(context.Background(), http.MethodDelete, writer.key, query, nil, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка отмены загрузки архива %s: %w", writer.name, err)
+	}
+	response.Body.Close()
+	writer.uploadID = ""
+
+	return nil
+}
+
+// uploadPart загружает очередную часть архива, при необходимости начиная multipart upload.
+func (writer *s3Writer) uploadPart(data []byte) error {
+	ctx := context.Background()
+
+	if writer.uploadID == "" {
+		response, err := writer.storage.do(ctx, http.MethodPost, writer.key, url.Values{"uploads": {""}}, nil, nil)
+		if err != nil {
+			return fmt.Errorf("ошибка начала загрузки архива %s: %w", writer.name, err)
+		}
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		response.Body.Close()
+		if err != nil || result.UploadID == "" {
+			return fmt.Errorf("ошибка начала загрузки архива %s: в ответе S3 нет UploadId", writer.name)
+		}
+		writer.uploadID = result.UploadID
+	}
+
+	partNumber := len(writer.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {writer.uploadID}}
+	response, err := writer.storage.do(ctx, http.MethodPut, writer.key, query, nil, data)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки части %d архива %s: %w", partNumber, writer.name, err)
+	}
+	response.Body.Close()
+	writer.parts = append(writer.parts, s3Part{PartNumber: partNumber, ETag: response.Header.Get("ETag")})
+
+	return nil
+}
+
+// s3Reader читает архив из S3 запросами GET с заголовком Range, начиная с текущей позиции.
+// Seek не выполняет запросов: поток ответа открывается заново при следующем Read.
+type s3Reader struct {
+	ctx     context.Context
+	storage *S3Storage
+	key     string
+	info    ArchiveInfo
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (reader *s3Reader) Info() ArchiveInfo {
+	return reader.info
+}
+
+func (reader *s3Reader) Read(p []byte) (int, error) {
+	if reader.offset >= reader.info.Size {
+		return 0, io.EOF
+	}
+
+	if reader.body == nil {
+		header := http.Header{"Range": {fmt.Sprintf("bytes=%d-", reader.offset)}}
+		response, err := reader.storage.do(reader.ctx, http.MethodGet, reader.key, nil, header, nil)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка чтения архива %s: %w", reader.info.Name, err)
+		}
+		reader.body = response.Body
+	}
+
+	n, err := reader.body.Read(p)
+	reader.offset += int64(n)
+	if err == io.EOF && reader.offset < reader.info.Size {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+func (reader *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += reader.offset
+	case io.SeekEnd:
+		offset += reader.info.Size
+	}
+	if offset < 0 {
+		return 0, errors.New("отрицательная позиция в архиве")
+	}
+
+	if offset != reader.offset && reader.body != nil {
+		reader.body.Close()
+		reader.body = nil
+	}
+	reader.offset = offset
+
+	return offset, nil
+}
+
+func (reader *s3Reader) Close() error {
+	if reader.body == nil {
+		return nil
+	}
+
+	err := reader.body.Close()
+	reader.body = nil
+	return err
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	// ErrNotFound возвращается, если архива с указанным именем нет в хранилище.
+	ErrNotFound = errors.New("архив не найден в хранилище")
+	// ErrExists возвращается из Create, если архив с указанным именем уже существует, а перезапись не разрешена.
+	ErrExists = errors.New("архив уже существует в хранилище")
+	// ErrInvalidName возвращается, если имя архива недопустимо для хранилища
+	// (например, выходит за пределы корневого каталога локального хранилища).
+	ErrInvalidName = errors.New("недопустимое имя архива")
+)
+
+// ArchiveStorage - хранилище архивов задач.
+// Архивы адресуются именами - относительными путями через "/", например "reports/2025/july.zip".
+// Реализации: LocalStorage (каталог на диске), S3Storage (S3-совместимое объектное хранилище)
+// и MemoryStorage (в памяти, для тестов).
+type ArchiveStorage interface {
+	// Create открывает архив name на запись. Если архив уже существует, а overwrite = false, возвращается ErrExists.
+	// Записанные данные становятся архивом после ArchiveWriter.Finalize.
+	Create(ctx context.Context, name string, overwrite bool) (ArchiveWriter, error)
+	// Open открывает архив на чтение. Контекст действует и на последующее чтение из ArchiveReader.
+	Open(ctx context.Context, name string) (ArchiveReader, error)
+	// Stat возвращает размер и время изменения архива.
+	Stat(ctx context.Context, name string) (ArchiveInfo, error)
+	// Delete удаляет архив. Если архива нет, может вернуть ErrNotFound.
+	Delete(ctx context.Context, name string) error
+	// Close освобождает ресурсы хранилища.
+	Close() error
+}
+
+// ArchiveWriter - архив, открытый на запись.
+// Вызывать нужно ровно один из методов Finalize или Abort.
+type ArchiveWriter interface {
+	io.Writer
+	// Finalize завершает запись и сохраняет архив.
+	Finalize() error
+	// Abort прерывает запись и удаляет незавершённый архив.
+	Abort() error
+}
+
+// ArchiveReader - архив, открытый на чтение.
+type ArchiveReader interface {
+	io.ReadSeekCloser
+	// Info возвращает размер и время изменения архива на момент открытия.
+	Info() ArchiveInfo
+}
+
+// ArchiveInfo - сведения об архиве в хранилище.
+type ArchiveInfo struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
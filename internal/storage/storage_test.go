@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestArchiveStorage_Contract проверяет, что все реализации ArchiveStorage ведут себя одинаково.
+func TestArchiveStorage_Contract(t *testing.T) {
+	storages := map[string]func(t *testing.T) ArchiveStorage{
+		"local": func(t *testing.T) ArchiveStorage {
+			storage, err := NewLocalStorage(t.TempDir())
+			assert.NoError(t, err)
+			return storage
+		},
+		"memory": func(t *testing.T) ArchiveStorage {
+			return NewMemoryStorage()
+		},
+		"s3": func(t *testing.T) ArchiveStorage {
+			storage, _ := newTestS3Storage(t, 16)
+			return storage
+		},
+	}
+
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			storage := newStorage(t)
+			defer storage.Close()
+			ctx := context.Background()
+			content := "содержимое архива, которое не помещается в одну часть"
+
+			writer, err := storage.Create(ctx, "reports/2025/july.zip", false)
+			assert.NoError(t, err)
+			_, err = io.WriteString(writer, content)
+			assert.NoError(t, err)
+			assert.NoError(t, writer.Finalize())
+
+			info, err := storage.Stat(ctx, "reports/2025/july.zip")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(content)), info.Size)
+			assert.False(t, info.ModTime.IsZero(), "время изменения архива должно быть известно")
+
+			reader, err := storage.Open(ctx, "reports/2025/july.zip")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(content)), reader.Info().Size)
+			data, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, content, string(data))
+			_, err = reader.Seek(-10, io.SeekEnd)
+			assert.NoError(t, err)
+			data, err = io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, content[len(content)-10:], string(data), "после Seek чтение продолжается с новой позиции")
+			assert.NoError(t, reader.Close())
+
+			_, err = storage.Create(ctx, "reports/2025/july.zip", false)
+			assert.ErrorIs(t, err, ErrExists, "существующий архив без разрешения не перезаписывается")
+
+			writer, err = storage.Create(ctx, "reports/2025/july.zip", true)
+			assert.NoError(t, err)
+			_, err = io.WriteString(writer, "новый архив")
+			assert.NoError(t, err)
+			assert.NoError(t, writer.Finalize())
+			info, err = storage.Stat(ctx, "reports/2025/july.zip")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len("новый архив")), info.Size)
+
+			writer, err = storage.Create(ctx, "aborted.zip", false)
+			assert.NoError(t, err)
+			_, err = io.WriteString(writer, content)
+			assert.NoError(t, err)
+			assert.NoError(t, writer.Abort())
+			_, err = storage.Stat(ctx, "aborted.zip")
+			assert.ErrorIs(t, err, ErrNotFound, "прерванный архив не должен оставаться в хранилище")
+
+			assert.NoError(t, storage.Delete(ctx, "reports/2025/july.zip"))
+			_, err = storage.Open(ctx, "reports/2025/july.zip")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			for _, invalidName := range []string{"../escape.zip", "/etc/escape.zip", "reports/../../escape.zip", ""} {
+				_, err = storage.Create(ctx, invalidName, false)
+				assert.ErrorIs(t, err, ErrInvalidName, invalidName)
+			}
+		})
+	}
+}
+
+func TestLocalStorage_Sandbox(t *testing.T) {
+	rootPath := t.TempDir()
+	outside := t.TempDir()
+	assert.NoError(t, os.Symlink(outside, filepath.Join(rootPath, "link")))
+	storage, err := NewLocalStorage(rootPath)
+	assert.NoError(t, err)
+	defer storage.Close()
+	ctx := context.Background()
+
+	_, err = storage.Create(ctx, "link/escape.zip", false)
+	assert.ErrorIs(t, err, ErrInvalidName, "символическая ссылка не должна выводить за пределы корня")
+	entries, err := os.ReadDir(outside)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	writer, err := storage.Create(ctx, "legacy.zip", false)
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Finalize())
+	_, err = storage.Stat(ctx, filepath.Join(storage.Path(), "legacy.zip"))
+	assert.NoError(t, err, "полный путь внутри корня принимается для совместимости со старым журналом")
+	_, err = storage.Stat(ctx, filepath.Join(outside, "legacy.zip"))
+	assert.ErrorIs(t, err, ErrInvalidName)
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"workmate_test_project/internal/model"
+)
+
+const (
+	journalOpPut    = "put"
+	journalOpDelete = "delete"
+)
+
+const (
+	// journalCompactMinRecords - меньше этого количества записей журнал во время работы не сжимается.
+	journalCompactMinRecords = 1000
+	// journalCompactRatio - журнал сжимается, когда записей в нём в journalCompactRatio раз больше, чем задач.
+	journalCompactRatio = 4
+)
+
+// journalRecord - одна строка журнала.
+// Op = "put" сохраняет снимок задачи целиком, Op = "delete" удаляет задачу с указанным ID.
+type journalRecord struct {
+	Op   string      `json:"op"`
+	ID   int         `json:"id"`
+	Task *model.Task `json:"task,omitempty"`
+}
+
+// JournalStore - долговременное хранилище задач на основе журнала (append-only) на локальном диске.
+//
+// Каждое изменение задачи дописывается в конец файла отдельной JSON-строкой и сбрасывается на диск (fsync),
+// актуальное состояние задач при этом хранится в памяти.
+// При открытии журнал проигрывается с начала, после чего переписывается в компактном виде:
+// по одной записи на каждую существующую задачу. Во время работы журнал сжимается так же,
+// как только записей в нём становится не меньше journalCompactMinRecords и в journalCompactRatio раз
+// больше, чем задач: так размер журнала остаётся пропорциональным количеству задач.
+type JournalStore struct {
+	path    string
+	file    *os.File
+	tasks   map[int]*model.Task
+	records int
+	mutex   sync.RWMutex
+}
+
+// OpenJournalStore открывает (или создаёт) журнал по указанному пути и восстанавливает из него задачи.
+//
+// Недописанная последняя строка (например, если процесс упал во время записи) пропускается,
+// повреждение в середине журнала считается ошибкой.
+func OpenJournalStore(path string) (*JournalStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("ошибка создания директории журнала: %w", err)
+	}
+
+	tasks, err := replayJournal(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := compactJournal(path, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JournalStore{
+		path:    path,
+		file:    file,
+		tasks:   tasks,
+		records: len(tasks),
+	}, nil
+}
+
+func (store *JournalStore) Create(task *model.Task) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, exist := store.tasks[task.ID]; exist {
+		return fmt.Errorf("задача с id = %d уже существует", task.ID)
+	}
+	if err := store.append(journalRecord{Op: journalOpPut, ID: task.ID, Task: task}); err != nil {
+		return err
+	}
+	store.tasks[task.ID] = task
+	store.compactIfNeeded()
+
+	return nil
+}
+
+func (store *JournalStore) Get(id int) (*model.Task, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	task, exist := store.tasks[id]
+	if exist == false {
+		return nil, fmt.Errorf("%w: id = %d", ErrTaskNotFound, id)
+	}
+
+	return task, nil
+}
+
+func (store *JournalStore) Update(task *model.Task) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, exist := store.tasks[task.ID]; exist == false {
+		return fmt.Errorf("%w: id = %d", ErrTaskNotFound, task.ID)
+	}
+	if err := store.append(journalRecord{Op: journalOpPut, ID: task.ID, Task: task}); err != nil {
+		return err
+	}
+	store.tasks[task.ID] = task
+	store.compactIfNeeded()
+
+	return nil
+}
+
+// List возвращает все задачи, отсортированные по ID.
+func (store *JournalStore) List() ([]*model.Task, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return sortedTasks(store.tasks), nil
+}
+
+func (store *JournalStore) Delete(id int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, exist := store.tasks[id]; exist == false {
+		return fmt.Errorf("%w: id = %d", ErrTaskNotFound, id)
+	}
+	if err := store.append(journalRecord{Op: journalOpDelete, ID: id}); err != nil {
+		return err
+	}
+	delete(store.tasks, id)
+	store.compactIfNeeded()
+
+	return nil
+}
+
+func (store *JournalStore) Close() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.file.Close()
+}
+
+// append дописывает запись в конец журнала и дожидается её сброса на диск.
+// Вызывается под store.mutex.
+func (store *JournalStore) append(record journalRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации записи журнала: %w", err)
+	}
+	line = append(line, '\n')
+
+	if _, err := store.file.Write(line); err != nil {
+		return fmt.Errorf("ошибка записи в журнал: %w", err)
+	}
+	if err := store.file.Sync(); err != nil {
+		return fmt.Errorf("ошибка сброса журнала на диск: %w", err)
+	}
+	store.records++
+
+	return nil
+}
+
+// compactIfNeeded сжимает журнал, если записей в нём накопилось слишком много (см. JournalStore).
+// Ошибка сжатия не мешает работе: записи продолжают дописываться в прежний журнал,
+// а следующая попытка будет, когда записей снова станет слишком много.
+// Вызывается под store.mutex после применения записи к store.tasks.
+func (store *JournalStore) compactIfNeeded() {
+	if store.records < journalCompactMinRecords || store.records < journalCompactRatio*len(store.tasks) {
+		return
+	}
+
+	file, err := compactJournal(store.path, store.tasks)
+	if err != nil {
+		log.Printf("ошибка сжатия журнала %s: %v", store.path, err)
+		store.records = len(store.tasks)
+		return
+	}
+	store.file.Close()
+	store.file = file
+	store.records = len(store.tasks)
+}
+
+// replayJournal последовательно применяет все записи журнала и возвращает итоговое состояние задач.
+// Если файла журнала ещё нет, возвращается пустая мапа.
+func replayJournal(path string) (map[int]*model.Task, error) {
+	tasks := make(map[int]*model.Task)
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return tasks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия журнала: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, fmt.Errorf("ошибка чтения журнала: %w", readErr)
+		}
+
+		if len(line) > 0 {
+			var record journalRecord
+			if err := json.Unmarshal(line, &record); err != nil {
+				if readErr == io.EOF {
+					log.Printf("пропущена недописанная запись журнала %s (строка %d): %v", path, lineNumber, err)
+					break
+				}
+				return nil, fmt.Errorf("повреждена запись журнала %s (строка %d): %w", path, lineNumber, err)
+			}
+			applyJournalRecord(tasks, record)
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	return tasks, nil
+}
+
+func applyJournalRecord(tasks map[int]*model.Task, record journalRecord) {
+	switch record.Op {
+	case journalOpPut:
+		if record.Task != nil {
+			tasks[record.Task.ID] = record.Task
+		}
+	case journalOpDelete:
+		delete(tasks, record.ID)
+	}
+}
+
+// compactJournal переписывает журнал так, чтобы в нём осталась одна запись на каждую задачу.
+// Новый журнал сначала пишется во временный файл, который затем атомарно заменяет старый.
+// Возвращает новый журнал, открытый для дописывания записей.
+func compactJournal(path string, tasks map[int]*model.Task) (*os.File, error) {
+	tmpPath := path + ".tmp"
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания временного журнала: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmpFile)
+	encoder := json.NewEncoder(writer)
+	for _, task := range sortedTasks(tasks) {
+		if err := encoder.Encode(journalRecord{Op: journalOpPut, ID: task.ID, Task: task}); err != nil {
+			tmpFile.Close()
+			return nil, fmt.Errorf("ошибка записи временного журнала: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("ошибка записи временного журнала: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("ошибка сброса временного журнала на диск: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("ошибка замены журнала: %w", err)
+	}
+	// без fsync каталога после сбоя питания на диске может остаться старый журнал,
+	// и записи, дописанные после сжатия, потеряются
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		tmpFile.Close()
+		return nil, fmt.Errorf("ошибка сброса каталога журнала на диск: %w", err)
+	}
+
+	// файл остаётся открытым и после переименования: следующие записи дописываются в его конец
+	return tmpFile, nil
+}
+
+// syncDir сбрасывает на диск каталог dir, чтобы переименование файла в нём пережило сбой питания.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return file.Sync()
+}
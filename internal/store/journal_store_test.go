@@ -0,0 +1,85 @@
+package store
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"workmate_test_project/internal/model"
+)
+
+func TestJournalStore_ReplaysAfterReopen(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "tasks.journal")
+
+	journalStore, err := OpenJournalStore(journalPath)
+	assert.NoError(t, err)
+
+	assert.NoError(t, journalStore.Create(&model.Task{ID: 1, Files: []model.TaskFile{}, Status: model.StatusCreated}))
+	assert.NoError(t, journalStore.Create(&model.Task{ID: 2, Files: []model.TaskFile{}, Status: model.StatusCreated}))
+
+	task, err := journalStore.Get(1)
+	assert.NoError(t, err)
+	task.Status = model.StatusCompleted
+	task.Files = append(task.Files, model.TaskFile{Name: "file1", URL: "https://example.com/file1.pdf", ArchiveName: "file1.pdf", Stored: true})
+	task.FilesAdded = 1
+	assert.NoError(t, journalStore.Update(task))
+	assert.NoError(t, journalStore.Delete(2))
+	assert.NoError(t, journalStore.Close())
+
+	journalStore, err = OpenJournalStore(journalPath)
+	assert.NoError(t, err)
+	defer journalStore.Close()
+
+	tasks, err := journalStore.List()
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1, "удалённая задача не должна восстанавливаться")
+	assert.Equal(t, model.StatusCompleted, tasks[0].Status)
+	assert.Equal(t, "file1.pdf", tasks[0].Files[0].ArchiveName)
+	assert.Equal(t, 1, tasks[0].FilesAdded)
+
+	_, err = journalStore.Get(2)
+	assert.ErrorIs(t, err, ErrTaskNotFound)
+}
+
+func TestJournalStore_SkipsTruncatedTail(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "tasks.journal")
+	content := `{"op":"put","id":1,"task":{"id":1,"files":[],"status":"создана"}}` + "\n" +
+		`{"op":"put","id":2,"task":{"id":2,"fil`
+	assert.NoError(t, os.WriteFile(journalPath, []byte(content), 0o644))
+
+	journalStore, err := OpenJournalStore(journalPath)
+	assert.NoError(t, err, "недописанная последняя запись не должна мешать открытию журнала")
+	defer journalStore.Close()
+
+	tasks, err := journalStore.List()
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+}
+
+func TestJournalStore_CompactsWhileRunning(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "tasks.journal")
+
+	journalStore, err := OpenJournalStore(journalPath)
+	assert.NoError(t, err)
+
+	task := &model.Task{ID: 1, Files: []model.TaskFile{}, Status: model.StatusCreated}
+	assert.NoError(t, journalStore.Create(task))
+	for i := 0; i < 2*journalCompactMinRecords; i++ {
+		task.FilesAdded = i
+		assert.NoError(t, journalStore.Update(task))
+	}
+
+	content, err := os.ReadFile(journalPath)
+	assert.NoError(t, err)
+	assert.Less(t, bytes.Count(content, []byte("\n")), journalCompactMinRecords, "журнал должен сжиматься во время работы")
+	assert.NoError(t, journalStore.Close())
+
+	journalStore, err = OpenJournalStore(journalPath)
+	assert.NoError(t, err)
+	defer journalStore.Close()
+
+	task, err = journalStore.Get(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*journalCompactMinRecords-1, task.FilesAdded, "после сжатия в журнале последнее состояние задачи")
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"workmate_test_project/internal/model"
+)
+
+// MemoryStore - хранилище задач в памяти процесса.
+// Все задачи теряются при перезапуске сервера.
+type MemoryStore struct {
+	tasks map[int]*model.Task
+	mutex sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tasks: make(map[int]*model.Task),
+	}
+}
+
+func (store *MemoryStore) Create(task *model.Task) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, exist := store.tasks[task.ID]; exist {
+		return fmt.Errorf("задача с id = %d уже существует", task.ID)
+	}
+	store.tasks[task.ID] = task
+
+	return nil
+}
+
+func (store *MemoryStore) Get(id int) (*model.Task, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	task, exist := store.tasks[id]
+	if exist == false {
+		return nil, fmt.Errorf("%w: id = %d", ErrTaskNotFound, id)
+	}
+
+	return task, nil
+}
+
+func (store *MemoryStore) Update(task *model.Task) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, exist := store.tasks[task.ID]; exist == false {
+		return fmt.Errorf("%w: id = %d", ErrTaskNotFound, task.ID)
+	}
+	store.tasks[task.ID] = task
+
+	return nil
+}
+
+// List возвращает все задачи, отсортированные по ID.
+func (store *MemoryStore) List() ([]*model.Task, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return sortedTasks(store.tasks), nil
+}
+
+func (store *MemoryStore) Delete(id int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, exist := store.tasks[id]; exist == false {
+		return fmt.Errorf("%w: id = %d", ErrTaskNotFound, id)
+	}
+	delete(store.tasks, id)
+
+	return nil
+}
+
+func (store *MemoryStore) Close() error {
+	return nil
+}
+
+func sortedTasks(tasks map[int]*model.Task) []*model.Task {
+	result := make([]*model.Task, 0, len(tasks))
+	for _, task := range tasks {
+		result = append(result, task)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result
+}
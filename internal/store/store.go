@@ -0,0 +1,23 @@
+package store
+
+import (
+	"errors"
+	"workmate_test_project/internal/model"
+)
+
+// ErrTaskNotFound возвращается, если задачи с указанным ID нет в хранилище.
+var ErrTaskNotFound = errors.New("задача не найдена")
+
+// TaskStore - хранилище задач.
+//
+// Get и List возвращают указатели на те же объекты, что хранятся внутри,
+// поэтому после изменения задачи нужно вызвать Update, чтобы изменения
+// были сохранены (для долговременных реализаций — записаны на диск).
+type TaskStore interface {
+	Create(task *model.Task) error
+	Get(id int) (*model.Task, error)
+	Update(task *model.Task) error
+	List() ([]*model.Task, error)
+	Delete(id int) error
+	Close() error
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"workmate_test_project/internal/storage"
+)
+
+// recoveredEntries - целые записи недописанного архива, найденные во временной копии brokenPath.
+type recoveredEntries interface {
+	// copyTo переносит записи в новый архив и возвращает их имена.
+	copyTo(brokenPath string, archiveWriter ArchiveWriter) ([]string, error)
+}
+
+// RecoverArchive восстанавливает архив name формата format в хранилище archives, запись в который оборвалась
+// до вызова ArchiveWriter.Close (у ZIP-архива нет центрального каталога, у tar - конца архива и сжатого потока).
+//
+// Шаги функции:
+// 1. Копирует недописанный архив из хранилища во временный файл в каталоге spoolDir
+// (пустой spoolDir - системный каталог временных файлов).
+// 2. Находит записи, которые были записаны целиком. Записи ZIP проверяются по CRC32 и размерам
+// (см. scanZIPEntries), записи tar - по заголовку и размеру (см. scanTarEntries).
+// Чтение останавливается на первой оборванной или повреждённой записи.
+// 3. Заново создаёт архив name в хранилище с уровнем сжатия level и копирует в него целые записи
+// (ZIP - без перепаковки, tar - распаковывая и заново сжимая).
+// 4. Удаляет временный файл.
+//
+// Если архива в хранилище нет (например, незавершённая загрузка в S3 не видна до storage.ArchiveWriter.Finalize),
+// возвращается ошибка storage.ErrNotFound.
+// Архивы с шифрованием WinZip AES не восстанавливаются: пароль хранится только в памяти процесса.
+// Если перенести записи не удалось, временный файл с копией архива не удаляется, его путь указывается в ошибке.
+//
+// Возвращает: архив в хранилище; ArchiveWriter, открытый для добавления новых файлов; имена восстановленных записей; ошибку.
+//
+// Ни ArchiveWriter, ни архив не закрываются — после записи нужно вызвать ArchiveWriter.Close
+// и storage.ArchiveWriter.Finalize.
+func RecoverArchive(ctx context.Context, archives storage.ArchiveStorage, name string, format ArchiveFormat,
+	level int, spoolDir string) (storage.ArchiveWriter, ArchiveWriter, []string, error) {
+	brokenPath, err := copyToSpool(ctx, archives, name, spoolDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var entries recoveredEntries
+	if format == FormatZIP {
+		entries, err = scanZIPEntries(brokenPath)
+	} else {
+		entries, err = scanTarEntries(brokenPath, format)
+	}
+	if err != nil {
+		os.Remove(brokenPath)
+		return nil, nil, nil, err
+	}
+
+	archive, err := archives.Create(ctx, name, true)
+	if err != nil {
+		os.Remove(brokenPath)
+		return nil, nil, nil, fmt.Errorf("ошибка создания архива: %w", err)
+	}
+	archiveWriter, err := NewArchiveWriter(format, archive, level, "")
+	if err != nil {
+		archive.Abort()
+		os.Remove(brokenPath)
+		return nil, nil, nil, err
+	}
+
+	names, err := entries.copyTo(brokenPath, archiveWriter)
+	if err == nil {
+		err = archiveWriter.Flush()
+	}
+	if err != nil {
+		archive.Abort()
+		return nil, nil, nil, fmt.Errorf("ошибка восстановления архива (копия сохранена в %s): %w", brokenPath, err)
+	}
+
+	if err := os.Remove(brokenPath); err != nil {
+		log.Printf("ошибка удаления временной копии архива %s: %v", brokenPath, err)
+	}
+
+	return archive, archiveWriter, names, nil
+}
+
+// copyToSpool копирует архив name из хранилища во временный файл и возвращает путь к нему.
+func copyToSpool(ctx context.Context, archives storage.ArchiveStorage, name string, spoolDir string) (string, error) {
+	reader, err := archives.Open(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("ошибка открытия архива: %w", err)
+	}
+	defer reader.Close()
+
+	spoolFile, err := os.CreateTemp(spoolDir, "recovery-*")
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания временного файла: %w", err)
+	}
+
+	_, err = io.Copy(spoolFile, reader)
+	if closeErr := spoolFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(spoolFile.Name())
+		return "", fmt.Errorf("ошибка копирования архива: %w", err)
+	}
+
+	return spoolFile.Name(), nil
+}
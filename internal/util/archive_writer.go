@@ -0,0 +1,238 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat - формат архива задачи.
+type ArchiveFormat string
+
+const (
+	FormatZIP    ArchiveFormat = "zip"
+	FormatTar    ArchiveFormat = "tar"
+	FormatTarGz  ArchiveFormat = "tar.gz"
+	FormatTarZst ArchiveFormat = "tar.zst"
+)
+
+// ErrUnsupportedArchiveFormat возвращается для неизвестного формата архива или недопустимого уровня сжатия.
+var ErrUnsupportedArchiveFormat = errors.New("неподдерживаемый формат архива")
+
+// archiveFormatInfo - расширение файла, тип содержимого и допустимые уровни сжатия формата.
+// У формата без сжатия (tar) minLevel = maxLevel = defaultLevel = 0.
+type archiveFormatInfo struct {
+	extension    string
+	contentType  string
+	minLevel     int
+	maxLevel     int
+	defaultLevel int
+}
+
+var archiveFormats = map[ArchiveFormat]archiveFormatInfo{
+	FormatZIP:    {".zip", "application/zip", flate.HuffmanOnly, flate.BestCompression, flate.DefaultCompression},
+	FormatTar:    {".tar", "application/x-tar", 0, 0, 0},
+	FormatTarGz:  {".tar.gz", "application/gzip", gzip.HuffmanOnly, gzip.BestCompression, gzip.DefaultCompression},
+	FormatTarZst: {".tar.zst", "application/zstd", 1, 22, 3},
+}
+
+// ParseArchiveFormat разбирает формат архива без учёта регистра. Пустая строка - FormatZIP.
+func ParseArchiveFormat(value string) (ArchiveFormat, error) {
+	if value == "" {
+		return FormatZIP, nil
+	}
+
+	format := ArchiveFormat(strings.ToLower(value))
+	if _, exist := archiveFormats[format]; exist == false {
+		return "", fmt.Errorf("%w: %q, допустимые: zip, tar, tar.gz, tar.zst", ErrUnsupportedArchiveFormat, value)
+	}
+
+	return format, nil
+}
+
+// Extension возвращает расширение файла архива вместе с точкой, например ".tar.gz".
+func (format ArchiveFormat) Extension() string {
+	return archiveFormats[format].extension
+}
+
+// ContentType возвращает тип содержимого (Content-Type) архива.
+func (format ArchiveFormat) ContentType() string {
+	return archiveFormats[format].contentType
+}
+
+// DefaultCompressionLevel возвращает уровень сжатия формата по умолчанию.
+func (format ArchiveFormat) DefaultCompressionLevel() int {
+	return archiveFormats[format].defaultLevel
+}
+
+// CheckCompressionLevel проверяет, что уровень сжатия допустим для формата:
+// от -2 (только Huffman) до 9 для zip и tar.gz, от 1 до 22 для tar.zst; tar не сжимается.
+func (format ArchiveFormat) CheckCompressionLevel(level int) error {
+	info, exist := archiveFormats[format]
+	if exist == false {
+		return fmt.Errorf("%w: %q", ErrUnsupportedArchiveFormat, format)
+	}
+	if level < info.minLevel || level > info.maxLevel {
+		return fmt.Errorf("%w: уровень сжатия %d для %s, допустимые: от %d до %d",
+			ErrUnsupportedArchiveFormat, level, format, info.minLevel, info.maxLevel)
+	}
+
+	return nil
+}
+
+// CheckEncryption проверяет, что архив формата format можно зашифровать паролем password.
+// Пустой пароль означает архив без шифрования и допустим для любого формата.
+func (format ArchiveFormat) CheckEncryption(password string) error {
+	if password != "" && format != FormatZIP {
+		return fmt.Errorf("%w: шифрование паролем поддерживается только для zip, а не для %s",
+			ErrUnsupportedArchiveFormat, format)
+	}
+
+	return nil
+}
+
+// ArchiveWriter - запись файлов в архив задачи независимо от его формата.
+// Как и zip.Writer, не безопасен для конкурентного использования.
+type ArchiveWriter interface {
+	// AddFile добавляет в архив файл name размером size с содержимым content.
+	AddFile(name string, size int64, modTime time.Time, content io.Reader) error
+	// Flush сбрасывает в output всё, что уже записано, не завершая архив.
+	Flush() error
+	// Close дописывает служебные данные архива (центральный каталог, конец tar, конец сжатого потока).
+	// Сам output не закрывается.
+	Close() error
+}
+
+// NewArchiveWriter создаёт запись архива формата format в output с уровнем сжатия level
+// (см. ArchiveFormat.CheckCompressionLevel).
+// Непустой password включает шифрование файлов WinZip AES-256, оно поддерживается только для FormatZIP.
+func NewArchiveWriter(format ArchiveFormat, output io.Writer, level int, password string) (ArchiveWriter, error) {
+	if err := format.CheckCompressionLevel(level); err != nil {
+		return nil, err
+	}
+	if err := format.CheckEncryption(password); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatZIP:
+		return newZIPArchiveWriter(output, level, password), nil
+	case FormatTar:
+		return &tarArchiveWriter{tar: tar.NewWriter(output)}, nil
+	case FormatTarGz:
+		compressor, err := gzip.NewWriterLevel(output, level)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка создания gzip: %w", err)
+		}
+		return &tarArchiveWriter{tar: tar.NewWriter(compressor), compressor: compressor}, nil
+	case FormatTarZst:
+		compressor, err := zstd.NewWriter(output, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+			// в архив задачи пишет одна горутина, поэтому параллельное сжатие не нужно
+			zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("ошибка создания zstd: %w", err)
+		}
+		return &tarArchiveWriter{tar: tar.NewWriter(compressor), compressor: compressor}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedArchiveFormat, format)
+	}
+}
+
+// zipArchiveWriter пишет ZIP-архив, файлы сжимаются Deflate с заданным уровнем.
+// Если задан password, файлы шифруются WinZip AES-256 (см. addEncryptedFile).
+type zipArchiveWriter struct {
+	*zip.Writer
+	level    int
+	password string
+}
+
+func newZIPArchiveWriter(output io.Writer, level int, password string) *zipArchiveWriter {
+	writer := zip.NewWriter(output)
+	writer.RegisterCompressor(zip.Deflate, func(output io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(output, level)
+	})
+
+	return &zipArchiveWriter{Writer: writer, level: level, password: password}
+}
+
+func (writer *zipArchiveWriter) AddFile(name string, size int64, modTime time.Time, content io.Reader) error {
+	if writer.password != "" {
+		return writer.addEncryptedFile(name, size, modTime, content)
+	}
+
+	entry, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла в zip архиве: %w", err)
+	}
+
+	if _, err := io.Copy(entry, content); err != nil {
+		return fmt.Errorf("ошибка копирования данных в zip архив: %w", err)
+	}
+
+	return nil
+}
+
+// compressor - сжимающий поток tar.gz или tar.zst.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// tarArchiveWriter пишет tar-архив, при необходимости через сжимающий поток.
+type tarArchiveWriter struct {
+	tar        *tar.Writer
+	compressor compressor
+}
+
+func (writer *tarArchiveWriter) AddFile(name string, size int64, modTime time.Time, content io.Reader) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+	}
+	if err := writer.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("ошибка создания файла в tar архиве: %w", err)
+	}
+
+	written, err := io.Copy(writer.tar, content)
+	if err != nil {
+		return fmt.Errorf("ошибка копирования данных в tar архив: %w", err)
+	}
+	if written != size {
+		return fmt.Errorf("ошибка копирования данных в tar архив: записано %d байт из %d", written, size)
+	}
+
+	return nil
+}
+
+func (writer *tarArchiveWriter) Flush() error {
+	// tar.Writer.Flush дописывает выравнивание записи и возвращает ошибку, если записано меньше size байт
+	if err := writer.tar.Flush(); err != nil {
+		return err
+	}
+	if writer.compressor != nil {
+		return writer.compressor.Flush()
+	}
+
+	return nil
+}
+
+func (writer *tarArchiveWriter) Close() error {
+	if err := writer.tar.Close(); err != nil {
+		return err
+	}
+	if writer.compressor != nil {
+		return writer.compressor.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"workmate_test_project/internal/storage"
+)
+
+// readArchive читает все файлы архива формата format и возвращает их содержимое по именам в порядке записи.
+func readArchive(t *testing.T, format ArchiveFormat, data []byte) ([]string, map[string]string) {
+	var names []string
+	contents := map[string]string{}
+
+	if format == FormatZIP {
+		reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		assert.NoError(t, err)
+		for _, file := range reader.File {
+			entry, err := file.Open()
+			assert.NoError(t, err)
+			content, err := io.ReadAll(entry)
+			assert.NoError(t, err)
+			entry.Close()
+			names = append(names, file.Name)
+			contents[file.Name] = string(content)
+		}
+		return names, contents
+	}
+
+	decompressed, err := newDecompressor(format, bytes.NewReader(data))
+	assert.NoError(t, err)
+	defer decompressed.Close()
+	reader := tar.NewReader(decompressed)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		names = append(names, header.Name)
+		contents[header.Name] = string(content)
+	}
+
+	return names, contents
+}
+
+func TestArchiveWriter_Formats(t *testing.T) {
+	files := []struct{ name, content string }{
+		{"file1.pdf", strings.Repeat("содержимое первого файла ", 100)},
+		{"отчёт.png", "содержимое второго файла"},
+	}
+
+	for _, format := range []ArchiveFormat{FormatZIP, FormatTar, FormatTarGz, FormatTarZst} {
+		t.Run(string(format), func(t *testing.T) {
+			var output bytes.Buffer
+			archiveWriter, err := NewArchiveWriter(format, &output, format.DefaultCompressionLevel(), "")
+			assert.NoError(t, err)
+			for _, file := range files {
+				assert.NoError(t, archiveWriter.AddFile(file.name, int64(len(file.content)), time.Now(), strings.NewReader(file.content)))
+				assert.NoError(t, archiveWriter.Flush())
+			}
+			assert.NoError(t, archiveWriter.Close())
+
+			names, contents := readArchive(t, format, output.Bytes())
+			assert.Equal(t, []string{"file1.pdf", "отчёт.png"}, names, "файлы должны идти в порядке записи")
+			for _, file := range files {
+				assert.Equal(t, file.content, contents[file.name])
+			}
+		})
+	}
+}
+
+func TestArchiveFormat_ParseAndLevels(t *testing.T) {
+	format, err := ParseArchiveFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatZIP, format, "формат по умолчанию - zip")
+	format, err = ParseArchiveFormat("TAR.ZST")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatTarZst, format)
+	assert.Equal(t, ".tar.zst", format.Extension())
+	assert.Equal(t, "application/zstd", format.ContentType())
+	_, err = ParseArchiveFormat("rar")
+	assert.ErrorIs(t, err, ErrUnsupportedArchiveFormat)
+
+	assert.NoError(t, FormatZIP.CheckCompressionLevel(9))
+	assert.ErrorIs(t, FormatZIP.CheckCompressionLevel(10), ErrUnsupportedArchiveFormat)
+	assert.NoError(t, FormatTarZst.CheckCompressionLevel(19))
+	assert.ErrorIs(t, FormatTarZst.CheckCompressionLevel(0), ErrUnsupportedArchiveFormat)
+	assert.ErrorIs(t, FormatTar.CheckCompressionLevel(1), ErrUnsupportedArchiveFormat, "tar не сжимается")
+
+	_, err = NewArchiveWriter(FormatTarGz, io.Discard, 42, "")
+	assert.ErrorIs(t, err, ErrUnsupportedArchiveFormat)
+}
+
+func TestRecoverArchive_Tar(t *testing.T) {
+	for _, format := range []ArchiveFormat{FormatTar, FormatTarGz, FormatTarZst} {
+		t.Run(string(format), func(t *testing.T) {
+			archives := storage.NewMemoryStorage()
+			ctx := context.Background()
+			name := "broken" + format.Extension()
+
+			// имитируем падение процесса: два файла записаны и сброшены в поток, третий оборван, архив не закрыт
+			var output bytes.Buffer
+			archiveWriter, err := NewArchiveWriter(format, &output, format.DefaultCompressionLevel(), "")
+			assert.NoError(t, err)
+			for _, file := range []string{"file1.pdf", "file2.pdf"} {
+				content := "содержимое " + file
+				assert.NoError(t, archiveWriter.AddFile(file, int64(len(content)), time.Now(), strings.NewReader(content)))
+				assert.NoError(t, archiveWriter.Flush())
+			}
+			assert.Error(t, archiveWriter.AddFile("file3.pdf", 1000, time.Now(), strings.NewReader("недописанный файл")))
+			archiveWriter.Flush()
+
+			broken, err := archives.Create(ctx, name, false)
+			assert.NoError(t, err)
+			_, err = broken.Write(output.Bytes())
+			assert.NoError(t, err)
+			assert.NoError(t, broken.Finalize())
+
+			archive, archiveWriter, names, err := RecoverArchive(ctx, archives, name, format,
+				format.DefaultCompressionLevel(), t.TempDir())
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"file1.pdf", "file2.pdf"}, names, "оборванный файл не должен восстанавливаться")
+
+			content := "файл после восстановления"
+			assert.NoError(t, archiveWriter.AddFile("file4.pdf", int64(len(content)), time.Now(), strings.NewReader(content)))
+			assert.NoError(t, archiveWriter.Close())
+			assert.NoError(t, archive.Finalize())
+
+			reader, err := archives.Open(ctx, name)
+			assert.NoError(t, err)
+			data, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			reader.Close()
+
+			names, contents := readArchive(t, format, data)
+			assert.Equal(t, []string{"file1.pdf", "file2.pdf", "file4.pdf"}, names)
+			assert.Equal(t, "содержимое file2.pdf", contents["file2.pdf"])
+			assert.Equal(t, content, contents["file4.pdf"])
+		})
+	}
+}
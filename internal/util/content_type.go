@@ -0,0 +1,146 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrUnsupportedMIMEType возвращается, если тип скачиваемого файла не входит в список допустимых.
+var ErrUnsupportedMIMEType = errors.New("не поддерживаемый тип файла")
+
+// sniffLength - сколько первых байт содержимого анализирует http.DetectContentType.
+const sniffLength = 512
+
+// genericTypes - типы, которые http.DetectContentType возвращает, если не узнал содержимое по сигнатуре.
+var genericTypes = map[string]struct{}{
+	"application/octet-stream": {},
+	"text/plain":               {},
+}
+
+// signatureTypes - типы, которые http.DetectContentType распознаёт по сигнатуре (magic number).
+// Если сервер объявил такой тип, а сигнатуры в начале файла нет, заголовку не верят.
+var signatureTypes = map[string]struct{}{
+	"image/jpeg":                   {},
+	"image/png":                    {},
+	"image/gif":                    {},
+	"image/webp":                   {},
+	"image/bmp":                    {},
+	"image/x-icon":                 {},
+	"application/pdf":              {},
+	"application/postscript":       {},
+	"application/zip":              {},
+	"application/x-gzip":           {},
+	"application/x-rar-compressed": {},
+	"application/wasm":             {},
+	"application/ogg":              {},
+	"audio/mpeg":                   {},
+	"audio/wave":                   {},
+	"audio/aiff":                   {},
+	"audio/midi":                   {},
+	"video/mp4":                    {},
+	"video/webm":                   {},
+	"video/avi":                    {},
+	"font/ttf":                     {},
+	"font/otf":                     {},
+	"font/woff":                    {},
+	"font/woff2":                   {},
+}
+
+// typeExtensions - расширения записей в архиве для распространённых типов.
+// Для остальных типов расширение берётся из mime.ExtensionsByType.
+var typeExtensions = map[string]string{
+	"image/jpeg":         ".jpg",
+	"image/png":          ".png",
+	"image/gif":          ".gif",
+	"image/webp":         ".webp",
+	"image/bmp":          ".bmp",
+	"application/pdf":    ".pdf",
+	"application/zip":    ".zip",
+	"application/x-gzip": ".gz",
+	"application/json":   ".json",
+	"text/plain":         ".txt",
+	"text/csv":           ".csv",
+	"text/html":          ".html",
+	"text/xml":           ".xml",
+}
+
+// DetectContentType определяет тип файла по первым байтам содержимого head и заголовку Content-Type ответа declared.
+//
+// Сигнатура важнее заголовка: HTML-страница с ошибкой, отданная как image/jpeg, определяется как text/html.
+// Заголовку верят, только если по сигнатуре тип определить не удалось (http.DetectContentType вернул
+// application/octet-stream или text/plain), а объявленный тип сам не из тех, что распознаются по сигнатуре
+// (например, text/csv или application/json).
+//
+// Возвращает тип без параметров в нижнем регистре, например "image/png".
+func DetectContentType(head []byte, declared string) string {
+	sniffed := mediaType(http.DetectContentType(head))
+	if _, generic := genericTypes[sniffed]; generic == false {
+		return sniffed
+	}
+
+	declaredType := mediaType(declared)
+	if declaredType == "" {
+		return sniffed
+	}
+	if _, generic := genericTypes[declaredType]; generic {
+		return sniffed
+	}
+	if _, signed := signatureTypes[declaredType]; signed {
+		return sniffed
+	}
+
+	return declaredType
+}
+
+// TypeExtension возвращает расширение (с точкой) для типа файла contentType
+// или пустую строку, если расширение для типа неизвестно.
+func TypeExtension(contentType string) string {
+	contentType = mediaType(contentType)
+	if extension, ok := typeExtensions[contentType]; ok {
+		return extension
+	}
+
+	extensions, err := mime.ExtensionsByType(contentType)
+	if err != nil || len(extensions) == 0 {
+		return ""
+	}
+
+	return extensions[0]
+}
+
+// ArchiveEntryName возвращает имя, под которым файл будет сохранён в архиве:
+// filename + расширение, соответствующее типу содержимого contentType (см. TypeExtension).
+// Пример: если по содержимому определён тип image/jpeg и filename = "file1", то в архиве будет "file1.jpg".
+func ArchiveEntryName(filename string, contentType string) string {
+	return filename + TypeExtension(contentType)
+}
+
+// checkMIMEType проверяет, что тип contentType входит в allowedMIMETypes.
+// Пустой список допустимых типов разрешает любой тип.
+func checkMIMEType(contentType string, allowedMIMETypes []string) error {
+	if len(allowedMIMETypes) == 0 {
+		return nil
+	}
+
+	for _, allowed := range allowedMIMETypes {
+		if strings.EqualFold(contentType, allowed) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s, допустимые: %s", ErrUnsupportedMIMEType, contentType, strings.Join(allowedMIMETypes, ", "))
+}
+
+// mediaType возвращает тип из значения Content-Type без параметров (например, charset)
+// или пустую строку, если значение некорректно.
+func mediaType(contentType string) string {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	return parsed
+}
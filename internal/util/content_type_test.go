@@ -0,0 +1,67 @@
+package util
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     string
+		declared string
+		expected string
+	}{
+		{"сигнатура PDF без заголовка", "%PDF-1.7 содержимое", "", "application/pdf"},
+		{"сигнатура важнее общего заголовка", "\x89PNG\r\n\x1a\nданные", "application/octet-stream", "image/png"},
+		{"сигнатура важнее неверного заголовка", "\xff\xd8\xffданные", "image/png", "image/jpeg"},
+		{"HTML-страница под видом изображения", "<!DOCTYPE html><html></html>", "image/jpeg", "text/html"},
+		{"текст под видом PDF", "просто текст", "application/pdf", "text/plain"},
+		{"заголовок для типа без сигнатуры", `{"id": 1}`, "application/json; charset=utf-8", "application/json"},
+		{"некорректный заголовок", "просто текст", "не тип", "text/plain"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, DetectContentType([]byte(test.head), test.declared), test.name)
+	}
+}
+
+func TestTypeExtension(t *testing.T) {
+	assert.Equal(t, ".jpg", TypeExtension("image/jpeg"))
+	assert.Equal(t, ".pdf", TypeExtension("application/pdf; charset=binary"), "параметры типа не учитываются")
+	assert.Equal(t, "", TypeExtension("application/x-unknown"))
+	assert.Equal(t, "file1.png", ArchiveEntryName("file1", "image/png"))
+	assert.Equal(t, "file1", ArchiveEntryName("file1", "application/x-unknown"), "без известного расширения имя не меняется")
+}
+
+func TestDownload_ChecksDetectedType(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "image/jpeg")
+		if request.URL.Query().Get("id") == "1" {
+			io.WriteString(writer, "\xff\xd8\xffизображение")
+			return
+		}
+		io.WriteString(writer, "<html><body>файл не найден</body></html>")
+	}))
+	defer server.Close()
+
+	allowed := []string{"image/jpeg", "image/png"}
+	spooled, err := newTestDownloader(t, DownloaderOptions{}).Download(context.Background(), DownloadRequest{URL: server.URL + "/download?id=1", SpoolDir: t.TempDir(), AllowedMIMETypes: allowed})
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", spooled.ContentType)
+	content, err := os.ReadFile(spooled.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "\xff\xd8\xffизображение", string(content), "прочитанные для определения типа байты должны попасть в файл")
+
+	spoolDir := t.TempDir()
+	_, err = newTestDownloader(t, DownloaderOptions{}).Download(context.Background(), DownloadRequest{URL: server.URL + "/photo.jpg", SpoolDir: spoolDir, AllowedMIMETypes: allowed})
+	assert.ErrorIs(t, err, ErrUnsupportedMIMEType)
+	entries, err := os.ReadDir(spoolDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "отклонённый файл не должен сохраняться")
+}
@@ -0,0 +1,174 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidCredentials возвращается, если учётные данные для скачивания файла некорректны.
+var ErrInvalidCredentials = errors.New("некорректные учётные данные")
+
+// reservedHeaders - заголовки, которые Downloader выставляет сам или которые управляют соединением:
+// их нельзя переопределить через Credentials.Headers.
+var reservedHeaders = []string{
+	"Host", "Range", "If-Range", "Content-Length", "Transfer-Encoding", "Connection",
+	"Accept-Encoding", "Te", "Trailer", "Upgrade", "Keep-Alive", "Proxy-Authorization", "Proxy-Connection",
+}
+
+// Credentials - учётные данные для скачивания файла с сервера, требующего авторизации.
+// Headers - дополнительные заголовки запроса, например {"X-Api-Key": "..."}
+// BearerToken - токен для заголовка "Authorization: Bearer ..."
+// Username, Password - логин и пароль для Basic-авторизации
+// Cookies - cookie запроса (имя - значение)
+//
+// Учётные данные отправляются только хосту из адреса файла: если сервер перенаправил запрос
+// на другой хост, ни Authorization, ни Cookie, ни заголовки из Headers туда не передаются.
+type Credentials struct {
+	Headers     map[string]string
+	BearerToken string
+	Username    string
+	Password    string
+	Cookies     map[string]string
+}
+
+// IsZero сообщает, что учётные данные не заданы.
+func (credentials Credentials) IsZero() bool {
+	return len(credentials.Headers) == 0 && credentials.BearerToken == "" &&
+		credentials.Username == "" && credentials.Password == "" && len(credentials.Cookies) == 0
+}
+
+// Validate проверяет, что учётные данные можно отправить в HTTP-запросе: имена заголовков и cookie корректны,
+// значения не содержат переводов строки, заголовок Authorization задан не больше чем одним способом.
+// Возвращает ErrInvalidCredentials с описанием проблемы. Сами значения в описание не попадают.
+func (credentials Credentials) Validate() error {
+	authorizations := 0
+	if credentials.BearerToken != "" {
+		authorizations++
+	}
+	if credentials.Username != "" || credentials.Password != "" {
+		authorizations++
+	}
+
+	for name, value := range credentials.Headers {
+		if validHeaderName(name) == false {
+			return fmt.Errorf("%w: некорректное имя заголовка %q", ErrInvalidCredentials, name)
+		}
+		for _, reserved := range reservedHeaders {
+			if strings.EqualFold(name, reserved) {
+				return fmt.Errorf("%w: заголовок %s нельзя переопределить", ErrInvalidCredentials, reserved)
+			}
+		}
+		if strings.EqualFold(name, "Authorization") {
+			authorizations++
+		}
+		if strings.EqualFold(name, "Cookie") && len(credentials.Cookies) > 0 {
+			return fmt.Errorf("%w: заголовок Cookie задан вместе с cookies", ErrInvalidCredentials)
+		}
+		if validHeaderValue(value) == false {
+			return fmt.Errorf("%w: недопустимые символы в значении заголовка %s", ErrInvalidCredentials, name)
+		}
+	}
+
+	if authorizations > 1 {
+		return fmt.Errorf("%w: заголовок Authorization задан несколькими способами", ErrInvalidCredentials)
+	}
+	if validHeaderValue(credentials.BearerToken) == false {
+		return fmt.Errorf("%w: недопустимые символы в токене", ErrInvalidCredentials)
+	}
+	if strings.Contains(credentials.Username, ":") || validHeaderValue(credentials.Username) == false {
+		return fmt.Errorf("%w: недопустимые символы в имени пользователя", ErrInvalidCredentials)
+	}
+	if validHeaderValue(credentials.Password) == false {
+		return fmt.Errorf("%w: недопустимые символы в пароле", ErrInvalidCredentials)
+	}
+
+	for name, value := range credentials.Cookies {
+		cookie := &http.Cookie{Name: name, Value: value}
+		if cookie.Valid() != nil {
+			return fmt.Errorf("%w: некорректная cookie %q", ErrInvalidCredentials, name)
+		}
+	}
+
+	return nil
+}
+
+// apply добавляет учётные данные в запрос.
+func (credentials *Credentials) apply(request *http.Request) {
+	for name, value := range credentials.Headers {
+		request.Header.Set(name, value)
+	}
+	if credentials.BearerToken != "" {
+		request.Header.Set("Authorization", "Bearer "+credentials.BearerToken)
+	}
+	if credentials.Username != "" || credentials.Password != "" {
+		request.SetBasicAuth(credentials.Username, credentials.Password)
+	}
+	for name, value := range credentials.Cookies {
+		request.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+}
+
+// strip удаляет учётные данные из заголовков header.
+func (credentials *Credentials) strip(header http.Header) {
+	for name := range credentials.Headers {
+		header.Del(name)
+	}
+	header.Del("Authorization")
+	header.Del("Cookie")
+}
+
+// credentialsKey - ключ контекста запроса, в котором лежат его учётные данные (см. stripForeignCredentials).
+type credentialsKey struct{}
+
+// stripForeignCredentials убирает учётные данные из перенаправленного запроса, если он уходит
+// не на хост исходного запроса или с https на http (http.Client сам удаляет только Authorization
+// и Cookie и только при переходе на другой домен, а заголовки вроде X-Api-Key передаёт куда угодно).
+// Переход с http на https учётные данные сохраняет: по открытому каналу они уже ушли в исходном запросе.
+func stripForeignCredentials(request *http.Request, via []*http.Request) {
+	credentials, ok := request.Context().Value(credentialsKey{}).(*Credentials)
+	if ok == false || len(via) == 0 {
+		return
+	}
+	original := via[0].URL
+	downgraded := strings.EqualFold(original.Scheme, "https") && strings.EqualFold(request.URL.Scheme, "https") == false
+	if strings.EqualFold(request.URL.Host, original.Host) == false || downgraded {
+		credentials.strip(request.Header)
+	}
+}
+
+// withCredentials сохраняет учётные данные в контексте запроса, чтобы их можно было убрать при перенаправлении.
+func withCredentials(ctx context.Context, credentials *Credentials) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, credentials)
+}
+
+// validHeaderName сообщает, является ли name корректным именем заголовка (token из RFC 9110).
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, char := range name {
+		if char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' {
+			continue
+		}
+		if strings.ContainsRune("!#$%&'*+-.^_`|~", char) == false {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validHeaderValue сообщает, можно ли отправить value в заголовке: в нём нет управляющих символов,
+// кроме табуляции (в том числе переводов строки, через которые можно было бы дописать свои заголовки).
+func validHeaderValue(value string) bool {
+	for _, char := range value {
+		if char < ' ' && char != '\t' || char == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,160 @@
+package util
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCredentials_Validate(t *testing.T) {
+	valid := Credentials{
+		Headers:  map[string]string{"X-Api-Key": "secret"},
+		Username: "user",
+		Password: "p@ss word",
+		Cookies:  map[string]string{"session": "abc123"},
+	}
+	assert.NoError(t, valid.Validate())
+	assert.True(t, Credentials{}.IsZero())
+	assert.False(t, valid.IsZero())
+
+	invalid := []struct {
+		name        string
+		credentials Credentials
+	}{
+		{"перевод строки в заголовке", Credentials{Headers: map[string]string{"X-Api-Key": "a\r\nX-Injected: 1"}}},
+		{"некорректное имя заголовка", Credentials{Headers: map[string]string{"X Api Key": "a"}}},
+		{"служебный заголовок", Credentials{Headers: map[string]string{"host": "internal"}}},
+		{"токен и Basic вместе", Credentials{BearerToken: "token", Username: "user"}},
+		{"токен и заголовок Authorization", Credentials{BearerToken: "token", Headers: map[string]string{"Authorization": "x"}}},
+		{"двоеточие в имени пользователя", Credentials{Username: "us:er", Password: "x"}},
+		{"некорректная cookie", Credentials{Cookies: map[string]string{"session": "a;b"}}},
+	}
+	for _, test := range invalid {
+		err := test.credentials.Validate()
+		assert.ErrorIs(t, err, ErrInvalidCredentials, test.name)
+		if err != nil {
+			assert.NotContains(t, err.Error(), "X-Injected", "значения не попадают в текст ошибки")
+		}
+	}
+}
+
+func TestDownload_Credentials(t *testing.T) {
+	foreignHeaders := make(chan http.Header, 1)
+	foreign := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		foreignHeaders <- request.Header.Clone()
+		io.WriteString(writer, "%PDF-1.7 содержимое")
+	}))
+	defer foreign.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		username, password, ok := request.BasicAuth()
+		cookie, err := request.Cookie("session")
+		if ok == false || username != "user" || password != "secret" || err != nil || cookie.Value != "abc" ||
+			request.Header.Get("X-Api-Key") != "key" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch request.URL.Path {
+		case "/same-host":
+			http.Redirect(writer, request, "/file.pdf", http.StatusFound)
+		case "/foreign":
+			http.Redirect(writer, request, foreign.URL+"/file.pdf", http.StatusFound)
+		default:
+			io.WriteString(writer, "%PDF-1.7 содержимое")
+		}
+	}))
+	defer origin.Close()
+
+	downloader := newTestDownloader(t, testDownloaderOptions)
+	credentials := &Credentials{
+		Headers:  map[string]string{"X-Api-Key": "key"},
+		Username: "user",
+		Password: "secret",
+		Cookies:  map[string]string{"session": "abc"},
+	}
+
+	_, err := downloader.Download(context.Background(), DownloadRequest{URL: origin.URL + "/file.pdf", SpoolDir: t.TempDir()})
+	assert.ErrorContains(t, err, "401", "без учётных данных сервер отказывает")
+
+	for _, path := range []string{"/file.pdf", "/same-host"} {
+		_, err = downloader.Download(context.Background(), DownloadRequest{
+			URL:         origin.URL + path,
+			SpoolDir:    t.TempDir(),
+			Credentials: credentials,
+		})
+		assert.NoError(t, err, path)
+	}
+
+	_, err = downloader.Download(context.Background(), DownloadRequest{
+		URL:         origin.URL + "/foreign",
+		SpoolDir:    t.TempDir(),
+		Credentials: credentials,
+	})
+	assert.NoError(t, err)
+	header := <-foreignHeaders
+	assert.Empty(t, header.Get("Authorization"), "учётные данные не уходят на другой хост")
+	assert.Empty(t, header.Get("Cookie"))
+	assert.Empty(t, header.Get("X-Api-Key"))
+}
+
+// redirectTransport отвечает перенаправлением с адресов из redirects и запоминает заголовки
+// остальных запросов, не выходя в сеть.
+type redirectTransport struct {
+	redirects map[string]string
+	headers   http.Header
+}
+
+func (transport *redirectTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response := &http.Response{Header: http.Header{}, Body: http.NoBody, Request: request}
+	if location, ok := transport.redirects[request.URL.String()]; ok {
+		response.StatusCode = http.StatusFound
+		response.Header.Set("Location", location)
+		return response, nil
+	}
+	transport.headers = request.Header.Clone()
+	response.StatusCode = http.StatusOK
+	return response, nil
+}
+
+func TestStripForeignCredentials_SchemeDowngrade(t *testing.T) {
+	credentials := &Credentials{
+		Headers:     map[string]string{"X-Api-Key": "key"},
+		BearerToken: "token",
+	}
+	transport := &redirectTransport{redirects: map[string]string{
+		"https://files.example.com/downgrade": "http://files.example.com/file.pdf",
+		"https://files.example.com/same":      "https://files.example.com/file.pdf",
+		"http://files.example.com/upgrade":    "https://files.example.com/file.pdf",
+	}}
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			stripForeignCredentials(request, via)
+			return nil
+		},
+	}
+	get := func(url string) http.Header {
+		request, err := http.NewRequestWithContext(withCredentials(context.Background(), credentials), http.MethodGet, url, nil)
+		assert.NoError(t, err)
+		credentials.apply(request)
+		response, err := client.Do(request)
+		assert.NoError(t, err)
+		response.Body.Close()
+		return transport.headers
+	}
+
+	header := get("https://files.example.com/downgrade")
+	assert.Empty(t, header.Get("Authorization"), "учётные данные не уходят по http после перенаправления с https")
+	assert.Empty(t, header.Get("X-Api-Key"))
+
+	header = get("https://files.example.com/same")
+	assert.Equal(t, "Bearer token", header.Get("Authorization"), "на тот же хост по https учётные данные сохраняются")
+	assert.Equal(t, "key", header.Get("X-Api-Key"))
+
+	header = get("http://files.example.com/upgrade")
+	assert.Equal(t, "Bearer token", header.Get("Authorization"), "переход на https учётные данные сохраняет")
+	assert.Equal(t, "key", header.Get("X-Api-Key"))
+}
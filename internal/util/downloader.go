@@ -0,0 +1,556 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errIdleTimeout - причина прерывания попытки, если сервер дольше IdleTimeout не присылает данные.
+var errIdleTimeout = errors.New("сервер не присылает данные дольше таймаута простоя")
+
+// Значения DownloaderOptions по умолчанию.
+const (
+	defaultConnectTimeout  = 10 * time.Second
+	defaultHeaderTimeout   = 30 * time.Second
+	defaultIdleTimeout     = 30 * time.Second
+	defaultMaxAttempts     = 3
+	defaultRetryBaseDelay  = 500 * time.Millisecond
+	defaultRetryMaxDelay   = 30 * time.Second
+	defaultMaxConnsPerHost = 8
+	defaultIdleConnTimeout = 90 * time.Second
+)
+
+// DownloaderOptions - настройки скачивания файлов. Нулевое значение поля - значение по умолчанию.
+// ConnectTimeout - таймаут установки соединения (вместе с TLS-рукопожатием), по умолчанию 10s
+// HeaderTimeout - сколько ждать заголовков ответа после отправки запроса, по умолчанию 30s
+// IdleTimeout - сколько ждать очередной порции тела ответа, по умолчанию 30s
+// MaxAttempts - максимальное количество попыток скачать файл (1 - без повторов), по умолчанию 3
+// RetryBaseDelay - пауза перед второй попыткой, перед каждой следующей она удваивается, по умолчанию 500ms
+// RetryMaxDelay - максимальная пауза между попытками, по умолчанию 30s
+// URLPolicy - какие адреса можно скачивать (защита от SSRF), см. URLPolicy
+// MaxConnsPerHost - сколько соединений можно одновременно держать с одним хостом (остальные запросы ждут
+// свободного соединения), по умолчанию 8, отрицательное значение снимает ограничение
+// MaxIdleConnsPerHost - сколько свободных соединений с хостом держать для повторного использования,
+// по умолчанию MaxConnsPerHost (2 без ограничения соединений)
+// IdleConnTimeout - через сколько закрывать неиспользуемое соединение, по умолчанию 90s
+// RateLimit - ограничения частоты запросов к одному хосту и ко всем хостам вместе, по умолчанию без ограничений
+type DownloaderOptions struct {
+	ConnectTimeout time.Duration
+	HeaderTimeout  time.Duration
+	IdleTimeout    time.Duration
+	MaxAttempts    int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	URLPolicy      URLPolicy
+
+	MaxConnsPerHost     int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	RateLimit           RateLimit
+}
+
+// Downloader скачивает файлы во временные файлы, повторяя попытки при временных ошибках
+// и докачивая файл с места обрыва, если сервер это поддерживает. Безопасен для конкурентного использования:
+// все скачивания сервиса идут через один Downloader, чтобы лимиты соединений и частоты запросов к хосту
+// действовали на все задачи вместе.
+type Downloader struct {
+	client  *http.Client
+	guard   *urlGuard
+	options DownloaderOptions
+}
+
+// NewDownloader создаёт Downloader с настройками options (нулевые поля заменяются значениями по умолчанию).
+// Возвращает ошибку, если options.URLPolicy некорректна.
+func NewDownloader(options DownloaderOptions) (*Downloader, error) {
+	guard, err := newURLGuard(options.URLPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.ConnectTimeout <= 0 {
+		options.ConnectTimeout = defaultConnectTimeout
+	}
+	if options.HeaderTimeout <= 0 {
+		options.HeaderTimeout = defaultHeaderTimeout
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = defaultIdleTimeout
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultMaxAttempts
+	}
+	if options.RetryBaseDelay <= 0 {
+		options.RetryBaseDelay = defaultRetryBaseDelay
+	}
+	if options.RetryMaxDelay <= 0 {
+		options.RetryMaxDelay = defaultRetryMaxDelay
+	}
+	if options.MaxConnsPerHost == 0 {
+		options.MaxConnsPerHost = defaultMaxConnsPerHost
+	}
+	if options.MaxIdleConnsPerHost <= 0 {
+		options.MaxIdleConnsPerHost = http.DefaultMaxIdleConnsPerHost
+		if options.MaxConnsPerHost > 0 {
+			options.MaxIdleConnsPerHost = options.MaxConnsPerHost
+		}
+	}
+	if options.IdleConnTimeout <= 0 {
+		options.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	options.RateLimit = options.RateLimit.withDefaults()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// адрес проверяется при каждом соединении, то есть после разрешения имени и на каждом перенаправлении
+	dialer := &net.Dialer{Timeout: options.ConnectTimeout, KeepAlive: 30 * time.Second, Control: guard.control}
+	transport.DialContext = dialer.DialContext
+	// через прокси проверялся бы адрес прокси, а не хоста с файлом
+	transport.Proxy = nil
+	transport.TLSHandshakeTimeout = options.ConnectTimeout
+	transport.ResponseHeaderTimeout = options.HeaderTimeout
+	// при прозрачной распаковке gzip смещения в Range не совпадали бы с байтами на диске
+	transport.DisableCompression = true
+	transport.MaxConnsPerHost = max(options.MaxConnsPerHost, 0)
+	transport.MaxIdleConnsPerHost = options.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = options.IdleConnTimeout
+
+	publishLimits(options)
+
+	return &Downloader{
+		client: &http.Client{
+			Transport: &limitedTransport{next: transport, limiter: newRateLimiter(options.RateLimit)},
+			CheckRedirect: func(request *http.Request, via []*http.Request) error {
+				if err := guard.checkRedirect(request, via); err != nil {
+					return err
+				}
+				stripForeignCredentials(request, via)
+				return nil
+			},
+		},
+		guard:   guard,
+		options: options,
+	}, nil
+}
+
+// CheckURL проверяет, что файл можно скачивать по адресу rawURL: адрес корректен и разрешён URLPolicy,
+// в том числе все IP-адреса, в которые разрешается имя хоста. Позволяет отклонить адрес до постановки
+// файла в очередь; при скачивании адрес всё равно проверяется ещё раз.
+// Возвращает ErrURLForbidden, если адрес запрещён политикой.
+func (downloader *Downloader) CheckURL(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("некорректный адрес: %w", err)
+	}
+
+	return downloader.guard.checkResolved(ctx, target)
+}
+
+// DownloadRequest - что и куда скачивать.
+// URL - адрес файла
+// SpoolDir - каталог временных файлов (пустой - системный каталог временных файлов)
+// AllowedMIMETypes - допустимые типы файла, определённые по содержимому (пустой список - любой тип)
+// Quota - где резервировать место под файл (nil - без ограничений)
+// OnAttemptError - вызывается после каждой неудачной попытки с её номером и ошибкой (может быть nil)
+// Credentials - учётные данные для сервера с файлом (nil - без авторизации), должны быть проверены Validate
+type DownloadRequest struct {
+	URL              string
+	SpoolDir         string
+	AllowedMIMETypes []string
+	Quota            Quota
+	OnAttemptError   func(attempt int, err error)
+	Credentials      *Credentials
+}
+
+// SpooledFile - файл, скачанный Downloader.Download во временный файл Path.
+// Size, ContentType (тип, определённый по содержимому, см. DetectContentType), SHA256 (в шестнадцатеричном виде)
+// и DownloadedAt попадают в манифест архива. Attempts - сколько попыток понадобилось, чтобы скачать файл.
+type SpooledFile struct {
+	Path         string
+	Size         int64
+	ContentType  string
+	SHA256       string
+	DownloadedAt time.Time
+	Attempts     int
+}
+
+// attemptError - ошибка попытки, после которой скачивание стоит повторить.
+// retryAfter - пауза, которую попросил сервер в заголовке Retry-After (0 - не просил).
+type attemptError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (err *attemptError) Error() string {
+	return err.err.Error()
+}
+
+func (err *attemptError) Unwrap() error {
+	return err.err
+}
+
+// spool - состояние скачивания, которое сохраняется между попытками.
+// validator - ETag или Last-Modified ответа, по которому сервер проверяет в If-Range,
+// что файл не изменился и его можно докачать (пустой - докачка невозможна).
+type spool struct {
+	file        *os.File
+	output      *quotaWriter
+	hash        hash.Hash
+	contentType string
+	validator   string
+}
+
+// Download скачивает файл request.URL во временный файл в каталоге request.SpoolDir
+// и возвращает его вместе с размером, типом, контрольной суммой SHA-256 и количеством попыток.
+// Запись в архив выполняется отдельно (см. AddSpoolToArchive), поэтому несколько файлов одной задачи
+// могут скачиваться параллельно, не трогая общий ArchiveWriter.
+//
+// Шаги метода:
+// 1. Скачивается содержимое файла по HTTP GET (запрос прерывается при отмене ctx).
+// Если сервер прислал Content-Length, место под весь файл резервируется в request.Quota до чтения содержимого.
+// 2. По первым байтам содержимого и заголовку Content-Type определяется тип файла (см. DetectContentType)
+// и проверяется, что он входит в request.AllowedMIMETypes.
+// 3. Содержимое сохраняется во временный файл, попутно считается SHA-256. Место под каждую порцию
+// содержимого сверх уже зарезервированного резервируется в request.Quota до её записи, поэтому файл
+// без Content-Length или длиннее объявленного прерывается, как только превысит лимит.
+//
+// Попытка повторяется при сетевых ошибках, обрыве или простое соединения (IdleTimeout) и ответах
+// 408, 429, 500, 502, 503 и 504 - не более MaxAttempts попыток. Пауза перед повтором растёт экспоненциально
+// от RetryBaseDelay до RetryMaxDelay со случайным разбросом в пределах её второй половины, чтобы
+// повторы разных файлов не приходили на сервер одновременно. Если сервер прислал Retry-After, выжидается
+// указанное время, а если оно больше RetryMaxDelay, скачивание сразу завершается ошибкой.
+// Остальные ответы 4xx, недопустимый тип файла, ошибки quota и адреса, запрещённые URLPolicy, не повторяются.
+//
+// Учётные данные request.Credentials отправляются с каждой попыткой, но не уходят на другой хост
+// при перенаправлении.
+//
+// Адрес файла и каждого перенаправления проверяется по URLPolicy, а IP-адрес - при установке соединения,
+// до отправки запроса, поэтому с запрещённого адреса не скачивается ни одного байта (ErrURLForbidden).
+//
+// Если сервер поддерживает диапазоны (Accept-Ranges: bytes) и прислал ETag или Last-Modified,
+// после обрыва файл докачивается запросом с Range и If-Range. Если файл на сервере изменился
+// и сервер прислал его целиком, скачанное ранее отбрасывается.
+//
+// Если скачать файл не удалось, временный файл удаляется. Освобождать зарезервированное место
+// при ошибке должен вызывающий код.
+// Возвращает: временный файл с метаданными; ошибку (при нескольких попытках - с их количеством)
+func (downloader *Downloader) Download(ctx context.Context, request DownloadRequest) (_ SpooledFile, err error) {
+	target, err := url.Parse(request.URL)
+	if err != nil {
+		return SpooledFile{}, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	if err := downloader.guard.checkURL(target); err != nil {
+		return SpooledFile{}, err
+	}
+
+	state := &spool{hash: sha256.New()}
+	defer func() {
+		if err != nil && state.file != nil {
+			state.file.Close()
+			os.Remove(state.file.Name())
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		err := downloader.attempt(ctx, request, state)
+		if err == nil {
+			if err := state.file.Close(); err != nil {
+				return SpooledFile{}, fmt.Errorf("ошибка сохранения файла: %w", err)
+			}
+
+			return SpooledFile{
+				Path:         state.file.Name(),
+				Size:         state.output.written,
+				ContentType:  state.contentType,
+				SHA256:       hex.EncodeToString(state.hash.Sum(nil)),
+				DownloadedAt: time.Now(),
+				Attempts:     attempt,
+			}, nil
+		}
+
+		if request.OnAttemptError != nil {
+			request.OnAttemptError(attempt, err)
+		}
+
+		var retryable *attemptError
+		if errors.As(err, &retryable) == false || attempt >= downloader.options.MaxAttempts || ctx.Err() != nil {
+			return SpooledFile{}, attemptsError(err, attempt)
+		}
+
+		delay := retryable.retryAfter
+		if delay > downloader.options.RetryMaxDelay {
+			err = fmt.Errorf("%w, сервер просит повторить не раньше чем через %s", err, delay)
+			return SpooledFile{}, attemptsError(err, attempt)
+		}
+		if delay == 0 {
+			delay = downloader.backoff(attempt)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return SpooledFile{}, attemptsError(fmt.Errorf("скачивание прервано: %w", ctx.Err()), attempt)
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt выполняет одну попытку скачивания: с начала файла или, если уже что-то скачано
+// и известен state.validator, с места обрыва. Ошибки, после которых попытку стоит повторить,
+// возвращаются как *attemptError.
+func (downloader *Downloader) attempt(ctx context.Context, request DownloadRequest, state *spool) error {
+	attemptCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	requestCtx := context.Context(attemptCtx)
+	if request.Credentials != nil {
+		requestCtx = withCredentials(attemptCtx, request.Credentials)
+	}
+	httpRequest, err := http.NewRequestWithContext(requestCtx, http.MethodGet, request.URL, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	if request.Credentials != nil {
+		request.Credentials.apply(httpRequest)
+	}
+
+	var offset int64
+	if state.output != nil && state.output.written > 0 && state.validator != "" {
+		offset = state.output.written
+		httpRequest.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		httpRequest.Header.Set("If-Range", state.validator)
+	}
+
+	response, err := downloader.client.Do(httpRequest)
+	if err != nil {
+		err = fmt.Errorf("ошибка скачивания файла: %w", err)
+		if ctx.Err() != nil || errors.Is(err, ErrURLForbidden) {
+			return err
+		}
+		return &attemptError{err: err}
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode == http.StatusPartialContent && offset > 0 && rangeStart(response) == offset:
+		// сервер продолжил файл с места обрыва
+		if err := state.output.reserveUpTo(offset + response.ContentLength); err != nil {
+			return fmt.Errorf("файл размером %d байт: %w", offset+response.ContentLength, err)
+		}
+	case response.StatusCode == http.StatusOK:
+		if err := state.reset(request.SpoolDir, request.Quota); err != nil {
+			return err
+		}
+		state.validator = rangeValidator(response)
+		if err := state.output.reserveUpTo(response.ContentLength); err != nil {
+			return fmt.Errorf("файл размером %d байт: %w", response.ContentLength, err)
+		}
+	case response.StatusCode == http.StatusPartialContent || response.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		// сервер вернул не тот диапазон: следующая попытка скачает файл целиком
+		state.validator = ""
+		return &attemptError{err: fmt.Errorf("сервер вернул неожиданный диапазон: %s", response.Status)}
+	case retryableStatus(response.StatusCode):
+		return &attemptError{
+			err:        fmt.Errorf("сервер вернул ошибку: %s", response.Status),
+			retryAfter: retryAfter(response.Header.Get("Retry-After"), time.Now()),
+		}
+	default:
+		return fmt.Errorf("сервер вернул ошибку: %s", response.Status)
+	}
+
+	idleTimeout := downloader.options.IdleTimeout
+	body := &idleReader{
+		reader:  response.Body,
+		timer:   time.AfterFunc(idleTimeout, func() { cancel(errIdleTimeout) }),
+		timeout: idleTimeout,
+	}
+	defer body.timer.Stop()
+
+	readError := func(err error) error {
+		if cause := context.Cause(attemptCtx); errors.Is(cause, errIdleTimeout) {
+			err = cause
+		}
+		err = fmt.Errorf("ошибка скачивания файла: %w", err)
+		if ctx.Err() != nil {
+			return err
+		}
+		return &attemptError{err: err}
+	}
+
+	var reader io.Reader = body
+	if state.output.written == 0 {
+		buffered := bufio.NewReaderSize(body, sniffLength)
+		head, err := buffered.Peek(sniffLength)
+		if err != nil && errors.Is(err, io.EOF) == false {
+			return readError(err)
+		}
+		state.contentType = DetectContentType(head, response.Header.Get("Content-Type"))
+		if err := checkMIMEType(state.contentType, request.AllowedMIMETypes); err != nil {
+			return err
+		}
+		reader = buffered
+	}
+
+	if _, err := io.Copy(io.MultiWriter(state.output, state.hash), reader); err != nil {
+		if body.err != nil {
+			return readError(body.err)
+		}
+		return fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+
+	return nil
+}
+
+// reset готовит временный файл к скачиванию с начала: создаёт его в каталоге spoolDir при первой попытке
+// или отбрасывает скачанное ранее. Зарезервированное в quota место сохраняется.
+func (state *spool) reset(spoolDir string, quota Quota) error {
+	state.hash.Reset()
+	state.contentType = ""
+
+	if state.file == nil {
+		file, err := os.CreateTemp(spoolDir, "download-*")
+		if err != nil {
+			return fmt.Errorf("ошибка создания временного файла: %w", err)
+		}
+		state.file = file
+		state.output = &quotaWriter{writer: file, quota: quota}
+		return nil
+	}
+
+	if err := state.file.Truncate(0); err != nil {
+		return fmt.Errorf("ошибка очистки временного файла: %w", err)
+	}
+	if _, err := state.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("ошибка очистки временного файла: %w", err)
+	}
+	state.output.written = 0
+
+	return nil
+}
+
+// backoff возвращает паузу перед попыткой attempt+1: RetryBaseDelay * 2^(attempt-1), но не больше RetryMaxDelay,
+// со случайным разбросом от половины этого значения до полного.
+func (downloader *Downloader) backoff(attempt int) time.Duration {
+	maxDelay := downloader.options.RetryMaxDelay
+	delay := maxDelay
+	if attempt <= 32 {
+		if scaled := downloader.options.RetryBaseDelay << (attempt - 1); scaled > 0 && scaled < maxDelay {
+			delay = scaled
+		}
+	}
+
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// attemptsError добавляет к ошибке количество попыток, если их было больше одной.
+func attemptsError(err error, attempts int) error {
+	if attempts == 1 {
+		return err
+	}
+
+	return fmt.Errorf("%w (попыток: %d)", err, attempts)
+}
+
+// retryableStatus сообщает, стоит ли повторить запрос, на который сервер ответил статусом status.
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// retryAfter разбирает заголовок Retry-After (количество секунд или HTTP-дата)
+// и возвращает паузу относительно now или 0, если заголовка нет или он некорректен.
+func retryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// rangeValidator возвращает значение для If-Range: сильный ETag, а если его нет - Last-Modified.
+// Пустая строка означает, что сервер не поддерживает докачку файла.
+func rangeValidator(response *http.Response) string {
+	if strings.EqualFold(response.Header.Get("Accept-Ranges"), "bytes") == false {
+		return ""
+	}
+
+	// слабый ETag (W/"...") в If-Range использовать нельзя
+	if etag := response.Header.Get("ETag"); etag != "" && strings.HasPrefix(etag, "W/") == false {
+		return etag
+	}
+
+	return response.Header.Get("Last-Modified")
+}
+
+// rangeStart возвращает начало диапазона из заголовка Content-Range ("bytes 100-199/200") или -1.
+func rangeStart(response *http.Response) int64 {
+	contentRange, found := strings.CutPrefix(response.Header.Get("Content-Range"), "bytes ")
+	if found == false {
+		return -1
+	}
+
+	start, _, found := strings.Cut(contentRange, "-")
+	if found == false {
+		return -1
+	}
+
+	offset, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	return offset
+}
+
+// idleReader читает тело ответа и после каждой полученной порции данных перезапускает timer,
+// который прерывает попытку, если данные перестали приходить. err - последняя ошибка чтения (кроме io.EOF),
+// по ней отличают обрыв соединения от ошибки записи во временный файл.
+type idleReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+	err     error
+}
+
+func (reader *idleReader) Read(data []byte) (int, error) {
+	n, err := reader.reader.Read(data)
+	if n > 0 {
+		reader.timer.Reset(reader.timeout)
+	}
+	if err != nil && errors.Is(err, io.EOF) == false {
+		reader.err = err
+	}
+
+	return n, err
+}
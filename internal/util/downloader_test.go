@@ -0,0 +1,161 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testDownloaderOptions - быстрые повторы, чтобы тесты не ждали пауз по умолчанию.
+var testDownloaderOptions = DownloaderOptions{
+	IdleTimeout:    200 * time.Millisecond,
+	MaxAttempts:    3,
+	RetryBaseDelay: time.Millisecond,
+	RetryMaxDelay:  50 * time.Millisecond,
+}
+
+// newTestDownloader создаёт Downloader, которому разрешено скачивать с тестовых серверов на loopback-адресе.
+func newTestDownloader(t *testing.T, options DownloaderOptions) *Downloader {
+	options.URLPolicy.AllowedNetworks = append(options.URLPolicy.AllowedNetworks, "127.0.0.0/8")
+	downloader, err := NewDownloader(options)
+	assert.NoError(t, err)
+
+	return downloader
+}
+
+func TestDownload_RetriesTemporaryErrors(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if requests.Add(1) == 1 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(writer, "%PDF-1.7 содержимое")
+	}))
+	defer server.Close()
+
+	var attemptErrors []int
+	spooled, err := newTestDownloader(t, testDownloaderOptions).Download(context.Background(), DownloadRequest{
+		URL:      server.URL + "/file.pdf",
+		SpoolDir: t.TempDir(),
+		OnAttemptError: func(attempt int, err error) {
+			attemptErrors = append(attemptErrors, attempt)
+			assert.ErrorContains(t, err, "503")
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, spooled.Attempts)
+	assert.Equal(t, []int{1}, attemptErrors, "о неудачной попытке должно сообщаться")
+	content, err := os.ReadFile(spooled.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.7 содержимое", string(content))
+}
+
+func TestDownload_DoesNotRetryClientErrors(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests.Add(1)
+		http.NotFound(writer, request)
+	}))
+	defer server.Close()
+
+	_, err := newTestDownloader(t, testDownloaderOptions).Download(context.Background(), DownloadRequest{URL: server.URL, SpoolDir: t.TempDir()})
+	assert.ErrorContains(t, err, "404")
+	assert.Equal(t, int32(1), requests.Load(), "ответ 404 не должен повторяться")
+}
+
+func TestDownload_RetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests.Add(1)
+		writer.Header().Set("Retry-After", "3600")
+		writer.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	started := time.Now()
+	_, err := newTestDownloader(t, testDownloaderOptions).Download(context.Background(), DownloadRequest{URL: server.URL, SpoolDir: t.TempDir()})
+	assert.ErrorContains(t, err, "1h0m0s")
+	assert.Equal(t, int32(1), requests.Load(), "пауза длиннее RetryMaxDelay не выжидается")
+	assert.Less(t, time.Since(started), time.Second)
+
+	now := time.Date(2025, 7, 17, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 2*time.Second, retryAfter("2", now))
+	assert.Equal(t, time.Minute, retryAfter("Thu, 17 Jul 2025 12:01:00 GMT", now))
+	assert.Zero(t, retryAfter("Thu, 17 Jul 2025 11:00:00 GMT", now), "дата в прошлом - без паузы")
+	assert.Zero(t, retryAfter("скоро", now))
+}
+
+func TestDownload_ResumesWithRange(t *testing.T) {
+	content := []byte("%PDF-1.7 " + strings.Repeat("содержимое ", 5000))
+	modified := time.Date(2025, 7, 17, 12, 0, 0, 0, time.UTC)
+	var requests atomic.Int32
+	var resumedRange atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("ETag", `"v1"`)
+		if requests.Add(1) == 1 {
+			// отдаём половину файла и обрываем соединение
+			writer.Header().Set("Accept-Ranges", "bytes")
+			writer.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			writer.Write(content[:len(content)/2])
+			writer.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		resumedRange.Store(request.Header.Get("Range") + " " + request.Header.Get("If-Range"))
+		http.ServeContent(writer, request, "file.pdf", modified, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	quota := &testQuota{limit: int64(len(content))}
+	spooled, err := newTestDownloader(t, testDownloaderOptions).Download(context.Background(), DownloadRequest{
+		URL:      server.URL + "/file.pdf",
+		SpoolDir: t.TempDir(),
+		Quota:    quota,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, spooled.Attempts)
+	assert.Equal(t, `bytes=`+strconv.Itoa(len(content)/2)+`- "v1"`, resumedRange.Load(), "файл должен докачиваться с места обрыва")
+	assert.Equal(t, int64(len(content)), quota.reserved, "докачанные байты не должны резервироваться повторно")
+	downloaded, err := os.ReadFile(spooled.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+	assert.Equal(t, int64(len(content)), spooled.Size)
+}
+
+func TestDownload_IdleTimeout(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		io.WriteString(writer, "%PDF-1.7 ")
+		if requests.Add(1) == 1 {
+			// сервер зависает посреди ответа
+			writer.(http.Flusher).Flush()
+			<-request.Context().Done()
+			return
+		}
+		io.WriteString(writer, "содержимое")
+	}))
+	defer server.Close()
+
+	var attemptErr error
+	spooled, err := newTestDownloader(t, testDownloaderOptions).Download(context.Background(), DownloadRequest{
+		URL:      server.URL,
+		SpoolDir: t.TempDir(),
+		OnAttemptError: func(attempt int, err error) {
+			attemptErr = err
+		},
+	})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, attemptErr, errIdleTimeout)
+	content, err := os.ReadFile(spooled.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.7 содержимое", string(content), "без ETag файл скачивается заново целиком")
+}
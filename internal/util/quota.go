@@ -0,0 +1,47 @@
+package util
+
+import (
+	"io"
+)
+
+// Quota резервирует место под скачиваемый файл (см. Downloader.Download).
+type Quota interface {
+	// Reserve резервирует ещё size байт. Если лимит будет превышен, возвращает ошибку,
+	// и скачивание прерывается, не записав эти байты.
+	Reserve(size int64) error
+}
+
+// quotaWriter - io.Writer, который перед записью резервирует в quota (если она задана) байты
+// сверх уже зарезервированных. Место можно зарезервировать и заранее (см. reserveUpTo),
+// тогда при записи резервируется только то, что превышает резерв.
+type quotaWriter struct {
+	writer   io.Writer
+	quota    Quota
+	written  int64
+	reserved int64
+}
+
+func (writer *quotaWriter) Write(data []byte) (int, error) {
+	if err := writer.reserveUpTo(writer.written + int64(len(data))); err != nil {
+		return 0, err
+	}
+
+	n, err := writer.writer.Write(data)
+	writer.written += int64(n)
+
+	return n, err
+}
+
+// reserveUpTo резервирует место так, чтобы всего было зарезервировано не меньше total байт.
+func (writer *quotaWriter) reserveUpTo(total int64) error {
+	if writer.quota == nil || total <= writer.reserved {
+		return nil
+	}
+
+	if err := writer.quota.Reserve(total - writer.reserved); err != nil {
+		return err
+	}
+	writer.reserved = total
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var errTestQuota = errors.New("лимит превышен")
+
+// testQuota разрешает зарезервировать не больше limit байт и запоминает запросы на резерв.
+type testQuota struct {
+	limit    int64
+	reserved int64
+	requests []int64
+}
+
+func (quota *testQuota) Reserve(size int64) error {
+	quota.requests = append(quota.requests, size)
+	if quota.reserved+size > quota.limit {
+		return errTestQuota
+	}
+	quota.reserved += size
+
+	return nil
+}
+
+func TestDownload_Quota(t *testing.T) {
+	content := "%PDF-1.7 " + strings.Repeat("содержимое ", 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/sized.pdf" {
+			writer.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		}
+		writer.Header().Set("Content-Type", "application/pdf")
+		for i := 0; i < len(content); i += 4096 {
+			writer.Write([]byte(content[i:min(i+4096, len(content))]))
+			writer.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Content-Length", func(t *testing.T) {
+		quota := &testQuota{limit: int64(len(content))}
+		spooled, err := newTestDownloader(t, DownloaderOptions{}).Download(context.Background(), DownloadRequest{URL: server.URL + "/sized.pdf", SpoolDir: t.TempDir(), Quota: quota})
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{int64(len(content))}, quota.requests, "по Content-Length место резервируется один раз и заранее")
+		assert.Equal(t, int64(len(content)), spooled.Size)
+
+		spoolDir := t.TempDir()
+		quota = &testQuota{limit: int64(len(content)) - 1}
+		_, err = newTestDownloader(t, DownloaderOptions{}).Download(context.Background(), DownloadRequest{URL: server.URL + "/sized.pdf", SpoolDir: spoolDir, Quota: quota})
+		assert.ErrorIs(t, err, errTestQuota, "файл с Content-Length больше лимита отклоняется до чтения содержимого")
+		entries, _ := os.ReadDir(spoolDir)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("без Content-Length", func(t *testing.T) {
+		quota := &testQuota{limit: int64(len(content))}
+		spooled, err := newTestDownloader(t, DownloaderOptions{}).Download(context.Background(), DownloadRequest{URL: server.URL + "/chunked.pdf", SpoolDir: t.TempDir(), Quota: quota})
+		assert.NoError(t, err)
+		assert.Greater(t, len(quota.requests), 1, "без Content-Length место резервируется по мере скачивания")
+		assert.Equal(t, int64(len(content)), quota.reserved)
+		assert.Equal(t, int64(len(content)), spooled.Size)
+
+		spoolDir := t.TempDir()
+		quota = &testQuota{limit: 10000}
+		_, err = newTestDownloader(t, DownloaderOptions{}).Download(context.Background(), DownloadRequest{URL: server.URL + "/chunked.pdf", SpoolDir: spoolDir, Quota: quota})
+		assert.ErrorIs(t, err, errTestQuota, "скачивание прерывается, как только файл превысит лимит")
+		assert.LessOrEqual(t, quota.reserved, int64(10000), "сверх лимита ничего не резервируется")
+		entries, _ := os.ReadDir(spoolDir)
+		assert.Empty(t, entries, "недокачанный файл должен удаляться")
+	})
+}
@@ -0,0 +1,206 @@
+package util
+
+import (
+	"context"
+	"expvar"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outboundMetrics - метрики исходящих запросов за файлами, доступны по /debug/vars в разделе "outbound":
+// requests - сколько запросов отправлено (каждая попытка и каждое перенаправление - отдельный запрос),
+// throttled - сколько из них ждали ограничителя частоты, throttle_wait_seconds - сколько секунд они ждали,
+// limit_* - действующие лимиты последнего созданного Downloader.
+var outboundMetrics = expvar.NewMap("outbound")
+
+// maxHostBuckets - сколько хостов ограничитель помнит, прежде чем начнёт забывать хосты с полным запасом токенов.
+const maxHostBuckets = 1024
+
+// RateLimit - ограничения частоты исходящих запросов по алгоритму token bucket.
+// HostRate - сколько запросов в секунду можно отправлять одному хосту
+// HostBurst - сколько запросов к хосту можно отправить разом, если до этого к нему долго не обращались
+// GlobalRate, GlobalBurst - то же для всех хостов вместе
+// Нулевая (или отрицательная) частота - без ограничения; незаданный запас - частота, округлённая вверх, но не меньше 1.
+type RateLimit struct {
+	HostRate    float64
+	HostBurst   int
+	GlobalRate  float64
+	GlobalBurst int
+}
+
+// withDefaults подставляет запас по умолчанию для заданных частот.
+func (limit RateLimit) withDefaults() RateLimit {
+	if limit.HostRate > 0 && limit.HostBurst <= 0 {
+		limit.HostBurst = max(1, int(math.Ceil(limit.HostRate)))
+	}
+	if limit.GlobalRate > 0 && limit.GlobalBurst <= 0 {
+		limit.GlobalBurst = max(1, int(math.Ceil(limit.GlobalRate)))
+	}
+
+	return limit
+}
+
+// tokenBucket - ведро токенов: пополняется со скоростью rate токенов в секунду до burst,
+// каждый запрос забирает один токен. Не безопасно для конкурентного использования.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// reserve забирает токен и возвращает, сколько нужно подождать, пока он станет доступен
+// (токены можно занимать вперёд, тогда следующие запросы ждут дольше).
+func (bucket *tokenBucket) reserve(now time.Time) time.Duration {
+	bucket.refill(now)
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+// refill пополняет ведро за время, прошедшее с прошлого обращения.
+func (bucket *tokenBucket) refill(now time.Time) {
+	if now.After(bucket.last) {
+		bucket.tokens = min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+		bucket.last = now
+	}
+}
+
+// rateLimiter ограничивает частоту запросов к каждому хосту (hosts) и ко всем хостам вместе (global).
+type rateLimiter struct {
+	mutex  sync.Mutex
+	limit  RateLimit
+	global *tokenBucket
+	hosts  map[string]*tokenBucket
+}
+
+// newRateLimiter создаёт ограничитель или возвращает nil, если limit ничего не ограничивает.
+// Запас токенов в limit должен быть уже заполнен (см. RateLimit.withDefaults).
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.HostRate <= 0 && limit.GlobalRate <= 0 {
+		return nil
+	}
+
+	limiter := &rateLimiter{limit: limit, hosts: make(map[string]*tokenBucket)}
+	if limit.GlobalRate > 0 {
+		limiter.global = newTokenBucket(limit.GlobalRate, limit.GlobalBurst, time.Now())
+	}
+
+	return limiter
+}
+
+// wait дожидается, пока запрос к host уложится во все лимиты, или отмены ctx.
+// Возвращает, сколько пришлось ждать, и ошибку ctx, если ожидание прервано.
+func (limiter *rateLimiter) wait(ctx context.Context, host string) (time.Duration, error) {
+	limiter.mutex.Lock()
+	now := time.Now()
+	var delay time.Duration
+	var reserved []*tokenBucket
+	if limiter.global != nil {
+		delay = max(delay, limiter.global.reserve(now))
+		reserved = append(reserved, limiter.global)
+	}
+	if limiter.limit.HostRate > 0 {
+		bucket := limiter.hostBucket(strings.ToLower(host), now)
+		delay = max(delay, bucket.reserve(now))
+		reserved = append(reserved, bucket)
+	}
+	limiter.mutex.Unlock()
+
+	if delay == 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		// запрос не будет отправлен, поэтому занятые токены возвращаются
+		limiter.mutex.Lock()
+		for _, bucket := range reserved {
+			bucket.tokens = min(bucket.burst, bucket.tokens+1)
+		}
+		limiter.mutex.Unlock()
+		return 0, ctx.Err()
+	}
+}
+
+// hostBucket возвращает ведро хоста, создавая его при первом обращении.
+// Если хостов слишком много, забываются те, чьё ведро уже полное: для них новое ведро ничего не меняет.
+// Вызывается под limiter.mutex.
+func (limiter *rateLimiter) hostBucket(host string, now time.Time) *tokenBucket {
+	if bucket, ok := limiter.hosts[host]; ok {
+		return bucket
+	}
+
+	if len(limiter.hosts) >= maxHostBuckets {
+		for name, bucket := range limiter.hosts {
+			bucket.refill(now)
+			if bucket.tokens >= bucket.burst {
+				delete(limiter.hosts, name)
+			}
+		}
+	}
+
+	bucket := newTokenBucket(limiter.limit.HostRate, limiter.limit.HostBurst, now)
+	limiter.hosts[host] = bucket
+
+	return bucket
+}
+
+// limitedTransport - http.RoundTripper, который перед каждым запросом (в том числе перенаправлением)
+// дожидается ограничителя частоты limiter (nil - без ограничений) и учитывает запрос в outboundMetrics.
+type limitedTransport struct {
+	next    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (transport *limitedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if transport.limiter != nil {
+		waited, err := transport.limiter.wait(request.Context(), request.URL.Hostname())
+		if err != nil {
+			// RoundTrip должен закрыть тело запроса, даже если запрос не отправлен
+			if request.Body != nil {
+				request.Body.Close()
+			}
+			return nil, err
+		}
+		if waited > 0 {
+			outboundMetrics.Add("throttled", 1)
+			outboundMetrics.AddFloat("throttle_wait_seconds", waited.Seconds())
+		}
+	}
+	outboundMetrics.Add("requests", 1)
+
+	return transport.next.RoundTrip(request)
+}
+
+// publishLimits показывает в outboundMetrics действующие лимиты исходящих запросов
+// (0 - без ограничения).
+func publishLimits(options DownloaderOptions) {
+	limits := map[string]float64{
+		"limit_max_conns_per_host":      float64(max(options.MaxConnsPerHost, 0)),
+		"limit_max_idle_conns_per_host": float64(options.MaxIdleConnsPerHost),
+		"limit_host_rate":               max(options.RateLimit.HostRate, 0),
+		"limit_host_burst":              float64(max(options.RateLimit.HostBurst, 0)),
+		"limit_global_rate":             max(options.RateLimit.GlobalRate, 0),
+		"limit_global_burst":            float64(max(options.RateLimit.GlobalBurst, 0)),
+	}
+	for name, value := range limits {
+		metric := new(expvar.Float)
+		metric.Set(value)
+		outboundMetrics.Set(name, metric)
+	}
+}
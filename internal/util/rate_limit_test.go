@@ -0,0 +1,85 @@
+package util
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2025, 7, 17, 12, 0, 0, 0, time.UTC)
+	bucket := newTokenBucket(2, 2, now)
+
+	assert.Zero(t, bucket.reserve(now), "запас позволяет отправить burst запросов разом")
+	assert.Zero(t, bucket.reserve(now))
+	assert.Equal(t, 500*time.Millisecond, bucket.reserve(now), "сверх запаса - по токену раз в 1/rate секунды")
+	assert.Equal(t, time.Second, bucket.reserve(now), "занятые вперёд токены увеличивают ожидание следующих")
+
+	assert.Zero(t, bucket.reserve(now.Add(2*time.Second)), "за время ожидания ведро пополняется")
+	bucket.refill(now.Add(time.Hour))
+	assert.Equal(t, 2.0, bucket.tokens, "ведро пополняется не больше чем до burst")
+
+	assert.Equal(t, RateLimit{HostRate: 0.5, HostBurst: 1, GlobalRate: 7.5, GlobalBurst: 8}, RateLimit{HostRate: 0.5, GlobalRate: 7.5}.withDefaults())
+}
+
+func TestRateLimiter_Wait(t *testing.T) {
+	assert.Nil(t, newRateLimiter(RateLimit{}), "без лимитов ограничитель не нужен")
+
+	limiter := newRateLimiter(RateLimit{HostRate: 10, HostBurst: 1, GlobalRate: 1000, GlobalBurst: 3}.withDefaults())
+	waited, err := limiter.wait(context.Background(), "cdn.example.com")
+	assert.NoError(t, err)
+	assert.Zero(t, waited)
+	waited, err = limiter.wait(context.Background(), "CDN.example.com")
+	assert.NoError(t, err)
+	assert.Greater(t, waited, 50*time.Millisecond, "второй запрос к тому же хосту ждёт токена")
+	waited, err = limiter.wait(context.Background(), "files.example.com")
+	assert.NoError(t, err)
+	assert.Zero(t, waited, "у другого хоста своё ведро")
+
+	limiter = newRateLimiter(RateLimit{GlobalRate: 0.001, GlobalBurst: 1})
+	_, err = limiter.wait(context.Background(), "a.example.com")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = limiter.wait(ctx, "b.example.com")
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "общий лимит действует на все хосты, ожидание прерывается отменой ctx")
+	assert.InDelta(t, 0, limiter.global.tokens, 0.01, "токен прерванного ожидания возвращается")
+}
+
+func TestDownload_MaxConnsPerHost(t *testing.T) {
+	var active, maxActive atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		current := active.Add(1)
+		defer active.Add(-1)
+		for {
+			observed := maxActive.Load()
+			if current <= observed || maxActive.CompareAndSwap(observed, current) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		io.WriteString(writer, "%PDF-1.7 содержимое")
+	}))
+	defer server.Close()
+
+	downloader := newTestDownloader(t, DownloaderOptions{MaxConnsPerHost: 1})
+	var wait sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			_, err := downloader.Download(context.Background(), DownloadRequest{URL: server.URL, SpoolDir: t.TempDir()})
+			assert.NoError(t, err)
+		}()
+	}
+	wait.Wait()
+
+	assert.Equal(t, int32(1), maxActive.Load(), "к одному хосту не больше MaxConnsPerHost соединений одновременно")
+	assert.Equal(t, "1", outboundMetrics.Get("limit_max_conns_per_host").String(), "лимиты видны в метриках")
+}
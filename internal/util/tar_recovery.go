@@ -0,0 +1,140 @@
+package util
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+)
+
+// tarEntries - количество целых файлов в начале недописанного tar-архива формата format.
+type tarEntries struct {
+	format ArchiveFormat
+	count  int
+}
+
+// scanTarEntries считает целые файлы tar-архива (в том числе сжатого), идущие подряд с его начала.
+// Файл считается целым, если прочитаны его заголовок и все Size байт содержимого; у сжатого архива
+// целыми могут быть только файлы, сброшенные в поток до падения (см. AddSpoolToArchive).
+func scanTarEntries(archiveFilePath string, format ArchiveFormat) (tarEntries, error) {
+	entries := tarEntries{format: format}
+
+	err := readTarEntries(archiveFilePath, format, func(header *tar.Header, content io.Reader) error {
+		if _, err := io.Copy(io.Discard, content); err != nil {
+			return err
+		}
+		entries.count++
+		return nil
+	})
+	if err != nil {
+		return tarEntries{}, err
+	}
+
+	return entries, nil
+}
+
+// copyTo переносит целые файлы из повреждённого архива в новый.
+func (entries tarEntries) copyTo(brokenPath string, archiveWriter ArchiveWriter) ([]string, error) {
+	names := make([]string, 0, entries.count)
+
+	err := readTarEntries(brokenPath, entries.format, func(header *tar.Header, content io.Reader) error {
+		if len(names) == entries.count {
+			return io.EOF
+		}
+		if err := archiveWriter.AddFile(header.Name, header.Size, header.ModTime, content); err != nil {
+			return err
+		}
+		names = append(names, header.Name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(names) != entries.count {
+		return nil, fmt.Errorf("прочитано %d файлов из %d", len(names), entries.count)
+	}
+
+	return names, nil
+}
+
+// readTarEntries вызывает handle для каждого обычного файла tar-архива по порядку.
+// Чтение останавливается без ошибки на первой оборванной или повреждённой записи,
+// а также если handle вернул io.EOF. Другие ошибки handle возвращаются как есть.
+func readTarEntries(archiveFilePath string, format ArchiveFormat, handle func(*tar.Header, io.Reader) error) error {
+	file, err := os.Open(archiveFilePath)
+	if err != nil {
+		return fmt.Errorf("ошибка открытия архива: %w", err)
+	}
+	defer file.Close()
+
+	decompressed, err := newDecompressor(format, bufio.NewReader(file))
+	if errors.Is(err, ErrUnsupportedArchiveFormat) {
+		return err
+	}
+	if err != nil {
+		// архив оборвался до конца заголовка сжатого потока, целых файлов в нём нет
+		return nil
+	}
+	defer decompressed.Close()
+
+	reader := tar.NewReader(decompressed)
+	for {
+		header, err := reader.Next()
+		if err != nil {
+			// io.EOF - конец архива, остальное - оборванная запись: всё, что после неё, считается потерянным
+			return nil
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content := &trackingReader{reader: reader}
+		err = handle(header, content)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && content.err != nil {
+			// ошибка чтения повреждённого архива, а не записи в новый
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// newDecompressor возвращает поток распакованных данных tar-архива формата format.
+func newDecompressor(format ArchiveFormat, reader io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case FormatTar:
+		return io.NopCloser(reader), nil
+	case FormatTarGz:
+		return gzip.NewReader(reader)
+	case FormatTarZst:
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedArchiveFormat, format)
+	}
+}
+
+// trackingReader запоминает ошибку чтения, чтобы отличать повреждение архива от ошибок записи.
+type trackingReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (reader *trackingReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	if err != nil && err != io.EOF {
+		reader.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,105 @@
+package util
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// UploadRequest - куда и с какими проверками сохранять файл, загруженный клиентом в теле запроса.
+// SpoolDir - каталог временных файлов (пустой - системный каталог временных файлов)
+// AllowedMIMETypes - допустимые типы файла, определённые по содержимому (пустой список - любой тип)
+// Quota - где резервировать место под файл (nil - без ограничений)
+// ContentType - тип, объявленный клиентом (заголовок Content-Type тела или части multipart)
+// Size - размер файла, если клиент сообщил его заранее (Content-Length), иначе -1
+type UploadRequest struct {
+	SpoolDir         string
+	AllowedMIMETypes []string
+	Quota            Quota
+	ContentType      string
+	Size             int64
+}
+
+// SpoolUpload сохраняет файл, который клиент загружает в теле запроса (reader), во временный файл
+// с теми же проверками, что и Download: тип файла определяется по первым байтам содержимого и ContentType
+// (см. DetectContentType) и проверяется по request.AllowedMIMETypes, место под каждую порцию содержимого
+// резервируется в request.Quota до её записи, попутно считается SHA-256. Содержимое читается потоком
+// и целиком в памяти не держится.
+//
+// Чтение прерывается при отмене ctx (очередной порцией, поэтому заблокированное чтение reader
+// должен прервать вызывающий код, например закрыв соединение).
+// Если сохранить файл не удалось, временный файл удаляется. Освобождать зарезервированное место
+// при ошибке должен вызывающий код.
+func SpoolUpload(ctx context.Context, reader io.Reader, request UploadRequest) (_ SpooledFile, err error) {
+	state := &spool{hash: sha256.New()}
+	if err := state.reset(request.SpoolDir, request.Quota); err != nil {
+		return SpooledFile{}, err
+	}
+	defer func() {
+		if err != nil {
+			state.file.Close()
+			os.Remove(state.file.Name())
+		}
+	}()
+
+	if err := state.output.reserveUpTo(request.Size); err != nil {
+		return SpooledFile{}, fmt.Errorf("файл размером %d байт: %w", request.Size, err)
+	}
+
+	body := &contextReader{ctx: ctx, reader: reader}
+	buffered := bufio.NewReaderSize(body, sniffLength)
+	head, err := buffered.Peek(sniffLength)
+	if err != nil && errors.Is(err, io.EOF) == false {
+		return SpooledFile{}, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	state.contentType = DetectContentType(head, request.ContentType)
+	if err := checkMIMEType(state.contentType, request.AllowedMIMETypes); err != nil {
+		return SpooledFile{}, err
+	}
+
+	if _, err := io.Copy(io.MultiWriter(state.output, state.hash), buffered); err != nil {
+		if body.err != nil {
+			return SpooledFile{}, fmt.Errorf("ошибка чтения файла: %w", body.err)
+		}
+		return SpooledFile{}, fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+	if err := state.file.Close(); err != nil {
+		return SpooledFile{}, fmt.Errorf("ошибка сохранения файла: %w", err)
+	}
+
+	return SpooledFile{
+		Path:         state.file.Name(),
+		Size:         state.output.written,
+		ContentType:  state.contentType,
+		SHA256:       hex.EncodeToString(state.hash.Sum(nil)),
+		DownloadedAt: time.Now(),
+	}, nil
+}
+
+// contextReader прекращает чтение reader после отмены ctx и запоминает ошибку чтения (в отличие от ошибки
+// записи), чтобы SpoolUpload мог их различить.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+	err    error
+}
+
+func (reader *contextReader) Read(data []byte) (int, error) {
+	if err := reader.ctx.Err(); err != nil {
+		reader.err = err
+		return 0, err
+	}
+
+	n, err := reader.reader.Read(data)
+	if err != nil && errors.Is(err, io.EOF) == false {
+		reader.err = err
+	}
+
+	return n, err
+}
@@ -0,0 +1,216 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// ErrURLForbidden возвращается, если адрес файла (или адрес, на который перенаправил сервер)
+// запрещён политикой исходящих запросов (см. URLPolicy).
+var ErrURLForbidden = errors.New("адрес запрещён политикой исходящих запросов")
+
+// defaultMaxRedirects - сколько перенаправлений разрешено по умолчанию.
+const defaultMaxRedirects = 5
+
+// defaultSchemes - схемы адресов, разрешённые по умолчанию.
+var defaultSchemes = []string{"http", "https"}
+
+// reservedNetworks - диапазоны, которые не покрываются методами netip.Addr (IsPrivate, IsLoopback и т.д.),
+// но тоже не должны быть доступны по ссылке клиента: "этот" сеть, CGNAT, служебные и зарезервированные диапазоны,
+// NAT64 (через него можно обратиться к внутреннему IPv4-адресу).
+var reservedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// URLPolicy - политика исходящих запросов за файлами, защищающая от SSRF
+// (обращений по ссылке клиента к внутренним адресам сервера, например http://169.254.169.254/).
+// AllowedSchemes - допустимые схемы адресов, по умолчанию http и https
+// AllowedHosts - если список не пуст, файлы скачиваются только с этих хостов
+// DeniedHosts - хосты, с которых файлы не скачиваются, даже если они есть в AllowedHosts
+// AllowedNetworks - диапазоны (CIDR, например "10.1.2.0/24"), доступные несмотря на запрет внутренних адресов
+// MaxRedirects - максимальное количество перенаправлений, по умолчанию 5, отрицательное значение запрещает их
+//
+// Хост в списках - имя или IP-адрес без порта; "*.example.com" соответствует всем поддоменам example.com.
+// Внутренние адреса (loopback, частные сети, link-local, в том числе облачные метаданные 169.254.169.254,
+// multicast и зарезервированные диапазоны) запрещены всегда, кроме AllowedNetworks.
+type URLPolicy struct {
+	AllowedSchemes  []string
+	AllowedHosts    []string
+	DeniedHosts     []string
+	AllowedNetworks []string
+	MaxRedirects    int
+}
+
+// urlGuard - проверенная и готовая к использованию URLPolicy.
+type urlGuard struct {
+	schemes         []string
+	allowedHosts    []string
+	deniedHosts     []string
+	allowedNetworks []netip.Prefix
+	maxRedirects    int
+	resolver        *net.Resolver
+}
+
+// newURLGuard разбирает policy и подставляет значения по умолчанию.
+// Возвращает ошибку, если в AllowedNetworks есть некорректный диапазон.
+func newURLGuard(policy URLPolicy) (*urlGuard, error) {
+	guard := &urlGuard{
+		schemes:      lowerAll(policy.AllowedSchemes),
+		allowedHosts: lowerAll(policy.AllowedHosts),
+		deniedHosts:  lowerAll(policy.DeniedHosts),
+		maxRedirects: policy.MaxRedirects,
+		resolver:     net.DefaultResolver,
+	}
+	if len(guard.schemes) == 0 {
+		guard.schemes = defaultSchemes
+	}
+	if guard.maxRedirects == 0 {
+		guard.maxRedirects = defaultMaxRedirects
+	}
+
+	for _, network := range policy.AllowedNetworks {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(network))
+		if err != nil {
+			return nil, fmt.Errorf("некорректный диапазон адресов %q: %w", network, err)
+		}
+		guard.allowedNetworks = append(guard.allowedNetworks, prefix.Masked())
+	}
+
+	return guard, nil
+}
+
+// checkURL проверяет схему и хост адреса, а если хост задан IP-адресом - и сам адрес.
+// Имена хостов не разрешаются: адрес, в который разрешилось имя, проверяется при установке
+// соединения (см. control), поэтому подмена DNS-ответа между проверкой и запросом ничего не даёт.
+func (guard *urlGuard) checkURL(target *url.URL) error {
+	scheme := strings.ToLower(target.Scheme)
+	if slices.Contains(guard.schemes, scheme) == false {
+		return fmt.Errorf("%w: схема %q, допустимые: %s", ErrURLForbidden, target.Scheme, strings.Join(guard.schemes, ", "))
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(target.Hostname(), "."))
+	if host == "" {
+		return fmt.Errorf("%w: в адресе нет хоста", ErrURLForbidden)
+	}
+	if matchHost(guard.deniedHosts, host) {
+		return fmt.Errorf("%w: хост %s запрещён", ErrURLForbidden, host)
+	}
+	if len(guard.allowedHosts) > 0 && matchHost(guard.allowedHosts, host) == false {
+		return fmt.Errorf("%w: хост %s не входит в список разрешённых", ErrURLForbidden, host)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return guard.checkAddr(addr)
+	}
+
+	return nil
+}
+
+// checkResolved проверяет адрес так же, как checkURL, а кроме того разрешает имя хоста и проверяет
+// все полученные IP-адреса. Нужна, чтобы отклонить адрес вроде http://localhost/ сразу, не дожидаясь скачивания;
+// если имя разрешить не удалось, адрес не отклоняется (он будет проверен ещё раз при соединении).
+func (guard *urlGuard) checkResolved(ctx context.Context, target *url.URL) error {
+	if err := guard.checkURL(target); err != nil {
+		return err
+	}
+
+	host := target.Hostname()
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil
+	}
+	addrs, err := guard.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := guard.checkAddr(addr); err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+	}
+
+	return nil
+}
+
+// checkAddr проверяет, что addr - публичный адрес или входит в allowedNetworks.
+func (guard *urlGuard) checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	for _, network := range guard.allowedNetworks {
+		if network.Contains(addr) {
+			return nil
+		}
+	}
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return fmt.Errorf("%w: внутренний адрес %s", ErrURLForbidden, addr)
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(addr) {
+			return fmt.Errorf("%w: зарезервированный адрес %s", ErrURLForbidden, addr)
+		}
+	}
+
+	return nil
+}
+
+// control - net.Dialer.Control: проверяет IP-адрес, с которым устанавливается соединение,
+// уже после разрешения имени хоста и до отправки первого байта.
+func (guard *urlGuard) control(_ string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: некорректный адрес соединения %s", ErrURLForbidden, address)
+	}
+
+	return guard.checkAddr(addrPort.Addr())
+}
+
+// checkRedirect - http.Client.CheckRedirect: ограничивает количество перенаправлений
+// и проверяет адрес каждого из них (IP-адрес проверится при соединении, см. control).
+func (guard *urlGuard) checkRedirect(request *http.Request, via []*http.Request) error {
+	if len(via) > guard.maxRedirects {
+		return fmt.Errorf("%w: больше %d перенаправлений", ErrURLForbidden, max(guard.maxRedirects, 0))
+	}
+
+	return guard.checkURL(request.URL)
+}
+
+// matchHost сообщает, соответствует ли host одному из шаблонов patterns (имя или "*.домен").
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if domain, found := strings.CutPrefix(pattern, "*."); found {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lowerAll возвращает значения в нижнем регистре без пробелов по краям и точки в конце имени хоста.
+func lowerAll(values []string) []string {
+	lowered := make([]string, 0, len(values))
+	for _, value := range values {
+		lowered = append(lowered, strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), "."))
+	}
+
+	return lowered
+}
@@ -0,0 +1,102 @@
+package util
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+func TestURLPolicy_CheckURL(t *testing.T) {
+	downloader, err := NewDownloader(DownloaderOptions{URLPolicy: URLPolicy{
+		DeniedHosts:     []string{"evil.example.com", "*.internal.example.com"},
+		AllowedNetworks: []string{"10.1.2.0/24"},
+	}})
+	assert.NoError(t, err)
+
+	forbidden := []struct {
+		name string
+		url  string
+	}{
+		{"схема ftp", "ftp://example.com/file.pdf"},
+		{"схема file", "file:///etc/passwd"},
+		{"метаданные облака", "http://169.254.169.254/latest/meta-data/"},
+		{"loopback", "http://127.0.0.1:8080/api-tasks/get"},
+		{"loopback IPv6", "http://[::1]/file.pdf"},
+		{"IPv4 внутри IPv6", "http://[::ffff:127.0.0.1]/file.pdf"},
+		{"частная сеть", "http://192.168.1.10/file.pdf"},
+		{"частная сеть вне разрешённого диапазона", "http://10.1.3.1/file.pdf"},
+		{"CGNAT", "http://100.64.0.1/file.pdf"},
+		{"неуказанный адрес", "http://0.0.0.0/file.pdf"},
+		{"имя, разрешающееся в loopback", "http://localhost/file.pdf"},
+		{"запрещённый хост", "https://EVIL.example.com./file.pdf"},
+		{"поддомен запрещённого домена", "https://files.internal.example.com/file.pdf"},
+	}
+	for _, test := range forbidden {
+		assert.ErrorIs(t, downloader.CheckURL(context.Background(), test.url), ErrURLForbidden, test.name)
+	}
+
+	assert.NoError(t, downloader.CheckURL(context.Background(), "http://10.1.2.3/file.pdf"), "разрешённый диапазон")
+	assert.NoError(t, downloader.CheckURL(context.Background(), "https://203.0.113.7/file.pdf"))
+
+	downloader, err = NewDownloader(DownloaderOptions{URLPolicy: URLPolicy{AllowedHosts: []string{"*.example.com"}}})
+	assert.NoError(t, err)
+	assert.NoError(t, downloader.CheckURL(context.Background(), "https://203.0.113.7.example.com/file.pdf"))
+	assert.ErrorIs(t, downloader.CheckURL(context.Background(), "https://example.org/file.pdf"), ErrURLForbidden,
+		"хост не из списка разрешённых")
+
+	_, err = NewDownloader(DownloaderOptions{URLPolicy: URLPolicy{AllowedNetworks: []string{"10.0.0.0/33"}}})
+	assert.Error(t, err, "некорректный диапазон - ошибка создания")
+}
+
+func TestDownload_ChecksRedirects(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests.Add(1)
+		switch request.URL.Path {
+		case "/metadata":
+			http.Redirect(writer, request, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+		case "/localhost":
+			serverURL, _ := url.Parse("http://" + request.Host)
+			http.Redirect(writer, request, "http://localhost:"+serverURL.Port()+"/file.pdf", http.StatusFound)
+		case "/loop":
+			http.Redirect(writer, request, "/loop", http.StatusFound)
+		default:
+			writer.Write([]byte("%PDF-1.7 содержимое"))
+		}
+	}))
+	defer server.Close()
+
+	downloader := newTestDownloader(t, DownloaderOptions{
+		MaxAttempts: 3,
+		URLPolicy:   URLPolicy{DeniedHosts: []string{"localhost"}, MaxRedirects: 2},
+	})
+	spoolDir := t.TempDir()
+	for _, path := range []string{"/metadata", "/localhost", "/loop"} {
+		requests.Store(0)
+		_, err := downloader.Download(context.Background(), DownloadRequest{URL: server.URL + path, SpoolDir: spoolDir})
+		assert.ErrorIs(t, err, ErrURLForbidden, path)
+		assert.NotContains(t, err.Error(), "попыток", "нарушение политики не должно повторяться")
+		if path == "/loop" {
+			assert.Equal(t, int32(3), requests.Load(), "разрешено не больше MaxRedirects перенаправлений")
+		} else {
+			assert.Equal(t, int32(1), requests.Load(), "по запрещённому перенаправлению запрос не отправляется")
+		}
+	}
+	entries, err := os.ReadDir(spoolDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// имя хоста разрешается в 127.0.0.1 уже при соединении, а без AllowedNetworks loopback запрещён
+	serverURL, _ := url.Parse(server.URL)
+	requests.Store(0)
+	downloader, err = NewDownloader(DownloaderOptions{})
+	assert.NoError(t, err)
+	_, err = downloader.Download(context.Background(), DownloadRequest{URL: "http://localhost:" + serverURL.Port() + "/file.pdf", SpoolDir: spoolDir})
+	assert.ErrorIs(t, err, ErrURLForbidden, "адрес проверяется после разрешения имени хоста")
+	assert.Zero(t, requests.Load())
+}
@@ -0,0 +1,216 @@
+package util
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+// Параметры шифрования WinZip AES (https://www.winzip.com/en/support/aes-encryption/).
+const (
+	// winZipAESMethod - метод сжатия записи, зашифрованной WinZip AES; настоящий метод хранится в дополнительном поле.
+	winZipAESMethod = 99
+	// winZipAESExtraID - идентификатор дополнительного поля WinZip AES.
+	winZipAESExtraID = 0x9901
+	// winZipAESVersion - AE-2: CRC32 записи не сохраняется, целостность проверяется только кодом аутентификации.
+	winZipAESVersion = 2
+	// winZipAESStrength - 3 означает AES-256.
+	winZipAESStrength = 3
+	// winZipAESVersionNeeded - версия ZIP, необходимая для распаковки записи (5.1).
+	winZipAESVersionNeeded = 51
+
+	winZipAESKeySize    = 32
+	winZipAESSaltSize   = 16
+	winZipAESIterations = 1000
+	winZipAESVerifySize = 2
+	winZipAESAuthSize   = 10
+)
+
+// Флаги записи ZIP.
+const (
+	zipFlagEncrypted      = 0x1
+	zipFlagDataDescriptor = 0x8
+	zipFlagUTF8           = 0x800
+)
+
+// winZipAESExtra - дополнительное поле WinZip AES: версия AE-2, производитель "AE", AES-256, метод Deflate.
+var winZipAESExtra = []byte{
+	winZipAESExtraID & 0xff, winZipAESExtraID >> 8, 7, 0,
+	winZipAESVersion, 0, 'A', 'E', winZipAESStrength, byte(zip.Deflate), 0,
+}
+
+// addEncryptedFile добавляет в архив файл, сжатый Deflate и зашифрованный WinZip AES-256 паролем writer.password.
+//
+// Данные записи: соль, 2 байта проверки пароля, зашифрованное AES-CTR содержимое
+// и 10 байт HMAC-SHA1 зашифрованного содержимого. Ключи шифрования и HMAC выводятся из пароля
+// и случайной соли записи через PBKDF2-HMAC-SHA1, поэтому у каждой записи они свои.
+func (writer *zipArchiveWriter) addEncryptedFile(name string, size int64, modTime time.Time, content io.Reader) error {
+	salt := make([]byte, winZipAESSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("ошибка генерации соли: %w", err)
+	}
+	keys, err := pbkdf2.Key(sha1.New, writer.password, salt, winZipAESIterations,
+		2*winZipAESKeySize+winZipAESVerifySize)
+	if err != nil {
+		return fmt.Errorf("ошибка вывода ключа шифрования: %w", err)
+	}
+	encryptionKey, authKey, verifier := keys[:winZipAESKeySize], keys[winZipAESKeySize:2*winZipAESKeySize],
+		keys[2*winZipAESKeySize:]
+
+	modDate, modClock := dosDateTime(modTime)
+	header := &zip.FileHeader{
+		Name:               name,
+		CreatorVersion:     winZipAESVersionNeeded,
+		ReaderVersion:      winZipAESVersionNeeded,
+		Flags:              zipFlagEncrypted | zipFlagDataDescriptor,
+		Method:             winZipAESMethod,
+		ModifiedTime:       modClock,
+		ModifiedDate:       modDate,
+		UncompressedSize64: uint64(size),
+		Extra:              slices.Clone(winZipAESExtra),
+	}
+	if utf8.ValidString(name) && isASCII(name) == false {
+		header.Flags |= zipFlagUTF8
+	}
+	// размер сжатых данных заранее неизвестен, поэтому записывается после них в дескрипторе данных
+	entry, err := writer.CreateRaw(header)
+	if err != nil {
+		return fmt.Errorf("ошибка создания файла в zip архиве: %w", err)
+	}
+
+	output := &countingWriter{writer: entry}
+	if _, err := output.Write(salt); err != nil {
+		return fmt.Errorf("ошибка записи в zip архив: %w", err)
+	}
+	if _, err := output.Write(verifier); err != nil {
+		return fmt.Errorf("ошибка записи в zip архив: %w", err)
+	}
+
+	encryptor, err := newWinZipAESWriter(output, encryptionKey, authKey)
+	if err != nil {
+		return err
+	}
+	compressor, err := flate.NewWriter(encryptor, writer.level)
+	if err != nil {
+		return fmt.Errorf("ошибка создания deflate: %w", err)
+	}
+	if _, err := io.Copy(compressor, content); err != nil {
+		return fmt.Errorf("ошибка копирования данных в zip архив: %w", err)
+	}
+	if err := compressor.Close(); err != nil {
+		return fmt.Errorf("ошибка копирования данных в zip архив: %w", err)
+	}
+	if _, err := output.Write(encryptor.authCode()); err != nil {
+		return fmt.Errorf("ошибка записи в zip архив: %w", err)
+	}
+
+	// zip.Writer читает размеры из header, когда дописывает дескриптор данных и центральный каталог
+	header.CompressedSize64 = uint64(output.count)
+	header.CompressedSize = uint32(min(header.CompressedSize64, 1<<32-1))
+	header.UncompressedSize = uint32(min(header.UncompressedSize64, 1<<32-1))
+
+	return nil
+}
+
+// winZipAESWriter шифрует данные AES-CTR в варианте WinZip (счётчик little-endian, начиная с 1)
+// и считает HMAC-SHA1 зашифрованных данных.
+type winZipAESWriter struct {
+	output    io.Writer
+	block     cipher.Block
+	counter   [aes.BlockSize]byte
+	keyStream [aes.BlockSize]byte
+	used      int
+	mac       hash.Hash
+	buffer    []byte
+}
+
+func newWinZipAESWriter(output io.Writer, encryptionKey []byte, authKey []byte) (*winZipAESWriter, error) {
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания шифра: %w", err)
+	}
+
+	return &winZipAESWriter{
+		output: output,
+		block:  block,
+		used:   aes.BlockSize,
+		mac:    hmac.New(sha1.New, authKey),
+	}, nil
+}
+
+func (writer *winZipAESWriter) Write(data []byte) (int, error) {
+	writer.buffer = append(writer.buffer[:0], data...)
+	for i := range writer.buffer {
+		if writer.used == aes.BlockSize {
+			// счётчик - 128-битное little-endian число, первый блок шифруется со значением 1
+			for j := range writer.counter {
+				writer.counter[j]++
+				if writer.counter[j] != 0 {
+					break
+				}
+			}
+			writer.block.Encrypt(writer.keyStream[:], writer.counter[:])
+			writer.used = 0
+		}
+		writer.buffer[i] ^= writer.keyStream[writer.used]
+		writer.used++
+	}
+	writer.mac.Write(writer.buffer)
+
+	if _, err := writer.output.Write(writer.buffer); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// authCode возвращает код аутентификации записи - первые 10 байт HMAC-SHA1 зашифрованных данных.
+func (writer *winZipAESWriter) authCode() []byte {
+	return writer.mac.Sum(nil)[:winZipAESAuthSize]
+}
+
+// countingWriter считает записанные байты.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (writer *countingWriter) Write(data []byte) (int, error) {
+	written, err := writer.writer.Write(data)
+	writer.count += int64(written)
+	return written, err
+}
+
+// dosDateTime переводит время в формат MS-DOS, в котором оно хранится в заголовках ZIP.
+func dosDateTime(value time.Time) (uint16, uint16) {
+	if value.Year() < 1980 {
+		value = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	date := uint16(value.Day() + int(value.Month())<<5 + (value.Year()-1980)<<9)
+	clock := uint16(value.Second()/2 + value.Minute()<<5 + value.Hour()<<11)
+
+	return date, clock
+}
+
+// isASCII проверяет, что строка состоит только из символов ASCII.
+func isASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,145 @@
+package util
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decryptWinZipAES расшифровывает данные записи WinZip AES-256 (соль, проверка пароля,
+// зашифрованное содержимое и код аутентификации) и распаковывает их.
+// Расшифровка написана по спецификации WinZip AES (https://www.winzip.com/en/support/aes-encryption/)
+// независимо от кода шифрования: константы и режим CTR не берутся из zip_aes.go, чтобы ошибка в нём
+// не повторялась при проверке.
+func decryptWinZipAES(data []byte, password string) (string, error) {
+	const (
+		saltSize   = 16
+		verifySize = 2
+		authSize   = 10
+		keySize    = 32
+		iterations = 1000
+	)
+	if len(data) < saltSize+verifySize+authSize {
+		return "", errors.New("запись короче заголовка WinZip AES")
+	}
+	salt := data[:saltSize]
+	verifier := data[saltSize : saltSize+verifySize]
+	encrypted := data[saltSize+verifySize : len(data)-authSize]
+
+	keys, err := pbkdf2.Key(sha1.New, password, salt, iterations, 2*keySize+verifySize)
+	if err != nil {
+		return "", err
+	}
+	encryptionKey, authKey := keys[:keySize], keys[keySize:2*keySize]
+	if bytes.Equal(keys[2*keySize:], verifier) == false {
+		return "", errors.New("неверный пароль")
+	}
+	mac := hmac.New(sha1.New, authKey)
+	mac.Write(encrypted)
+	if bytes.Equal(mac.Sum(nil)[:authSize], data[len(data)-authSize:]) == false {
+		return "", errors.New("код аутентификации не совпадает")
+	}
+
+	// AES-CTR с 16-байтным счётчиком little-endian, который начинается с 1
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	decrypted := make([]byte, len(encrypted))
+	counter := make([]byte, aes.BlockSize)
+	keystream := make([]byte, aes.BlockSize)
+	for offset := 0; offset < len(encrypted); offset += aes.BlockSize {
+		for i := range counter {
+			counter[i]++
+			if counter[i] != 0 {
+				break
+			}
+		}
+		block.Encrypt(keystream, counter)
+		for i := offset; i < len(encrypted) && i < offset+aes.BlockSize; i++ {
+			decrypted[i] = encrypted[i] ^ keystream[i-offset]
+		}
+	}
+
+	content, err := io.ReadAll(flate.NewReader(bytes.NewReader(decrypted)))
+	return string(content), err
+}
+
+// findWinZipAESExtra возвращает поле 0x9901 (AES extra data) из дополнительных полей записи ZIP.
+func findWinZipAESExtra(extra []byte) []byte {
+	for len(extra) >= 4 {
+		id, size := binary.LittleEndian.Uint16(extra), int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return nil
+		}
+		if id == 0x9901 {
+			return extra[4 : 4+size]
+		}
+		extra = extra[4+size:]
+	}
+
+	return nil
+}
+
+func TestArchiveWriter_EncryptedZIP(t *testing.T) {
+	files := []struct{ name, content string }{
+		{"договор.pdf", strings.Repeat("содержимое договора ", 1000)},
+		{"file2.pdf", "короткий"},
+	}
+
+	var output bytes.Buffer
+	archiveWriter, err := NewArchiveWriter(FormatZIP, &output, FormatZIP.DefaultCompressionLevel(), "секрет")
+	assert.NoError(t, err)
+	for _, file := range files {
+		assert.NoError(t, archiveWriter.AddFile(file.name, int64(len(file.content)), time.Now(),
+			strings.NewReader(file.content)))
+		assert.NoError(t, archiveWriter.Flush())
+	}
+	assert.NoError(t, archiveWriter.Close())
+
+	assert.NotContains(t, output.String(), "содержимое договора", "содержимое не должно храниться открыто")
+
+	reader, err := zip.NewReader(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	assert.NoError(t, err, "зашифрованный архив должен оставаться корректным ZIP")
+	assert.Len(t, reader.File, len(files))
+	for i, file := range reader.File {
+		assert.Equal(t, files[i].name, file.Name)
+		assert.Equal(t, uint16(99), file.Method, "метод сжатия записи WinZip AES - 99")
+		// версия AE-2, производитель "AE", AES-256, настоящий метод сжатия - deflate
+		assert.Equal(t, []byte{0x02, 0x00, 'A', 'E', 0x03, 0x08, 0x00}, findWinZipAESExtra(file.Extra))
+		assert.NotZero(t, file.Flags&zipFlagEncrypted, "запись должна быть помечена как зашифрованная")
+		assert.Equal(t, uint64(len(files[i].content)), file.UncompressedSize64)
+
+		raw, err := file.OpenRaw()
+		assert.NoError(t, err)
+		data, err := io.ReadAll(raw)
+		assert.NoError(t, err)
+		assert.Equal(t, file.CompressedSize64, uint64(len(data)), "размер записи в центральном каталоге должен совпадать с данными")
+
+		content, err := decryptWinZipAES(data, "секрет")
+		assert.NoError(t, err)
+		assert.Equal(t, files[i].content, content)
+
+		_, err = decryptWinZipAES(data, "другой пароль")
+		assert.Error(t, err, "с неверным паролем запись не должна расшифровываться")
+	}
+}
+
+func TestArchiveWriter_EncryptionOnlyForZIP(t *testing.T) {
+	for _, format := range []ArchiveFormat{FormatTar, FormatTarGz, FormatTarZst} {
+		_, err := NewArchiveWriter(format, io.Discard, format.DefaultCompressionLevel(), "секрет")
+		assert.ErrorIs(t, err, ErrUnsupportedArchiveFormat, string(format))
+		assert.NoError(t, format.CheckEncryption(""), "без пароля подходит любой формат")
+	}
+}
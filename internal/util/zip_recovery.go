@@ -0,0 +1,229 @@
+package util
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+const (
+	zipLocalHeaderSignature    = 0x04034b50
+	zipCentralHeaderSignature  = 0x02014b50
+	zipDataDescriptorSignature = 0x08074b50
+	zipLocalHeaderLength       = 30
+	zipDataDescriptorFlag      = 0x8
+	zipUint32Max               = 1<<32 - 1
+)
+
+// recoveredEntry - запись архива, которая была полностью записана до падения процесса.
+type recoveredEntry struct {
+	header     zip.FileHeader
+	dataOffset int64
+}
+
+// zipEntries - целые записи недописанного ZIP-архива.
+type zipEntries []recoveredEntry
+
+// scanZIPEntries возвращает все целые записи ZIP-архива, идущие подряд с его начала.
+// Каждая запись проверяется по CRC32 и размерам.
+func scanZIPEntries(archiveFilePath string) (zipEntries, error) {
+	file, err := os.Open(archiveFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия архива: %w", err)
+	}
+	defer file.Close()
+
+	reader := &countingReader{reader: bufio.NewReader(file)}
+	var entries zipEntries
+	for {
+		entry, err := readZIPEntry(reader)
+		if err != nil {
+			// всё, что идёт после первой оборванной записи, считается потерянным
+			return entries, nil
+		}
+		if entry == nil {
+			return entries, nil
+		}
+		entries = append(entries, *entry)
+	}
+}
+
+// readZIPEntry читает одну запись, начиная с локального заголовка, и проверяет её целостность.
+// Возвращает nil без ошибки, если вместо очередной записи начался центральный каталог.
+func readZIPEntry(reader *countingReader) (*recoveredEntry, error) {
+	var buffer [zipLocalHeaderLength]byte
+	if _, err := io.ReadFull(reader, buffer[:4]); err != nil {
+		return nil, err
+	}
+
+	switch binary.LittleEndian.Uint32(buffer[:4]) {
+	case zipLocalHeaderSignature:
+	case zipCentralHeaderSignature:
+		return nil, nil
+	default:
+		return nil, errors.New("неизвестная сигнатура записи")
+	}
+
+	if _, err := io.ReadFull(reader, buffer[4:]); err != nil {
+		return nil, err
+	}
+
+	flags := binary.LittleEndian.Uint16(buffer[6:8])
+	method := binary.LittleEndian.Uint16(buffer[8:10])
+	entry := &recoveredEntry{
+		header: zip.FileHeader{
+			Flags:        flags &^ zipDataDescriptorFlag,
+			Method:       method,
+			ModifiedTime: binary.LittleEndian.Uint16(buffer[10:12]),
+			ModifiedDate: binary.LittleEndian.Uint16(buffer[12:14]),
+		},
+	}
+	crc := binary.LittleEndian.Uint32(buffer[14:18])
+	compressedSize := uint64(binary.LittleEndian.Uint32(buffer[18:22]))
+	uncompressedSize := uint64(binary.LittleEndian.Uint32(buffer[22:26]))
+	nameLength := int(binary.LittleEndian.Uint16(buffer[26:28]))
+	extraLength := int64(binary.LittleEndian.Uint16(buffer[28:30]))
+
+	name := make([]byte, nameLength)
+	if _, err := io.ReadFull(reader, name); err != nil {
+		return nil, err
+	}
+	entry.header.Name = string(name)
+	if _, err := io.CopyN(io.Discard, reader, extraLength); err != nil {
+		return nil, err
+	}
+	entry.dataOffset = reader.count
+
+	hasDescriptor := flags&zipDataDescriptorFlag != 0
+	hasher := crc32.NewIEEE()
+
+	switch {
+	case method == zip.Deflate:
+		// flate сам определяет конец сжатого потока и, так как reader реализует io.ByteReader,
+		// не читает ничего сверх него
+		decompressor := flate.NewReader(reader)
+		uncompressed, err := io.Copy(hasher, decompressor)
+		if err != nil {
+			return nil, err
+		}
+		entry.header.UncompressedSize64 = uint64(uncompressed)
+		entry.header.CompressedSize64 = uint64(reader.count - entry.dataOffset)
+	case method == zip.Store && hasDescriptor == false:
+		if _, err := io.CopyN(hasher, reader, int64(compressedSize)); err != nil {
+			return nil, err
+		}
+		entry.header.UncompressedSize64 = compressedSize
+		entry.header.CompressedSize64 = compressedSize
+	default:
+		return nil, fmt.Errorf("неподдерживаемый способ сжатия записи: %d", method)
+	}
+
+	if hasDescriptor {
+		descriptorCRC, descriptorCompressed, descriptorUncompressed, err := readDataDescriptor(
+			reader, entry.header.CompressedSize64 > zipUint32Max || entry.header.UncompressedSize64 > zipUint32Max,
+		)
+		if err != nil {
+			return nil, err
+		}
+		crc, compressedSize, uncompressedSize = descriptorCRC, descriptorCompressed, descriptorUncompressed
+	}
+
+	if crc != hasher.Sum32() ||
+		compressedSize != entry.header.CompressedSize64 ||
+		uncompressedSize != entry.header.UncompressedSize64 {
+		return nil, errors.New("контрольная сумма или размер записи не совпадает")
+	}
+	entry.header.CRC32 = crc
+
+	return entry, nil
+}
+
+// readDataDescriptor читает дескриптор данных, который zip.Writer пишет после содержимого записи.
+func readDataDescriptor(reader io.Reader, zip64 bool) (uint32, uint64, uint64, error) {
+	sizeLength := 4
+	if zip64 {
+		sizeLength = 8
+	}
+
+	buffer := make([]byte, 4+4+2*sizeLength)
+	if _, err := io.ReadFull(reader, buffer[:4]); err != nil {
+		return 0, 0, 0, err
+	}
+
+	fields := buffer[4:]
+	if binary.LittleEndian.Uint32(buffer[:4]) == zipDataDescriptorSignature {
+		if _, err := io.ReadFull(reader, fields); err != nil {
+			return 0, 0, 0, err
+		}
+	} else {
+		// сигнатура дескриптора необязательна, тогда прочитанные 4 байта — это уже CRC32
+		fields = buffer[:len(buffer)-4]
+		if _, err := io.ReadFull(reader, fields[4:]); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	crc := binary.LittleEndian.Uint32(fields[0:4])
+	if zip64 {
+		return crc, binary.LittleEndian.Uint64(fields[4:12]), binary.LittleEndian.Uint64(fields[12:20]), nil
+	}
+
+	return crc, uint64(binary.LittleEndian.Uint32(fields[4:8])), uint64(binary.LittleEndian.Uint32(fields[8:12])), nil
+}
+
+// copyTo переносит проверенные записи из повреждённого архива в новый без повторного сжатия.
+func (entries zipEntries) copyTo(brokenPath string, archiveWriter ArchiveWriter) ([]string, error) {
+	zipWriter, ok := archiveWriter.(*zipArchiveWriter)
+	if ok == false {
+		return nil, fmt.Errorf("%w: записи zip можно перенести только в zip", ErrUnsupportedArchiveFormat)
+	}
+
+	broken, err := os.Open(brokenPath)
+	if err != nil {
+		return nil, err
+	}
+	defer broken.Close()
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		header := entry.header
+		entryWriter, err := zipWriter.CreateRaw(&header)
+		if err != nil {
+			return nil, err
+		}
+
+		data := io.NewSectionReader(broken, entry.dataOffset, int64(entry.header.CompressedSize64))
+		if _, err := io.Copy(entryWriter, data); err != nil {
+			return nil, err
+		}
+		names = append(names, entry.header.Name)
+	}
+
+	return names, nil
+}
+
+// countingReader считает количество прочитанных байт, чтобы знать смещение данных записи в файле.
+type countingReader struct {
+	reader *bufio.Reader
+	count  int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.reader.Read(p)
+	reader.count += int64(n)
+	return n, err
+}
+
+func (reader *countingReader) ReadByte() (byte, error) {
+	b, err := reader.reader.ReadByte()
+	if err == nil {
+		reader.count++
+	}
+	return b, err
+}
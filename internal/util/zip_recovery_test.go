@@ -0,0 +1,89 @@
+package util
+
+import (
+	"archive/zip"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"workmate_test_project/internal/storage"
+)
+
+// writeBrokenArchive создаёт архив, процесс записи которого "оборвался" на середине последней записи:
+// zip.Writer не закрыт, центрального каталога нет.
+func writeBrokenArchive(t *testing.T, dir string, complete map[string]string, partialName string) string {
+	archive, err := os.Create(filepath.Join(dir, "broken.zip"))
+	assert.NoError(t, err)
+	zipWriter := zip.NewWriter(archive)
+
+	for _, name := range []string{"file1.txt", "file2.txt"} {
+		entry, err := zipWriter.Create(name)
+		assert.NoError(t, err)
+		_, err = io.WriteString(entry, complete[name])
+		assert.NoError(t, err)
+	}
+
+	entry, err := zipWriter.Create(partialName)
+	assert.NoError(t, err)
+	_, err = io.WriteString(entry, "недописанный файл")
+	assert.NoError(t, err)
+
+	assert.NoError(t, zipWriter.Flush())
+	assert.NoError(t, archive.Close())
+
+	return filepath.Join(dir, "broken.zip")
+}
+
+func TestRecoverArchive_ZIPKeepsCompleteEntries(t *testing.T) {
+	dir := t.TempDir()
+	complete := map[string]string{
+		"file1.txt": "содержимое первого файла",
+		"file2.txt": "содержимое второго файла",
+	}
+	archivePath := writeBrokenArchive(t, dir, complete, "file3.txt")
+
+	_, err := zip.OpenReader(archivePath)
+	assert.Error(t, err, "архив без центрального каталога не должен открываться")
+
+	archives, err := storage.NewLocalStorage(dir)
+	assert.NoError(t, err)
+	defer archives.Close()
+	spoolDir := t.TempDir()
+
+	archive, archiveWriter, names, err := RecoverArchive(context.Background(), archives, "broken.zip",
+		FormatZIP, FormatZIP.DefaultCompressionLevel(), spoolDir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"file1.txt", "file2.txt"}, names, "оборванная запись не должна восстанавливаться")
+
+	content := "файл после восстановления"
+	assert.NoError(t, archiveWriter.AddFile("file4.txt", int64(len(content)), time.Now(), strings.NewReader(content)))
+	assert.NoError(t, archiveWriter.Close())
+	assert.NoError(t, archive.Finalize())
+
+	reader, err := zip.OpenReader(archivePath)
+	assert.NoError(t, err, "восстановленный архив должен открываться")
+	defer reader.Close()
+
+	assert.Len(t, reader.File, 3)
+	for _, file := range reader.File[:2] {
+		content, err := file.Open()
+		assert.NoError(t, err)
+		data, err := io.ReadAll(content)
+		assert.NoError(t, err, "CRC32 восстановленной записи должен совпадать")
+		assert.Equal(t, complete[file.Name], string(data))
+		content.Close()
+	}
+	assert.Equal(t, "file4.txt", reader.File[2].Name)
+	spooled, err := os.ReadDir(spoolDir)
+	assert.NoError(t, err)
+	assert.Empty(t, spooled, "временная копия архива должна удаляться")
+}
+
+func TestRecoverArchive_NotFound(t *testing.T) {
+	_, _, _, err := RecoverArchive(context.Background(), storage.NewMemoryStorage(), "missing.zip", FormatZIP, 0, t.TempDir())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}